@@ -1,12 +1,16 @@
 package bootstrap
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
 	"myGin/common"
 	"myGin/libs/lib_mongo"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 func Bootstrap(p string) error {
@@ -18,11 +22,25 @@ func Bootstrap(p string) error {
 	if err := common.InitDebugPProf(env.Cfg); err != nil {
 		return err
 	}
-	mongoClient, err := InitMongoClient(env.Cfg)
+	// 与默认连接同名会覆盖MongoCli
+	for name := range env.Cfg.MongoConns {
+		if name == "" || name == common.DefaultMongo {
+			return fmt.Errorf("mongodb %q: the name is reserved for Mongodb, rename it in MongoConns", name)
+		}
+	}
+	mongoCli, err := InitMongo(common.DefaultMongo, &env.Cfg.Mongodb)
 	if err != nil {
 		return err
 	}
-	env.MongoCli = mongoClient
+	env.SetMongo(common.DefaultMongo, mongoCli)
+	for name, cfg := range env.Cfg.MongoConns {
+		cfg := cfg
+		mongoCli, err := InitMongo(name, &cfg)
+		if err != nil {
+			return fmt.Errorf("mongodb %s: %w", name, err)
+		}
+		env.SetMongo(name, mongoCli)
+	}
 	return nil
 }
 
@@ -52,14 +70,307 @@ func InitLog(setting *common.Config) error {
 	return nil
 }
 
-func InitMongoClient(setting *common.Config) (lib_mongo.DBAdaptor, error) {
+// InitMongo 连接name对应的mongodb，按配置挂载重试、软删除与钩子，并同步索引与执行迁移
+func InitMongo(name string, cfg *common.MongoCfg) (lib_mongo.DBAdaptor, error) {
+	mongoClient, err := InitMongoClient(name, cfg)
+	if err != nil {
+		return nil, err
+	}
+	mongoCli, err := InitMongoTenant(name, cfg, mongoClient)
+	if err != nil {
+		return nil, err
+	}
+	if err = InitMongoSchema(name, cfg, mongoClient); err != nil {
+		return nil, err
+	}
+	return mongoCli, nil
+}
+
+// wrapMongo 按配置挂载重试、软删除与钩子
+func wrapMongo(name string, cfg *common.MongoCfg, mongoClient *lib_mongo.MongoSession) lib_mongo.DBAdaptor {
+	mongoCli := InitMongoResilience(name, cfg, mongoClient)
+	if len(cfg.SoftDelete) > 0 {
+		mongoCli = lib_mongo.NewSoftDelete(mongoCli, cfg.SoftDelete...)
+	}
+	return InitMongoHooks(cfg, mongoCli)
+}
+
+// InitMongoTenant 按配置按租户字段或按库隔离租户数据
+func InitMongoTenant(name string, cfg *common.MongoCfg, mongoClient *lib_mongo.MongoSession) (lib_mongo.DBAdaptor, error) {
+	mongoCli := wrapMongo(name, cfg, mongoClient)
+	tenant := cfg.Tenant
+	switch tenant.Mode {
+	case "":
+		return mongoCli, nil
+	case "field":
+		return lib_mongo.NewTenantDB(mongoCli, lib_mongo.TenantOptions{Field: tenant.Field, Shared: tenant.Shared}), nil
+	case "database":
+		prefix := tenant.DbPrefix
+		if prefix == "" {
+			prefix = cfg.DbName + "_"
+		}
+		known, err := knownTenants(tenant, mongoClient)
+		if err != nil {
+			return nil, err
+		}
+		return lib_mongo.NewTenantDB(mongoCli, lib_mongo.TenantOptions{
+			Shared: tenant.Shared,
+			Known:  known,
+			Database: func(ctx context.Context, t string) (lib_mongo.DBAdaptor, error) {
+				tenantClient := mongoClient.Database(prefix + t)
+				if err := initMongoIndexes(ctx, name, cfg, tenantClient); err != nil {
+					return nil, err
+				}
+				// 每个租户库有自己的迁移版本与迁移锁；迁移不随建库超时中断
+				if err := initMongoMigrations(context.WithoutCancel(ctx), cfg, tenantClient); err != nil {
+					return nil, fmt.Errorf("tenant %s: %w", t, err)
+				}
+				return wrapMongo(name+"/"+t, cfg, tenantClient), nil
+			},
+			InitTimeout: time.Duration(tenant.InitTimeout) * time.Second,
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown tenant mode %q", tenant.Mode)
+}
+
+// knownTenants 按库隔离时只为Tenants中列出的或Registry集合中存在的租户创建库
+func knownTenants(cfg common.MongoTenantCfg, mongoClient *lib_mongo.MongoSession) (func(ctx context.Context, tenant string) (bool, error), error) {
+	if len(cfg.Tenants) == 0 && cfg.Registry == "" {
+		return nil, errors.New("tenant mode database requires Tenant.Tenants or Tenant.Registry")
+	}
+	tenants := make(map[string]bool, len(cfg.Tenants))
+	for _, t := range cfg.Tenants {
+		tenants[t] = true
+	}
+	return func(ctx context.Context, tenant string) (bool, error) {
+		if tenants[tenant] || cfg.Registry == "" {
+			return tenants[tenant], nil
+		}
+		n, err := mongoClient.FindCountCtx(ctx, cfg.Registry, bson.M{"_id": tenant})
+		return n > 0, err
+	}, nil
+}
+
+func InitMongoClient(name string, cfg *common.MongoCfg) (*lib_mongo.MongoSession, error) {
+	clientOpts, err := cfg.ClientOptions()
+	if err != nil {
+		return nil, err
+	}
 	mongoCli := lib_mongo.NewMongoSession()
-	MongoURL := fmt.Sprintf("mongodb://%s:%s@%s/%s?authSource=%s",
-		setting.Mongodb.User, setting.Mongodb.Passwd, setting.Mongodb.Host, setting.Mongodb.DbName, setting.Mongodb.DbName)
-	err := mongoCli.Connect(MongoURL, setting.Mongodb.DbName)
+	if cfg.Monitor.Enable {
+		mongoCli.SetMonitor(lib_mongo.MonitorOptions{
+			Name:          name,
+			SlowThreshold: time.Duration(cfg.Monitor.SlowThreshold) * time.Millisecond,
+			OnSlow:        logSlowCommand,
+		})
+	}
+	if guard := cfg.ScanGuard; guard.Enable {
+		mongoCli.SetScanGuard(lib_mongo.ScanGuardOptions{
+			Collections: guard.Collections,
+			Fail:        guard.Fail,
+			OnCollScan:  logCollScan(name),
+		})
+	}
+	if health := cfg.Health; health.Interval > 0 {
+		mongoCli.SetHealthCheck(lib_mongo.HealthOptions{
+			Interval: time.Duration(health.Interval) * time.Second,
+			Timeout:  time.Duration(health.Timeout) * time.Millisecond,
+			OnChange: logHealthChange(name),
+		})
+	}
+	err = mongoCli.ConnectOptions(clientOpts, cfg.DbName)
 	if err != nil {
 		return nil, err
 	}
-	mongoCli.SetPoolLimit(setting.Mongodb.PoolLimit)
 	return mongoCli, nil
 }
+
+func logSlowCommand(ev lib_mongo.CommandEvent) {
+	logrus.WithFields(logrus.Fields{
+		"db":         ev.Database,
+		"collection": ev.Collection,
+		"command":    ev.Command,
+		"duration":   ev.Duration.String(),
+		"filter":     ev.Filter,
+		"error":      ev.Err,
+	}).Warn("mongodb slow command")
+}
+
+func logCollScan(name string) func(lib_mongo.CollScan) {
+	return func(scan lib_mongo.CollScan) {
+		logrus.WithFields(logrus.Fields{
+			"mongo":     name,
+			"namespace": scan.Namespace,
+			"query":     scan.Shape,
+			"stages":    scan.Plan.Stages,
+		}).Warn("mongodb query uses a collection scan")
+	}
+}
+
+func logHealthChange(name string) func(prev, cur lib_mongo.Health) {
+	return func(prev, cur lib_mongo.Health) {
+		entry := logrus.WithFields(logrus.Fields{
+			"mongo":    name,
+			"from":     prev.Status,
+			"to":       cur.Status,
+			"writable": cur.Writable,
+			"latency":  cur.Latency.String(),
+			"error":    cur.Err,
+		})
+		if cur.Status == lib_mongo.HealthUp {
+			entry.Info("mongodb health changed")
+			return
+		}
+		entry.Warn("mongodb health changed")
+	}
+}
+
+// InitMongoSchema 同步索引并执行迁移；Lazy时若mongodb不可用则降级启动，恢复后在后台执行
+func InitMongoSchema(name string, cfg *common.MongoCfg, mongoCli *lib_mongo.MongoSession) error {
+	if health := cfg.Health; health.Lazy {
+		timeout := time.Duration(health.Timeout) * time.Millisecond
+		if timeout <= 0 {
+			timeout = 2 * time.Second
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := mongoCli.WaitHealthy(ctx)
+		cancel()
+		if err != nil {
+			logrus.Warnf("mongodb %s unreachable, starting in degraded mode: %v", name, err)
+			// 索引与迁移完成前报告为down；失败时(如数据库版本高于程序)停止服务
+			mongoCli.MarkDown(fmt.Errorf("mongodb %s schema not initialized", name))
+			go func() {
+				if err := mongoCli.WaitHealthy(context.Background()); err != nil {
+					return
+				}
+				logrus.Infof("mongodb %s reachable, syncing indexes and migrations", name)
+				if err := initMongoSchema(name, cfg, mongoCli); err != nil {
+					err = fmt.Errorf("mongodb %s schema init: %w", name, err)
+					mongoCli.MarkDown(err)
+					logrus.Error(err)
+					common.GetEnv().Fail(err)
+					return
+				}
+				mongoCli.MarkDown(nil)
+			}()
+			return nil
+		}
+	}
+	return initMongoSchema(name, cfg, mongoCli)
+}
+
+// initMongoSchema 代码中注册的索引与迁移只作用于默认连接
+func initMongoSchema(name string, cfg *common.MongoCfg, mongoCli lib_mongo.DBAdaptor) error {
+	if err := InitMongoIndexes(name, cfg, mongoCli); err != nil {
+		return err
+	}
+	if name != common.DefaultMongo {
+		return nil
+	}
+	return InitMongoMigrations(cfg, mongoCli)
+}
+
+// InitMongoResilience 按配置为数据库调用增加重试与熔断
+func InitMongoResilience(name string, setting *common.MongoCfg, mongoCli lib_mongo.DBAdaptor) lib_mongo.DBAdaptor {
+	cfg := setting.Resilience
+	if !cfg.Enable {
+		return mongoCli
+	}
+	var breaker *lib_mongo.Breaker
+	if cfg.BreakerThreshold > 0 {
+		breaker = lib_mongo.NewBreaker(lib_mongo.BreakerPolicy{
+			FailureThreshold: cfg.BreakerThreshold,
+			OpenTimeout:      time.Duration(cfg.BreakerOpenTimeout) * time.Second,
+			OnStateChange:    logBreakerState(name),
+		})
+	}
+	return lib_mongo.NewResilient(mongoCli, lib_mongo.RetryPolicy{
+		MaxAttempts:    cfg.MaxAttempts,
+		InitialBackoff: time.Duration(cfg.InitialBackoff) * time.Millisecond,
+		MaxBackoff:     time.Duration(cfg.MaxBackoff) * time.Millisecond,
+	}, breaker)
+}
+
+func logBreakerState(name string) func(from, to lib_mongo.BreakerState) {
+	return func(from, to lib_mongo.BreakerState) {
+		entry := logrus.WithFields(logrus.Fields{"mongo": name, "from": from.String(), "to": to.String()})
+		if to == lib_mongo.BreakerOpen {
+			entry.Error("mongodb circuit breaker state changed")
+			return
+		}
+		entry.Warn("mongodb circuit breaker state changed")
+	}
+}
+
+// InitMongoHooks 挂载代码中注册的钩子及配置的时间戳钩子
+func InitMongoHooks(cfg *common.MongoCfg, mongoCli lib_mongo.DBAdaptor) lib_mongo.DBAdaptor {
+	hookDB := lib_mongo.NewHookDB(mongoCli)
+	for _, name := range cfg.Timestamps {
+		hookDB.Register(name, lib_mongo.TimestampHooks())
+	}
+	return hookDB
+}
+
+func InitMongoIndexes(name string, setting *common.MongoCfg, mongoCli lib_mongo.DBAdaptor) error {
+	return initMongoIndexes(context.Background(), name, setting, mongoCli)
+}
+
+func initMongoIndexes(ctx context.Context, name string, setting *common.MongoCfg, mongoCli lib_mongo.DBAdaptor) error {
+	cfg := setting.IndexSync
+	if !cfg.Enable {
+		return nil
+	}
+	specs := cfg.Indexes
+	if name == common.DefaultMongo {
+		specs = append(lib_mongo.RegisteredIndexes(), cfg.Indexes...)
+	}
+	diff, err := mongoCli.SyncIndexes(ctx, specs, lib_mongo.IndexSyncOptions{
+		DryRun:    cfg.DryRun,
+		DropExtra: cfg.DropExtra,
+	})
+	if err != nil {
+		return err
+	}
+	for _, line := range diff.Lines() {
+		logrus.Infof("mongodb %s index diff: %s", name, line)
+	}
+	if cfg.DryRun && !diff.Empty() {
+		logrus.Warnf("mongodb %s index sync dry run, %d index changes not applied", name, len(diff.Lines()))
+	}
+	return nil
+}
+
+// InitMongoMigrations 拒绝在数据库版本高于程序时启动，按配置执行未执行的迁移
+func InitMongoMigrations(cfg *common.MongoCfg, mongoCli lib_mongo.DBAdaptor) error {
+	return initMongoMigrations(context.Background(), cfg, mongoCli)
+}
+
+func initMongoMigrations(ctx context.Context, cfg *common.MongoCfg, mongoCli lib_mongo.DBAdaptor) error {
+	migrator := newMigrator(cfg, mongoCli)
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if err = status.Check(); err != nil {
+		return err
+	}
+	if len(status.Pending) == 0 {
+		return nil
+	}
+	if !cfg.Migration.AutoMigrate {
+		logrus.Warnf("mongodb has %d pending migrations, run `migrate up` to apply", len(status.Pending))
+		return nil
+	}
+	done, err := migrator.Up(ctx)
+	for _, mig := range done {
+		logrus.Infof("mongodb migration %d %s applied", mig.Version, mig.Name)
+	}
+	return err
+}
+
+// newMigrator LockTimeout只限制等待迁移锁，迁移本身不限时
+func newMigrator(cfg *common.MongoCfg, mongoCli lib_mongo.DBAdaptor) *lib_mongo.Migrator {
+	migrator := lib_mongo.NewMigrator(mongoCli)
+	migrator.LockTimeout = time.Duration(cfg.Migration.LockTimeout) * time.Second
+	return migrator
+}
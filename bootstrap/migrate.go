@@ -0,0 +1,117 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"myGin/common"
+	"myGin/libs/lib_mongo"
+	"sort"
+	"strconv"
+)
+
+// RunMigrate 执行迁移子命令: migrate up | migrate down [steps] | migrate status
+// 按库隔离租户时依次作用于默认库与Tenants、Registry中登记的各租户库
+func RunMigrate(p string, args []string) error {
+	common.EnvBoot(p)
+	env := common.GetEnv()
+	if err := InitLog(env.Cfg); err != nil {
+		return err
+	}
+	cfg := &env.Cfg.Mongodb
+	mongoClient, err := InitMongoClient(common.DefaultMongo, cfg)
+	if err != nil {
+		return err
+	}
+	env.SetMongo(common.DefaultMongo, mongoClient)
+
+	ctx := context.Background()
+	if err = runMigrate(ctx, cfg, mongoClient, args); err != nil || cfg.Tenant.Mode != "database" {
+		return err
+	}
+	tenants, err := migrationTenants(ctx, cfg.Tenant, mongoClient)
+	if err != nil {
+		return err
+	}
+	prefix := cfg.Tenant.DbPrefix
+	if prefix == "" {
+		prefix = cfg.DbName + "_"
+	}
+	for _, t := range tenants {
+		fmt.Printf("tenant %s\n", t)
+		if err = runMigrate(ctx, cfg, mongoClient.Database(prefix+t), args); err != nil {
+			return fmt.Errorf("tenant %s: %w", t, err)
+		}
+	}
+	return nil
+}
+
+func runMigrate(ctx context.Context, cfg *common.MongoCfg, mongoClient lib_mongo.DBAdaptor, args []string) error {
+	migrator := newMigrator(cfg, mongoClient)
+	cmd := "status"
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+	switch cmd {
+	case "up":
+		done, err := migrator.Up(ctx)
+		for _, mig := range done {
+			fmt.Printf("applied  %d %s\n", mig.Version, mig.Name)
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				return fmt.Errorf("invalid steps %q", args[1])
+			}
+		}
+		done, err := migrator.Down(ctx, steps)
+		for _, mig := range done {
+			fmt.Printf("reverted %d %s\n", mig.Version, mig.Name)
+		}
+		return err
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("current %d, latest %d\n", status.Current, status.Latest)
+		for _, a := range status.Applied {
+			fmt.Printf("applied  %d %s %s\n", a.Version, a.Name, a.AppliedAt.Format("2006-01-02 15:04:05"))
+		}
+		for _, mig := range status.Pending {
+			fmt.Printf("pending  %d %s\n", mig.Version, mig.Name)
+		}
+		return nil
+	}
+	return errors.New("usage: migrate up | migrate down [steps] | migrate status")
+}
+
+// migrationTenants Tenants与Registry中登记的租户，按名称排序
+func migrationTenants(ctx context.Context, cfg common.MongoTenantCfg, mongoClient *lib_mongo.MongoSession) ([]string, error) {
+	seen := map[string]bool{}
+	for _, t := range cfg.Tenants {
+		seen[t] = true
+	}
+	if cfg.Registry != "" {
+		ids, err := mongoClient.FindWithDistinctCtx(ctx, cfg.Registry, "_id", nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			if t, ok := id.(string); ok {
+				seen[t] = true
+			}
+		}
+	}
+	tenants := make([]string, 0, len(seen))
+	for t := range seen {
+		if lib_mongo.ValidTenant(t) {
+			tenants = append(tenants, t)
+		}
+	}
+	sort.Strings(tenants)
+	return tenants, nil
+}
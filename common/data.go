@@ -9,6 +9,8 @@ import (
 	"os"
 	"path"
 	"runtime/pprof"
+	"sort"
+	"sync"
 )
 
 // GEnv 全局变量env
@@ -22,15 +24,113 @@ var (
 	threadCreateProfilingFile *os.File
 )
 
+// DefaultMongo Mongodb配置的连接名
+const DefaultMongo = "default"
+
 type Env struct {
-	Cfg      *Config
+	Cfg *Config
+	// 默认连接，与Mongo(DefaultMongo)相同
 	MongoCli lib_mongo.DBAdaptor
+	// MongoConns中配置的其他连接
+	mongos map[string]lib_mongo.DBAdaptor
+	// 运行中发生的致命错误，main收到后停止服务
+	fatalOnce sync.Once
+	fatal     chan error
+}
+
+func (e *Env) fatalCh() chan error {
+	e.fatalOnce.Do(func() {
+		e.fatal = make(chan error, 1)
+	})
+	return e.fatal
+}
+
+// Fail reports an error the server cannot keep serving with, only the first one is kept
+func (e *Env) Fail(err error) {
+	select {
+	case e.fatalCh() <- err:
+	default:
+	}
+}
+
+// Fatal returns the channel receiving the error passed to Fail
+func (e *Env) Fatal() <-chan error {
+	return e.fatalCh()
+}
+
+// Mongo returns the connection name, DefaultMongo or "" is MongoCli.
+// It panics when name is not configured, names that are not constants
+// of the code, e.g. read from a request, go through LookupMongo.
+func (e *Env) Mongo(name string) lib_mongo.DBAdaptor {
+	db, ok := e.LookupMongo(name)
+	if !ok {
+		panic(fmt.Sprintf("mongodb connection %q is not configured", name))
+	}
+	return db
+}
+
+// LookupMongo returns the connection name and whether it is configured
+func (e *Env) LookupMongo(name string) (lib_mongo.DBAdaptor, bool) {
+	if name == "" || name == DefaultMongo {
+		return e.MongoCli, e.MongoCli != nil
+	}
+	db, ok := e.mongos[name]
+	return db, ok
+}
+
+// SetMongo sets the connection name, tests may swap in a MemorySession
+func (e *Env) SetMongo(name string, db lib_mongo.DBAdaptor) {
+	if name == "" || name == DefaultMongo {
+		e.MongoCli = db
+		return
+	}
+	if e.mongos == nil {
+		e.mongos = map[string]lib_mongo.DBAdaptor{}
+	}
+	e.mongos[name] = db
+}
+
+// MongoNames returns DefaultMongo followed by the other connections sorted by name
+func (e *Env) MongoNames() []string {
+	names := make([]string, 0, len(e.mongos))
+	for name := range e.mongos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{DefaultMongo}, names...)
+}
+
+// DisconnectMongo disconnects every connection
+func (e *Env) DisconnectMongo() {
+	if e.MongoCli != nil {
+		e.MongoCli.Disconnect()
+	}
+	for _, db := range e.mongos {
+		db.Disconnect()
+	}
 }
 
 type Config struct {
 	ProjectName string   `yaml:"ProjectName"`
 	Log         LogCfg   `yaml:"Log"`
 	Mongodb     MongoCfg `yaml:"Mongodb"`
+	// 其他命名连接，如分析库、审计库，通过env.Mongo(name)获取
+	MongoConns map[string]MongoCfg `yaml:"MongoConns"`
+	Tenant     TenantCfg           `yaml:"Tenant"`
+}
+
+// TenantCfg 请求的租户解析
+type TenantCfg struct {
+	Enable bool `yaml:"Enable"`
+	// 按顺序尝试的来源：header、subdomain、jwt，携带的token无效时不再尝试其他来源，来源间租户不一致时拒绝
+	Sources []string `yaml:"Sources"`
+	// 默认X-Tenant-ID，需由网关设置，不能信任客户端传入
+	Header string `yaml:"Header"`
+	// 按子域名解析时的主域名，如cdp.example.com
+	Domain string `yaml:"Domain"`
+	// Authorization中JWT(HS256)的租户claim，默认tenant
+	Claim     string `yaml:"Claim"`
+	JWTSecret string `yaml:"JWTSecret"`
 }
 
 type LogCfg struct {
@@ -42,11 +142,94 @@ type LogCfg struct {
 }
 
 type MongoCfg struct {
-	Host      string `yaml:"Host"`
-	User      string `yaml:"User"`
-	Passwd    string `yaml:"Passwd"`
-	DbName    string `yaml:"DbName"`
-	PoolLimit uint64 `yaml:"PoolLimit"`
+	// 连接配置：URI或Host/User/Passwd，及TLS、读写偏好、超时等
+	lib_mongo.ClientConfig `yaml:",inline"`
+	IndexSync              IndexSyncCfg   `yaml:"IndexSync"`
+	Migration              MigrationCfg   `yaml:"Migration"`
+	Monitor                MonitorCfg     `yaml:"Monitor"`
+	Resilience             ResilienceCfg  `yaml:"Resilience"`
+	Health                 HealthCfg      `yaml:"Health"`
+	Tenant                 MongoTenantCfg `yaml:"Tenant"`
+	ScanGuard              ScanGuardCfg   `yaml:"ScanGuard"`
+	// 启用软删除的集合
+	SoftDelete []string `yaml:"SoftDelete"`
+	// 自动维护created_at/updated_at的集合，"*"表示所有集合
+	Timestamps []string `yaml:"Timestamps"`
+}
+
+// MongoTenantCfg 多租户数据隔离
+type MongoTenantCfg struct {
+	// field按租户字段隔离，database按库隔离，为空不隔离
+	Mode string `yaml:"Mode"`
+	// 租户字段，默认tenant_id
+	Field string `yaml:"Field"`
+	// 按库隔离时库名为DbPrefix+租户，默认DbName_
+	DbPrefix string `yaml:"DbPrefix"`
+	// 不区分租户的集合
+	Shared []string `yaml:"Shared"`
+	// 按库隔离时允许的租户，与Registry至少配置一个，其他租户的请求被拒绝
+	Tenants []string `yaml:"Tenants"`
+	// 按库隔离时登记租户的集合(默认库中_id为租户)
+	Registry string `yaml:"Registry"`
+	// 按库隔离时首次访问租户创建库(同步索引)的超时时间(秒)，默认30
+	InitTimeout int `yaml:"InitTimeout"`
+}
+
+// ScanGuardCfg 全表扫描检查，仅用于开发与测试环境
+type ScanGuardCfg struct {
+	Enable bool `yaml:"Enable"`
+	// 数据量大的集合，为空时检查所有集合
+	Collections []string `yaml:"Collections"`
+	// 全表扫描的查询直接返回错误
+	Fail bool `yaml:"Fail"`
+}
+
+// HealthCfg 健康检查配置
+type HealthCfg struct {
+	// 检查间隔(秒)，0表示不检查
+	Interval int `yaml:"Interval"`
+	// 单次ping超时(毫秒)
+	Timeout int `yaml:"Timeout"`
+	// 启动时mongodb不可用也继续启动(降级)，恢复后再同步索引与执行迁移
+	Lazy bool `yaml:"Lazy"`
+}
+
+// ResilienceCfg 重试与熔断配置
+type ResilienceCfg struct {
+	Enable bool `yaml:"Enable"`
+	// 包含首次调用的最大次数
+	MaxAttempts int `yaml:"MaxAttempts"`
+	// 首次重试前的最大等待(毫秒)，之后每次翻倍
+	InitialBackoff int `yaml:"InitialBackoff"`
+	// 重试等待上限(毫秒)
+	MaxBackoff int `yaml:"MaxBackoff"`
+	// 连续失败多少次后熔断，0表示不熔断
+	BreakerThreshold int `yaml:"BreakerThreshold"`
+	// 熔断后多久放行试探请求(秒)
+	BreakerOpenTimeout int `yaml:"BreakerOpenTimeout"`
+}
+
+// MonitorCfg 命令监控配置
+type MonitorCfg struct {
+	Enable bool `yaml:"Enable"`
+	// 慢命令阈值(毫秒)，0表示不记录
+	SlowThreshold int `yaml:"SlowThreshold"`
+}
+
+// MigrationCfg 数据迁移配置
+type MigrationCfg struct {
+	// 启动时自动执行未执行的迁移；按库隔离租户时各租户库在首次访问时执行
+	AutoMigrate bool `yaml:"AutoMigrate"`
+	// 等待迁移锁的超时时间(秒)，0表示一直等待，不限制迁移本身的执行时间
+	LockTimeout int `yaml:"LockTimeout"`
+}
+
+// IndexSyncCfg 启动时索引同步配置
+type IndexSyncCfg struct {
+	Enable    bool                  `yaml:"Enable"`
+	DryRun    bool                  `yaml:"DryRun"`
+	DropExtra bool                  `yaml:"DropExtra"`
+	Indexes   []lib_mongo.IndexSpec `yaml:"Indexes"`
 }
 
 func newEnv() *Env {
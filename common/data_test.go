@@ -0,0 +1,64 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc:
+
+package common
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"myGin/libs/lib_mongo"
+)
+
+// closeCounter 记录Disconnect的调用次数
+type closeCounter struct {
+	lib_mongo.DBAdaptor
+	closed int
+}
+
+func (c *closeCounter) Disconnect() {
+	c.closed++
+}
+
+func TestEnvMongo(t *testing.T) {
+	Convey("test env mongo connections", t, func() {
+		env := &Env{}
+		def := &closeCounter{DBAdaptor: lib_mongo.NewMemorySession()}
+		audit := &closeCounter{DBAdaptor: lib_mongo.NewMemorySession()}
+		analytics := &closeCounter{DBAdaptor: lib_mongo.NewMemorySession()}
+
+		_, ok := env.LookupMongo(DefaultMongo)
+		So(ok, ShouldBeFalse)
+		So(env.MongoNames(), ShouldResemble, []string{DefaultMongo})
+
+		env.SetMongo(DefaultMongo, def)
+		env.SetMongo("audit", audit)
+		env.SetMongo("analytics", analytics)
+
+		Convey("default and named connections", func() {
+			So(env.MongoCli, ShouldEqual, def)
+			So(env.Mongo(""), ShouldEqual, def)
+			So(env.Mongo(DefaultMongo), ShouldEqual, def)
+			So(env.Mongo("audit"), ShouldEqual, audit)
+			So(env.MongoNames(), ShouldResemble, []string{DefaultMongo, "analytics", "audit"})
+
+			env.SetMongo("", audit)
+			So(env.MongoCli, ShouldEqual, audit)
+		})
+
+		Convey("unknown names", func() {
+			db, ok := env.LookupMongo("billing")
+			So(ok, ShouldBeFalse)
+			So(db, ShouldBeNil)
+			So(func() { env.Mongo("billing") }, ShouldPanic)
+		})
+
+		Convey("disconnect every connection", func() {
+			env.DisconnectMongo()
+			So(def.closed, ShouldEqual, 1)
+			So(audit.closed, ShouldEqual, 1)
+			So(analytics.closed, ShouldEqual, 1)
+		})
+	})
+}
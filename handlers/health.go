@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"myGin/common"
+	"myGin/libs/lib_mongo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Health reports the health of every mongo connection, 503 when one is down
+func Health(c *gin.Context) {
+	env := common.GetEnv()
+	status := 200
+	mongos := gin.H{}
+	for _, name := range env.MongoNames() {
+		health := env.Mongo(name).Health()
+		if health.Status == lib_mongo.HealthDown {
+			status = 503
+		}
+		mongos[name] = healthJSON(health)
+	}
+	c.JSON(status, gin.H{"mongodb": mongos})
+}
+
+func healthJSON(health lib_mongo.Health) gin.H {
+	servers := make([]gin.H, 0, len(health.Servers))
+	for _, s := range health.Servers {
+		servers = append(servers, gin.H{
+			"addr":   s.Addr,
+			"kind":   s.Kind,
+			"rtt_ms": s.RTT.Milliseconds(),
+			"error":  s.Err,
+		})
+	}
+	return gin.H{
+		"status":     health.Status,
+		"writable":   health.Writable,
+		"latency_ms": health.Latency.Milliseconds(),
+		"checked_at": health.CheckedAt,
+		"error":      health.Err,
+		"servers":    servers,
+	}
+}
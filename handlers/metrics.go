@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"myGin/libs/lib_mongo"
+)
+
+// Metrics exposes the mongo command and pool metrics in the Prometheus text format
+func Metrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4")
+	c.Status(200)
+	_ = lib_mongo.DefaultMetrics.WritePrometheus(c.Writer)
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"myGin/libs/lib_mongo"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// PageQuery reads ?cursor= and ?limit= into a keyset page query sorted by sort
+func PageQuery(c *gin.Context, filter interface{}, sort ...string) lib_mongo.PageQuery {
+	limit, err := strconv.ParseInt(c.Query("limit"), 10, 64)
+	if err != nil || limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	return lib_mongo.PageQuery{
+		Filter: filter,
+		Sort:   sort,
+		Limit:  limit,
+		Cursor: c.Query("cursor"),
+	}
+}
+
+// PageJSON writes a page as {"items": [...], "next_cursor": "..."}, next_cursor is empty on the last page
+func PageJSON(c *gin.Context, items interface{}, next string) {
+	c.JSON(http.StatusOK, gin.H{
+		"items":       items,
+		"next_cursor": next,
+	})
+}
+
+// PageError writes 400 for a malformed cursor and 500 otherwise
+func PageError(c *gin.Context, err error) {
+	if errors.Is(err, lib_mongo.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"myGin/common"
+	"myGin/libs/lib_mongo"
+)
+
+var (
+	errInvalidToken   = errors.New("invalid token")
+	errTenantMismatch = errors.New("tenant mismatch")
+)
+
+// Tenant resolves the tenant of the request from the configured sources and puts
+// it in the request context for lib_mongo.TenantDB. Requests without a valid tenant
+// get 400, with a bearer token that fails verification or lacks the claim 401, and
+// whose sources name different tenants 403.
+func Tenant(cfg common.TenantCfg) gin.HandlerFunc {
+	if cfg.Header == "" {
+		cfg.Header = "X-Tenant-ID"
+	}
+	if cfg.Claim == "" {
+		cfg.Claim = "tenant"
+	}
+	return func(c *gin.Context) {
+		tenant, err := resolveTenant(c, cfg)
+		switch {
+		case errors.Is(err, errInvalidToken):
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if !lib_mongo.ValidTenant(tenant) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "tenant required"})
+			return
+		}
+		c.Request = c.Request.WithContext(lib_mongo.WithTenant(c.Request.Context(), tenant))
+		c.Set("tenant", tenant)
+		c.Next()
+	}
+}
+
+// resolveTenant 返回第一个来源解析到的租户；携带的token校验失败或缺少claim时不再尝试其他来源，
+// 多个来源解析到不同租户时拒绝，避免客户端通过header指定租户
+func resolveTenant(c *gin.Context, cfg common.TenantCfg) (string, error) {
+	var tenant string
+	for _, source := range cfg.Sources {
+		var value string
+		switch source {
+		case "header":
+			value = c.GetHeader(cfg.Header)
+		case "subdomain":
+			value = subdomain(c.Request.Host, cfg.Domain)
+		case "jwt":
+			auth := c.GetHeader("Authorization")
+			if !strings.HasPrefix(auth, "Bearer ") {
+				continue
+			}
+			claim, err := jwtClaim(strings.TrimPrefix(auth, "Bearer "), cfg.JWTSecret, cfg.Claim)
+			if err != nil {
+				return "", err
+			}
+			if claim == "" {
+				return "", errInvalidToken
+			}
+			value = claim
+		}
+		if value == "" {
+			continue
+		}
+		if tenant != "" && value != tenant {
+			return "", errTenantMismatch
+		}
+		tenant = value
+	}
+	return tenant, nil
+}
+
+// subdomain returns brand of brand.domain
+func subdomain(host, domain string) string {
+	if domain == "" {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	sub := strings.TrimSuffix(host, "."+strings.ToLower(domain))
+	if sub == host || strings.Contains(sub, ".") {
+		return ""
+	}
+	return sub
+}
+
+// jwtClaim verifies an HS256 token with secret and returns its claim
+func jwtClaim(token, secret, claim string) (string, error) {
+	parts := strings.Split(token, ".")
+	if secret == "" || len(parts) != 3 {
+		return "", errInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return "", errInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errInvalidToken
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return "", errInvalidToken
+	}
+	var claims map[string]interface{}
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return "", errInvalidToken
+	}
+	if exp, ok := claims["exp"].(float64); ok && time.Now().Unix() >= int64(exp) {
+		return "", errInvalidToken
+	}
+	value, _ := claims[claim].(string)
+	return value, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
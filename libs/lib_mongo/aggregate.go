@@ -0,0 +1,202 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: 聚合管道构建器
+
+package lib_mongo
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Pipeline builds an aggregation pipeline and its options
+//
+//	p := lib_mongo.NewPipeline().
+//		Match(bson.M{"status": "paid"}).
+//		Group("$user_id", bson.M{"total": bson.M{"$sum": "$amount"}}).
+//		Sort(bson.D{{Key: "total", Value: -1}}).
+//		Limit(10).
+//		MaxTime(5 * time.Second)
+//	it, err := env.MongoCli.Aggregate(ctx, "orders", p)
+type Pipeline struct {
+	stages mongo.Pipeline
+	opts   *options.AggregateOptions
+}
+
+// NewPipeline returns an empty pipeline, disk use is allowed by default as FindWithAggregation does
+func NewPipeline() *Pipeline {
+	return &Pipeline{
+		stages: mongo.Pipeline{},
+		opts:   options.Aggregate().SetAllowDiskUse(true),
+	}
+}
+
+// Stage appends a raw stage, e.g. bson.D{{Key: "$sample", Value: bson.M{"size": 10}}}
+func (p *Pipeline) Stage(stage bson.D) *Pipeline {
+	p.stages = append(p.stages, stage)
+	return p
+}
+
+func (p *Pipeline) stage(op string, arg interface{}) *Pipeline {
+	return p.Stage(bson.D{{Key: op, Value: arg}})
+}
+
+// Match appends a $match stage
+func (p *Pipeline) Match(filter interface{}) *Pipeline {
+	return p.stage("$match", filter)
+}
+
+// Group appends a $group stage grouping by id, fields are the accumulators
+func (p *Pipeline) Group(id interface{}, fields bson.M) *Pipeline {
+	group := bson.D{{Key: "_id", Value: id}}
+	for k, v := range fields {
+		group = append(group, bson.E{Key: k, Value: v})
+	}
+	return p.stage("$group", group)
+}
+
+// Project appends a $project stage
+func (p *Pipeline) Project(projection interface{}) *Pipeline {
+	return p.stage("$project", projection)
+}
+
+// Sort appends a $sort stage, use bson.D to keep the order of the keys
+func (p *Pipeline) Sort(sort interface{}) *Pipeline {
+	return p.stage("$sort", sort)
+}
+
+// Skip appends a $skip stage
+func (p *Pipeline) Skip(n int64) *Pipeline {
+	return p.stage("$skip", n)
+}
+
+// Limit appends a $limit stage
+func (p *Pipeline) Limit(n int64) *Pipeline {
+	return p.stage("$limit", n)
+}
+
+// Lookup appends a $lookup stage joining from on localField == foreignField into as
+func (p *Pipeline) Lookup(from, localField, foreignField, as string) *Pipeline {
+	return p.stage("$lookup", bson.D{
+		{Key: "from", Value: from},
+		{Key: "localField", Value: localField},
+		{Key: "foreignField", Value: foreignField},
+		{Key: "as", Value: as},
+	})
+}
+
+// Unwind appends an $unwind stage of the array at path ("tags" or "$tags")
+func (p *Pipeline) Unwind(path string, preserveNullAndEmpty bool) *Pipeline {
+	if !strings.HasPrefix(path, "$") {
+		path = "$" + path
+	}
+	if !preserveNullAndEmpty {
+		return p.stage("$unwind", path)
+	}
+	return p.stage("$unwind", bson.D{
+		{Key: "path", Value: path},
+		{Key: "preserveNullAndEmptyArrays", Value: true},
+	})
+}
+
+// Facet appends a $facet stage running each sub pipeline on the same input,
+// the options of the sub pipelines are ignored
+func (p *Pipeline) Facet(facets map[string]*Pipeline) *Pipeline {
+	facet := bson.M{}
+	for name, sub := range facets {
+		facet[name] = sub.stages
+	}
+	return p.stage("$facet", facet)
+}
+
+// Bucket appends a $bucket stage, def and output are optional
+func (p *Pipeline) Bucket(groupBy interface{}, boundaries []interface{}, def interface{}, output bson.M) *Pipeline {
+	bucket := bson.D{
+		{Key: "groupBy", Value: groupBy},
+		{Key: "boundaries", Value: boundaries},
+	}
+	if def != nil {
+		bucket = append(bucket, bson.E{Key: "default", Value: def})
+	}
+	if len(output) > 0 {
+		bucket = append(bucket, bson.E{Key: "output", Value: output})
+	}
+	return p.stage("$bucket", bucket)
+}
+
+// Count appends a $count stage writing the number of documents into field
+func (p *Pipeline) Count(field string) *Pipeline {
+	return p.stage("$count", field)
+}
+
+// BatchSize sets the number of documents of each batch of the cursor
+func (p *Pipeline) BatchSize(size int32) *Pipeline {
+	p.opts.SetBatchSize(size)
+	return p
+}
+
+// AllowDiskUse lets stages write temporary files when they exceed the memory limit
+func (p *Pipeline) AllowDiskUse(allow bool) *Pipeline {
+	p.opts.SetAllowDiskUse(allow)
+	return p
+}
+
+// Hint forces the index used by the first $match/$sort, by name or key document
+func (p *Pipeline) Hint(hint interface{}) *Pipeline {
+	p.opts.SetHint(hint)
+	return p
+}
+
+// Collation sets the string comparison rules
+func (p *Pipeline) Collation(collation *options.Collation) *Pipeline {
+	p.opts.SetCollation(collation)
+	return p
+}
+
+// MaxTime limits the server side execution time
+func (p *Pipeline) MaxTime(d time.Duration) *Pipeline {
+	p.opts.SetMaxTime(d)
+	return p
+}
+
+// Stages returns the stages, it can be passed to FindWithAggregation
+func (p *Pipeline) Stages() mongo.Pipeline {
+	return p.stages
+}
+
+// Options returns the aggregate options
+func (p *Pipeline) Options() *options.AggregateOptions {
+	return p.opts
+}
+
+// Aggregate runs the pipeline and returns an iterator over the results
+func (c *Collection) Aggregate(ctx context.Context, p *Pipeline) (*Iter, error) {
+	coll, op := c.resolve(ctx)
+	cur, err := coll.Aggregate(ctx, p.stages, op.aggregate(), p.opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Iter{ctx: ctx, cursor: cur}, nil
+}
+
+// Aggregate runs the pipeline and streams the results, close the iterator when done
+func (ms *MongoSession) Aggregate(ctx context.Context, name string, p *Pipeline) (*Iter, error) {
+	ctx = ms.bindCtx(ctx)
+	it, err := ms.session.DB(ms.dbName).C(name).Aggregate(ctx, p)
+	return it, wrapErr("Aggregate", name, err)
+}
+
+// AggregateAll runs the pipeline and decodes every result into result, which must be a pointer to a slice
+func (ms *MongoSession) AggregateAll(ctx context.Context, name string, p *Pipeline, result interface{}) error {
+	it, err := ms.Aggregate(ctx, name, p)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	return wrapErr("Aggregate", name, it.cursor.All(it.ctx, result))
+}
@@ -0,0 +1,66 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc:
+
+package lib_mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestPipeline(t *testing.T) {
+	Convey("test pipeline builder", t, func() {
+		p := NewPipeline().
+			Match(bson.M{"age": bson.M{"$gte": 18}}).
+			Lookup("orders", "_id", "user_id", "orders").
+			Unwind("orders", true).
+			Group("$_id", bson.M{"total": bson.M{"$sum": "$orders.amount"}}).
+			Facet(map[string]*Pipeline{"top": NewPipeline().Sort(bson.D{{Key: "total", Value: -1}}).Limit(3)}).
+			BatchSize(100).
+			AllowDiskUse(false).
+			MaxTime(time.Second)
+
+		stages := p.Stages()
+		So(len(stages), ShouldEqual, 5)
+		So(stages[1][0].Key, ShouldEqual, "$lookup")
+		So(stages[2][0].Value, ShouldResemble, bson.D{{Key: "path", Value: "$orders"}, {Key: "preserveNullAndEmptyArrays", Value: true}})
+		So(stages[3][0].Value.(bson.D)[0], ShouldResemble, bson.E{Key: "_id", Value: "$_id"})
+		So(len(stages[4][0].Value.(bson.M)["top"].(mongo.Pipeline)), ShouldEqual, 2)
+		So(*p.Options().BatchSize, ShouldEqual, 100)
+		So(*p.Options().AllowDiskUse, ShouldBeFalse)
+		So(*p.Options().MaxTime, ShouldEqual, time.Second)
+	})
+
+	Convey("test memory aggregate", t, func() {
+		type profile struct {
+			ID  int32 `bson:"_id"`
+			Age int32 `bson:"age"`
+		}
+		ms := NewMemorySession()
+		ctx := context.TODO()
+		for i := int32(1); i <= 5; i++ {
+			So(ms.Insert("profile", &profile{ID: i, Age: i * 10}), ShouldBeNil)
+		}
+
+		it, err := ms.Aggregate(ctx, "profile", NewPipeline().Match(bson.M{"age": bson.M{"$gt": 20}}).Sort(bson.D{{Key: "age", Value: -1}}).Limit(2))
+		So(err, ShouldBeNil)
+		var ids []int32
+		var p profile
+		for it.Next(&p) {
+			ids = append(ids, p.ID)
+		}
+		So(it.Err(), ShouldBeNil)
+		So(it.Close(), ShouldBeNil)
+		So(ids, ShouldResemble, []int32{5, 4})
+
+		var counts []bson.M
+		So(ms.AggregateAll(ctx, "profile", NewPipeline().Match(bson.M{"age": bson.M{"$lt": 30}}).Count("n"), &counts), ShouldBeNil)
+		So(counts, ShouldResemble, []bson.M{{"n": int32(2)}})
+	})
+}
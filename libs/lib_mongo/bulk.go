@@ -0,0 +1,247 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: 批量写入
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrEmptyBulk = errors.New("bulk has no operation")
+
+type bulkKind int
+
+const (
+	bulkInsert bulkKind = iota
+	bulkUpdateOne
+	bulkUpdateMany
+	bulkReplaceOne
+	bulkDeleteOne
+	bulkDeleteMany
+)
+
+type bulkOp struct {
+	kind   bulkKind
+	filter interface{}
+	doc    interface{}
+	upsert bool
+}
+
+// Bulk queues write operations that are sent in one round trip.
+// Operations run in order and stop at the first error unless Unordered is set.
+//
+//	b := NewBulk().Unordered()
+//	b.UpdateOne(bson.M{"_id": id}, bson.M{"$inc": bson.M{"events": 1}}, true)
+//	res, err := env.MongoCli.BulkWrite("profile", b)
+type Bulk struct {
+	ops     []bulkOp
+	ordered bool
+}
+
+// NewBulk returns an ordered bulk
+func NewBulk() *Bulk {
+	return &Bulk{ordered: true}
+}
+
+// Unordered lets the server run the operations in any order and continue after errors
+func (b *Bulk) Unordered() *Bulk {
+	b.ordered = false
+	return b
+}
+
+// Len returns the number of queued operations
+func (b *Bulk) Len() int {
+	return len(b.ops)
+}
+
+// Insert queues inserts of docs
+func (b *Bulk) Insert(docs ...interface{}) *Bulk {
+	for _, doc := range docs {
+		b.ops = append(b.ops, bulkOp{kind: bulkInsert, doc: doc})
+	}
+	return b
+}
+
+// UpdateOne queues a raw update ($set, $inc ...) of the first document matching filter
+func (b *Bulk) UpdateOne(filter, update interface{}, upsert bool) *Bulk {
+	b.ops = append(b.ops, bulkOp{kind: bulkUpdateOne, filter: filter, doc: update, upsert: upsert})
+	return b
+}
+
+// UpdateMany queues a raw update of every document matching filter
+func (b *Bulk) UpdateMany(filter, update interface{}, upsert bool) *Bulk {
+	b.ops = append(b.ops, bulkOp{kind: bulkUpdateMany, filter: filter, doc: update, upsert: upsert})
+	return b
+}
+
+// ReplaceOne queues a replacement of the first document matching filter
+func (b *Bulk) ReplaceOne(filter, replacement interface{}, upsert bool) *Bulk {
+	b.ops = append(b.ops, bulkOp{kind: bulkReplaceOne, filter: filter, doc: replacement, upsert: upsert})
+	return b
+}
+
+// DeleteOne queues a removal of the first document matching filter
+func (b *Bulk) DeleteOne(filter interface{}) *Bulk {
+	b.ops = append(b.ops, bulkOp{kind: bulkDeleteOne, filter: filter})
+	return b
+}
+
+// DeleteMany queues a removal of every document matching filter
+func (b *Bulk) DeleteMany(filter interface{}) *Bulk {
+	b.ops = append(b.ops, bulkOp{kind: bulkDeleteMany, filter: filter})
+	return b
+}
+
+// BulkResult counts what a bulk did
+type BulkResult struct {
+	InsertedCount int64
+	MatchedCount  int64
+	ModifiedCount int64
+	DeletedCount  int64
+	UpsertedCount int64
+	// 操作下标 -> upsert生成的_id
+	UpsertedIDs map[int64]interface{}
+}
+
+// BulkOpError is the failure of one queued operation
+type BulkOpError struct {
+	Index   int
+	Code    int
+	Message string
+}
+
+func (e BulkOpError) Error() string {
+	return fmt.Sprintf("op %d: (%d) %s", e.Index, e.Code, e.Message)
+}
+
+// Is classifies the server error code of the operation, e.g. ErrIsDuplicate
+func (e BulkOpError) Is(target error) bool {
+	switch target {
+	case ErrIsDuplicate:
+		for _, code := range duplicateKeyCodes {
+			if e.Code == code {
+				return true
+			}
+		}
+	case ErrValidation:
+		return e.Code == codeValidationFailure
+	}
+	return false
+}
+
+// BulkError lists the failed operations, the BulkResult still counts the successful ones.
+// errors.Is matches the kind of any failed operation, and mongo.IsDuplicateKeyError
+// the driver exception it was built from.
+type BulkError struct {
+	Errors []BulkOpError
+	// write concern错误等非单条操作的错误
+	Cause error
+	// driver返回的BulkWriteException，内存实现为nil
+	exception error
+}
+
+func (e *BulkError) Error() string {
+	msgs := make([]string, 0, len(e.Errors)+1)
+	for _, opErr := range e.Errors {
+		msgs = append(msgs, opErr.Error())
+	}
+	if e.Cause != nil {
+		msgs = append(msgs, e.Cause.Error())
+	}
+	return "bulk write error: " + strings.Join(msgs, ", ")
+}
+
+func (e *BulkError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors)+2)
+	for _, opErr := range e.Errors {
+		errs = append(errs, opErr)
+	}
+	if e.Cause != nil {
+		errs = append(errs, e.Cause)
+	}
+	if e.exception != nil {
+		errs = append(errs, e.exception)
+	}
+	return errs
+}
+
+// bulkError converts the driver exception
+func bulkError(bwe mongo.BulkWriteException) *BulkError {
+	bulkErr := &BulkError{exception: bwe}
+	for _, we := range bwe.WriteErrors {
+		bulkErr.Errors = append(bulkErr.Errors, BulkOpError{Index: we.Index, Code: we.Code, Message: we.Message})
+	}
+	if bwe.WriteConcernError != nil {
+		bulkErr.Cause = bwe.WriteConcernError
+	}
+	return bulkErr
+}
+
+// models converts the queued operations to driver write models
+func (b *Bulk) models() []mongo.WriteModel {
+	models := make([]mongo.WriteModel, 0, len(b.ops))
+	for _, op := range b.ops {
+		filter := op.filter
+		if filter == nil && op.kind != bulkInsert {
+			filter = bson.D{}
+		}
+		switch op.kind {
+		case bulkInsert:
+			models = append(models, mongo.NewInsertOneModel().SetDocument(op.doc))
+		case bulkUpdateOne:
+			models = append(models, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(op.doc).SetUpsert(op.upsert))
+		case bulkUpdateMany:
+			models = append(models, mongo.NewUpdateManyModel().SetFilter(filter).SetUpdate(op.doc).SetUpsert(op.upsert))
+		case bulkReplaceOne:
+			models = append(models, mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(op.doc).SetUpsert(op.upsert))
+		case bulkDeleteOne:
+			models = append(models, mongo.NewDeleteOneModel().SetFilter(filter))
+		case bulkDeleteMany:
+			models = append(models, mongo.NewDeleteManyModel().SetFilter(filter))
+		}
+	}
+	return models
+}
+
+// BulkWrite runs the queued operations of b
+func (c *Collection) BulkWrite(b *Bulk) (*BulkResult, error) {
+	return c.BulkWriteCtx(context.TODO(), b)
+}
+
+// BulkWriteCtx
+func (c *Collection) BulkWriteCtx(ctx context.Context, b *Bulk) (*BulkResult, error) {
+	if b == nil || b.Len() == 0 {
+		return &BulkResult{}, ErrEmptyBulk
+	}
+
+	coll, op := c.resolve(ctx)
+	opt := options.BulkWrite().SetOrdered(b.ordered)
+	res, err := coll.BulkWrite(ctx, b.models(), op.bulkWrite(), opt)
+
+	result := &BulkResult{}
+	if res != nil {
+		result.InsertedCount = res.InsertedCount
+		result.MatchedCount = res.MatchedCount
+		result.ModifiedCount = res.ModifiedCount
+		result.DeletedCount = res.DeletedCount
+		result.UpsertedCount = res.UpsertedCount
+		result.UpsertedIDs = res.UpsertedIDs
+	}
+	if err == nil {
+		return result, nil
+	}
+
+	var bwe mongo.BulkWriteException
+	if !errors.As(err, &bwe) {
+		return result, err
+	}
+	return result, bulkError(bwe)
+}
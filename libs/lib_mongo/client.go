@@ -0,0 +1,240 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: 客户端连接配置
+
+package lib_mongo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+)
+
+// ClientConfig describes how to connect to a deployment. Either URI is a full
+// connection string or it is built from Host, the other non-zero fields
+// override the options of the connection string.
+type ClientConfig struct {
+	// 完整连接串，如mongodb+srv://cluster0.example.net/，设置后忽略Host和SRV
+	URI string `yaml:"URI"`
+	// host:port，副本集用逗号分隔
+	Host string `yaml:"Host"`
+	// 使用mongodb+srv://，Host为SRV记录域名
+	SRV    bool   `yaml:"SRV"`
+	User   string `yaml:"User"`
+	Passwd string `yaml:"Passwd"`
+	DbName string `yaml:"DbName"`
+	// 认证库，由Host连接时默认为DbName
+	AuthSource string `yaml:"AuthSource"`
+	// SCRAM-SHA-1/SCRAM-SHA-256/MONGODB-X509等，为空时与服务端协商
+	AuthMechanism    string    `yaml:"AuthMechanism"`
+	ReplicaSet       string    `yaml:"ReplicaSet"`
+	DirectConnection bool      `yaml:"DirectConnection"`
+	TLS              TLSConfig `yaml:"TLS"`
+	// primary/primaryPreferred/secondary/secondaryPreferred/nearest
+	ReadPreference string `yaml:"ReadPreference"`
+	// 从节点最大延迟(秒)，不能用于primary
+	MaxStaleness int `yaml:"MaxStaleness"`
+	// local/available/majority/linearizable/snapshot
+	ReadConcern string `yaml:"ReadConcern"`
+	// majority、节点数或tag名称
+	WriteConcern string `yaml:"WriteConcern"`
+	Journal      bool   `yaml:"Journal"`
+	AppName      string `yaml:"AppName"`
+	// snappy/zlib/zstd
+	Compressors []string `yaml:"Compressors"`
+	// 连接池大小
+	PoolLimit   uint64 `yaml:"PoolLimit"`
+	MinPoolSize uint64 `yaml:"MinPoolSize"`
+	// 以下超时单位为毫秒
+	ConnectTimeout         int `yaml:"ConnectTimeout"`
+	ServerSelectionTimeout int `yaml:"ServerSelectionTimeout"`
+	// 未设置deadline的操作的默认超时
+	Timeout         int `yaml:"Timeout"`
+	MaxConnIdleTime int `yaml:"MaxConnIdleTime"`
+}
+
+// TLSConfig enables TLS and x509 client certificates
+type TLSConfig struct {
+	Enable bool `yaml:"Enable"`
+	// CA证书(PEM)，为空时使用系统证书
+	CAFile string `yaml:"CAFile"`
+	// 客户端证书与私钥(PEM，可在同一文件)，x509认证时需要
+	CertFile string `yaml:"CertFile"`
+	KeyFile  string `yaml:"KeyFile"`
+	// 不校验服务端证书，仅用于测试
+	Insecure bool `yaml:"Insecure"`
+}
+
+// connectionString returns URI or the one built from Host, without credentials
+func (c ClientConfig) connectionString() string {
+	if c.URI != "" {
+		return c.URI
+	}
+	scheme := "mongodb://"
+	if c.SRV {
+		scheme = "mongodb+srv://"
+	}
+	return scheme + c.Host + "/" + c.DbName
+}
+
+// ClientOptions builds the driver options. The credentials are passed as
+// options.Credential instead of being formatted into the connection string,
+// so passwords with reserved characters such as '@', ':' or '/' need no escaping.
+func (c ClientConfig) ClientOptions() (*options.ClientOptions, error) {
+	opt := options.Client().ApplyURI(c.connectionString())
+	if err := opt.Validate(); err != nil {
+		return nil, err
+	}
+
+	if c.User != "" || c.AuthMechanism != "" {
+		var cred options.Credential
+		if opt.Auth != nil {
+			cred = *opt.Auth
+		} else if c.URI != "" {
+			// 连接串中没有用户名时driver不保留authSource等认证参数
+			cs, err := connstring.Parse(c.URI)
+			if err != nil {
+				return nil, err
+			}
+			cred.AuthSource = cs.AuthSource
+			cred.AuthMechanism = cs.AuthMechanism
+			cred.AuthMechanismProperties = cs.AuthMechanismProperties
+		}
+		if c.User != "" {
+			cred.Username = c.User
+			cred.Password = c.Passwd
+			cred.PasswordSet = c.Passwd != ""
+		}
+		if c.AuthMechanism != "" {
+			cred.AuthMechanism = c.AuthMechanism
+		}
+		if c.AuthSource != "" {
+			cred.AuthSource = c.AuthSource
+		} else if c.URI == "" {
+			// 与原先拼接的authSource=DbName一致
+			cred.AuthSource = c.DbName
+		}
+		opt.SetAuth(cred)
+	}
+	if c.ReplicaSet != "" {
+		opt.SetReplicaSet(c.ReplicaSet)
+	}
+	if c.DirectConnection {
+		opt.SetDirect(true)
+	}
+	if c.TLS.Enable {
+		cfg, err := c.TLS.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opt.SetTLSConfig(cfg)
+	}
+	if c.ReadPreference != "" {
+		rp, err := c.readPref()
+		if err != nil {
+			return nil, err
+		}
+		opt.SetReadPreference(rp)
+	}
+	if c.ReadConcern != "" {
+		opt.SetReadConcern(&readconcern.ReadConcern{Level: c.ReadConcern})
+	}
+	if c.WriteConcern != "" || c.Journal {
+		opt.SetWriteConcern(c.writeConcern())
+	}
+	if c.AppName != "" {
+		opt.SetAppName(c.AppName)
+	}
+	if len(c.Compressors) > 0 {
+		opt.SetCompressors(c.Compressors)
+	}
+	if c.PoolLimit > 0 {
+		opt.SetMaxPoolSize(c.PoolLimit)
+	}
+	if c.MinPoolSize > 0 {
+		opt.SetMinPoolSize(c.MinPoolSize)
+	}
+	if c.ConnectTimeout > 0 {
+		opt.SetConnectTimeout(time.Duration(c.ConnectTimeout) * time.Millisecond)
+	}
+	if c.ServerSelectionTimeout > 0 {
+		opt.SetServerSelectionTimeout(time.Duration(c.ServerSelectionTimeout) * time.Millisecond)
+	}
+	if c.Timeout > 0 {
+		opt.SetTimeout(time.Duration(c.Timeout) * time.Millisecond)
+	}
+	if c.MaxConnIdleTime > 0 {
+		opt.SetMaxConnIdleTime(time.Duration(c.MaxConnIdleTime) * time.Millisecond)
+	}
+	if err := opt.Validate(); err != nil {
+		return nil, err
+	}
+	return opt, nil
+}
+
+func (c ClientConfig) readPref() (*readpref.ReadPref, error) {
+	mode, err := readpref.ModeFromString(c.ReadPreference)
+	if err != nil {
+		return nil, err
+	}
+	if c.MaxStaleness > 0 {
+		return readpref.New(mode, readpref.WithMaxStaleness(time.Duration(c.MaxStaleness)*time.Second))
+	}
+	return readpref.New(mode)
+}
+
+func (c ClientConfig) writeConcern() *writeconcern.WriteConcern {
+	wc := &writeconcern.WriteConcern{}
+	switch {
+	case c.WriteConcern == "":
+	case strings.EqualFold(c.WriteConcern, "majority"):
+		wc.W = "majority"
+	default:
+		if n, err := strconv.Atoi(c.WriteConcern); err == nil {
+			wc.W = n
+		} else {
+			wc.W = c.WriteConcern
+		}
+	}
+	if c.Journal {
+		journal := true
+		wc.Journal = &journal
+	}
+	return wc
+}
+
+func (t TLSConfig) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: t.Insecure}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", t.CAFile)
+		}
+	}
+	if t.CertFile != "" {
+		keyFile := t.KeyFile
+		if keyFile == "" {
+			keyFile = t.CertFile
+		}
+		cert, err := tls.LoadX509KeyPair(t.CertFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
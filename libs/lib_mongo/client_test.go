@@ -0,0 +1,73 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc:
+
+package lib_mongo
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+func TestClientConfig(t *testing.T) {
+	Convey("test client config", t, func() {
+		Convey("credentials are not formatted into the uri", func() {
+			opt, err := ClientConfig{
+				Host:      "10.0.0.1:27017,10.0.0.2:27017",
+				User:      "user_adm",
+				Passwd:    "p@ss:w/rd%?#",
+				DbName:    "db_adm",
+				PoolLimit: 50,
+			}.ClientOptions()
+			So(err, ShouldBeNil)
+			So(opt.Hosts, ShouldResemble, []string{"10.0.0.1:27017", "10.0.0.2:27017"})
+			So(opt.Auth.Username, ShouldEqual, "user_adm")
+			So(opt.Auth.Password, ShouldEqual, "p@ss:w/rd%?#")
+			So(opt.Auth.AuthSource, ShouldEqual, "db_adm")
+			So(*opt.MaxPoolSize, ShouldEqual, 50)
+		})
+
+		Convey("config overrides the connection string", func() {
+			opt, err := ClientConfig{
+				URI:                    "mongodb://a:27017,b:27017/?replicaSet=rs0&authSource=admin&appName=old&maxPoolSize=20",
+				User:                   "u",
+				Passwd:                 "p",
+				AppName:                "myGin",
+				ReadPreference:         "secondaryPreferred",
+				MaxStaleness:           120,
+				ReadConcern:            "majority",
+				WriteConcern:           "2",
+				Journal:                true,
+				Compressors:            []string{"zstd", "snappy"},
+				ServerSelectionTimeout: 1500,
+			}.ClientOptions()
+			So(err, ShouldBeNil)
+			So(*opt.ReplicaSet, ShouldEqual, "rs0")
+			So(opt.Auth.AuthSource, ShouldEqual, "admin")
+			So(opt.Auth.Username, ShouldEqual, "u")
+			So(*opt.AppName, ShouldEqual, "myGin")
+			So(*opt.MaxPoolSize, ShouldEqual, 20)
+			So(opt.ReadPreference.Mode(), ShouldEqual, readpref.SecondaryPreferredMode)
+			staleness, ok := opt.ReadPreference.MaxStaleness()
+			So(ok, ShouldBeTrue)
+			So(staleness, ShouldEqual, 2*time.Minute)
+			So(opt.ReadConcern.Level, ShouldEqual, "majority")
+			So(opt.WriteConcern.W, ShouldEqual, 2)
+			So(*opt.WriteConcern.Journal, ShouldBeTrue)
+			So(opt.Compressors, ShouldResemble, []string{"zstd", "snappy"})
+			So(*opt.ServerSelectionTimeout, ShouldEqual, 1500*time.Millisecond)
+		})
+
+		Convey("invalid options are rejected", func() {
+			_, err := ClientConfig{Host: "localhost", ReadPreference: "fastest"}.ClientOptions()
+			So(err, ShouldNotBeNil)
+			_, err = ClientConfig{URI: "http://localhost"}.ClientOptions()
+			So(err, ShouldNotBeNil)
+			_, err = ClientConfig{Host: "localhost", TLS: TLSConfig{Enable: true, CAFile: "/nonexistent/ca.pem"}}.ClientOptions()
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
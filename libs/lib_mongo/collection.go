@@ -13,22 +13,42 @@ import (
 
 type Collection struct {
 	collection *mongo.Collection
+	// 读偏好、读写关注、collation等单次操作选项
+	op    OpOptions
+	guard *scanGuard
 }
 
 // Find
 func (c *Collection) Find(filter interface{}) *Session {
-	return &Session{filter: filter, collection: c.collection}
+	return &Session{filter: filter, collection: c.collection, op: c.op, guard: c.guard}
 }
 
 // Select
 func (c *Collection) Select(projection interface{}) *Session {
-	return &Session{project: projection, collection: c.collection}
+	return &Session{project: projection, collection: c.collection, op: c.op, guard: c.guard}
+}
+
+// Options returns a copy of the collection whose operations use opts,
+// they take precedence over the options set on the ctx with WithOptions
+func (c *Collection) Options(opts ...OpOption) *Collection {
+	return &Collection{collection: c.collection, op: c.op.apply(opts), guard: c.guard}
+}
+
+// resolve returns the driver collection and the options of an operation made with ctx
+func (c *Collection) resolve(ctx context.Context) (*mongo.Collection, OpOptions) {
+	return resolveOptions(ctx, c.collection, c.op)
 }
 
 // Insert
 func (c *Collection) Insert(document interface{}) error {
+	return c.InsertCtx(context.TODO(), document)
+}
+
+// InsertCtx
+func (c *Collection) InsertCtx(ctx context.Context, document interface{}) error {
+	coll, op := c.resolve(ctx)
 	var err error
-	if _, err = c.collection.InsertOne(context.TODO(), document); err != nil {
+	if _, err = coll.InsertOne(ctx, document, op.insertOne()); err != nil {
 		return err
 	}
 	return nil
@@ -36,14 +56,26 @@ func (c *Collection) Insert(document interface{}) error {
 
 // InsertWithResult
 func (c *Collection) InsertWithResult(document interface{}) (result *mongo.InsertOneResult, err error) {
-	result, err = c.collection.InsertOne(context.TODO(), document)
+	return c.InsertWithResultCtx(context.TODO(), document)
+}
+
+// InsertWithResultCtx
+func (c *Collection) InsertWithResultCtx(ctx context.Context, document interface{}) (result *mongo.InsertOneResult, err error) {
+	coll, op := c.resolve(ctx)
+	result, err = coll.InsertOne(ctx, document, op.insertOne())
 	return
 }
 
 // InsertAll
 func (c *Collection) InsertAll(documents ...interface{}) error {
+	return c.InsertAllCtx(context.TODO(), documents...)
+}
+
+// InsertAllCtx
+func (c *Collection) InsertAllCtx(ctx context.Context, documents ...interface{}) error {
+	coll, op := c.resolve(ctx)
 	var err error
-	if _, err = c.collection.InsertMany(context.TODO(), documents); err != nil {
+	if _, err = coll.InsertMany(ctx, documents, op.insertMany()); err != nil {
 		return err
 	}
 	return nil
@@ -51,12 +83,23 @@ func (c *Collection) InsertAll(documents ...interface{}) error {
 
 // InsertAllWithResult
 func (c *Collection) InsertAllWithResult(documents []interface{}) (result *mongo.InsertManyResult, err error) {
-	result, err = c.collection.InsertMany(context.TODO(), documents)
+	return c.InsertAllWithResultCtx(context.TODO(), documents)
+}
+
+// InsertAllWithResultCtx
+func (c *Collection) InsertAllWithResultCtx(ctx context.Context, documents []interface{}) (result *mongo.InsertManyResult, err error) {
+	coll, op := c.resolve(ctx)
+	result, err = coll.InsertMany(ctx, documents, op.insertMany())
 	return
 }
 
 // Update
 func (c *Collection) Update(selector interface{}, update interface{}, upsert ...bool) error {
+	return c.UpdateCtx(context.TODO(), selector, update, upsert...)
+}
+
+// UpdateCtx
+func (c *Collection) UpdateCtx(ctx context.Context, selector interface{}, update interface{}, upsert ...bool) error {
 	if selector == nil {
 		selector = bson.D{}
 	}
@@ -70,7 +113,8 @@ func (c *Collection) Update(selector interface{}, update interface{}, upsert ...
 		}
 	}
 
-	if _, err = c.collection.UpdateOne(context.TODO(), selector, update, opt); err != nil {
+	coll, op := c.resolve(ctx)
+	if _, err = coll.UpdateOne(ctx, selector, update, op.update(), opt); err != nil {
 		return err
 	}
 	return nil
@@ -78,6 +122,11 @@ func (c *Collection) Update(selector interface{}, update interface{}, upsert ...
 
 // UpdateWithResult
 func (c *Collection) UpdateWithResult(selector interface{}, update interface{}, upsert ...bool) (result *mongo.UpdateResult, err error) {
+	return c.UpdateWithResultCtx(context.TODO(), selector, update, upsert...)
+}
+
+// UpdateWithResultCtx
+func (c *Collection) UpdateWithResultCtx(ctx context.Context, selector interface{}, update interface{}, upsert ...bool) (result *mongo.UpdateResult, err error) {
 	if selector == nil {
 		selector = bson.D{}
 	}
@@ -89,17 +138,28 @@ func (c *Collection) UpdateWithResult(selector interface{}, update interface{},
 		}
 	}
 
-	result, err = c.collection.UpdateOne(context.TODO(), selector, update, opt)
+	coll, op := c.resolve(ctx)
+	result, err = coll.UpdateOne(ctx, selector, update, op.update(), opt)
 	return
 }
 
 // UpdateID
 func (c *Collection) UpdateID(id interface{}, update interface{}) error {
-	return c.Update(bson.M{"_id": id}, update)
+	return c.UpdateIDCtx(context.TODO(), id, update)
+}
+
+// UpdateIDCtx
+func (c *Collection) UpdateIDCtx(ctx context.Context, id interface{}, update interface{}) error {
+	return c.UpdateCtx(ctx, bson.M{"_id": id}, update)
 }
 
 // UpdateAll
 func (c *Collection) UpdateAll(selector interface{}, update interface{}, upsert ...bool) (*mongo.UpdateResult, error) {
+	return c.UpdateAllCtx(context.TODO(), selector, update, upsert...)
+}
+
+// UpdateAllCtx
+func (c *Collection) UpdateAllCtx(ctx context.Context, selector interface{}, update interface{}, upsert ...bool) (*mongo.UpdateResult, error) {
 	if selector == nil {
 		selector = bson.D{}
 	}
@@ -114,7 +174,8 @@ func (c *Collection) UpdateAll(selector interface{}, update interface{}, upsert
 	}
 
 	var updateResult *mongo.UpdateResult
-	if updateResult, err = c.collection.UpdateMany(context.TODO(), selector, update, opt); err != nil {
+	coll, op := c.resolve(ctx)
+	if updateResult, err = coll.UpdateMany(ctx, selector, update, op.update(), opt); err != nil {
 		return updateResult, err
 	}
 	return updateResult, nil
@@ -122,11 +183,17 @@ func (c *Collection) UpdateAll(selector interface{}, update interface{}, upsert
 
 // Remove
 func (c *Collection) Remove(selector interface{}) error {
+	return c.RemoveCtx(context.TODO(), selector)
+}
+
+// RemoveCtx
+func (c *Collection) RemoveCtx(ctx context.Context, selector interface{}) error {
 	if selector == nil {
 		selector = bson.D{}
 	}
+	coll, op := c.resolve(ctx)
 	var err error
-	if _, err = c.collection.DeleteOne(context.TODO(), selector); err != nil {
+	if _, err = coll.DeleteOne(ctx, selector, op.delete()); err != nil {
 		return err
 	}
 	return nil
@@ -134,17 +201,28 @@ func (c *Collection) Remove(selector interface{}) error {
 
 // RemoveID
 func (c *Collection) RemoveID(id interface{}) error {
-	return c.Remove(bson.M{"_id": id})
+	return c.RemoveIDCtx(context.TODO(), id)
+}
+
+// RemoveIDCtx
+func (c *Collection) RemoveIDCtx(ctx context.Context, id interface{}) error {
+	return c.RemoveCtx(ctx, bson.M{"_id": id})
 }
 
 // RemoveAll
 func (c *Collection) RemoveAll(selector interface{}) error {
+	return c.RemoveAllCtx(context.TODO(), selector)
+}
+
+// RemoveAllCtx
+func (c *Collection) RemoveAllCtx(ctx context.Context, selector interface{}) error {
 	if selector == nil {
 		selector = bson.D{}
 	}
+	coll, op := c.resolve(ctx)
 	var err error
 
-	if _, err = c.collection.DeleteMany(context.TODO(), selector); err != nil {
+	if _, err = coll.DeleteMany(ctx, selector, op.delete()); err != nil {
 		return err
 	}
 	return nil
@@ -152,22 +230,33 @@ func (c *Collection) RemoveAll(selector interface{}) error {
 
 // Count
 func (c *Collection) Count(selector interface{}) (int64, error) {
+	return c.CountCtx(context.TODO(), selector)
+}
+
+// CountCtx
+func (c *Collection) CountCtx(ctx context.Context, selector interface{}) (int64, error) {
 	if selector == nil {
 		selector = bson.D{}
 	}
 	var err error
 	var count int64
-	count, err = c.collection.CountDocuments(context.TODO(), selector)
+	coll, op := c.resolve(ctx)
+	count, err = coll.CountDocuments(ctx, selector, op.count())
 	return count, err
 }
 
 // FindAndAutoInc
 func (c *Collection) FindAndAutoInc(name string, filter, update interface{}) (int32, error) {
+	return c.FindAndAutoIncCtx(context.TODO(), name, filter, update)
+}
+
+// FindAndAutoIncCtx
+func (c *Collection) FindAndAutoIncCtx(ctx context.Context, name string, filter, update interface{}) (int32, error) {
 	opt := options.FindOneAndUpdateOptions{}
 	opt.SetUpsert(true)
 	opt.SetReturnDocument(options.After)
 
-	result := c.collection.FindOneAndUpdate(context.TODO(), filter, update, &opt)
+	result := c.collection.FindOneAndUpdate(ctx, filter, update, &opt)
 	if result.Err() != nil && result.Err() != mongo.ErrNoDocuments {
 		return -1, result.Err()
 	}
@@ -8,14 +8,15 @@ import "go.mongodb.org/mongo-driver/mongo"
 
 type Database struct {
 	database *mongo.Database
+	guard    *scanGuard
 }
 
 // returns collection
 func (d *Database) C(collection string) *Collection {
-	return &Collection{collection: d.database.Collection(collection)}
+	return &Collection{collection: d.database.Collection(collection), guard: d.guard}
 }
 
 // returns collection
 func (d *Database) Collection(collection string) *Collection {
-	return &Collection{collection: d.database.Collection(collection)}
+	return &Collection{collection: d.database.Collection(collection), guard: d.guard}
 }
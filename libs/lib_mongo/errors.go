@@ -0,0 +1,103 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: driver错误分类
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrTimeout = errors.New("operation timeout")
+	// 网络错误或主节点切换等可重试错误
+	ErrRetryable     = errors.New("retryable error")
+	ErrWriteConflict = errors.New("write conflict")
+	// 文档未通过集合的validator
+	ErrValidation = errors.New("document validation failure")
+)
+
+// Error is the error returned by lib_mongo operations. Kind is one of the
+// sentinel errors and can be tested with errors.Is, the driver error is kept in Err.
+//
+//	if errors.Is(err, lib_mongo.ErrIsDuplicate) {
+//		...
+//	}
+type Error struct {
+	Op         string
+	Collection string
+	Kind       error
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("lib_mongo: %s %s: %v", e.Op, e.Collection, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+// mongo server error codes
+const (
+	codeWriteConflict     = 112
+	codeValidationFailure = 121
+	codeNamespaceNotFound = 26
+)
+
+// 唯一索引冲突的错误码
+var duplicateKeyCodes = []int{11000, 11001, 12582}
+
+// 主节点切换/关闭相关的可重试错误码
+var retryableCodes = []int{6, 7, 89, 91, 189, 262, 9001, 10107, 11600, 11602, 13435, 13436}
+
+// classify maps a driver error to one of the sentinel errors, or nil
+func classify(err error) error {
+	var se mongo.ServerError
+	isServerErr := errors.As(err, &se)
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, mongo.ErrNoDocuments):
+		return ErrNotFound
+	case errors.Is(err, ErrIsDuplicate), mongo.IsDuplicateKeyError(err):
+		return ErrIsDuplicate
+	case errors.Is(err, ErrVersionConflict):
+		return ErrVersionConflict
+	case errors.Is(err, ErrWriteConflict), isServerErr && se.HasErrorCode(codeWriteConflict):
+		return ErrWriteConflict
+	case errors.Is(err, ErrValidation), isServerErr && se.HasErrorCode(codeValidationFailure):
+		return ErrValidation
+	case errors.Is(err, ErrTimeout), errors.Is(err, context.DeadlineExceeded), mongo.IsTimeout(err):
+		return ErrTimeout
+	case errors.Is(err, ErrRetryable), mongo.IsNetworkError(err):
+		return ErrRetryable
+	case isServerErr && (se.HasErrorLabel("RetryableWriteError") || se.HasErrorLabel("TransientTransactionError")):
+		return ErrRetryable
+	case isServerErr:
+		for _, code := range retryableCodes {
+			if se.HasErrorCode(code) {
+				return ErrRetryable
+			}
+		}
+	}
+	return nil
+}
+
+// wrapErr classifies err and records the operation and collection
+func wrapErr(op, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return &Error{Op: op, Collection: name, Kind: classify(err), Err: err}
+}
@@ -0,0 +1,74 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc:
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestErrorKind(t *testing.T) {
+	Convey("test error kind", t, func() {
+		kinds := []struct {
+			err  error
+			kind error
+		}{
+			{mongo.ErrNoDocuments, ErrNotFound},
+			{mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}, ErrIsDuplicate},
+			{mongo.CommandError{Code: 112, Name: "WriteConflict"}, ErrWriteConflict},
+			{mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 121}}}, ErrValidation},
+			{context.DeadlineExceeded, ErrTimeout},
+			{mongo.CommandError{Code: 10107, Name: "NotWritablePrimary"}, ErrRetryable},
+			{mongo.CommandError{Code: 2, Labels: []string{"RetryableWriteError"}}, ErrRetryable},
+			{errors.New("boom"), nil},
+		}
+		for _, k := range kinds {
+			So(classify(k.err), ShouldEqual, k.kind)
+		}
+
+		err := wrapErr("Insert", "profile", mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}})
+		So(errors.Is(err, ErrIsDuplicate), ShouldBeTrue)
+		So(mongo.IsDuplicateKeyError(err), ShouldBeTrue)
+		var e *Error
+		So(errors.As(fmt.Errorf("save: %w", err), &e), ShouldBeTrue)
+		So(e.Op, ShouldEqual, "Insert")
+		So(e.Collection, ShouldEqual, "profile")
+		So(wrapErr("Find", "other", err), ShouldEqual, err)
+		So(wrapErr("Find", "profile", nil), ShouldBeNil)
+	})
+
+	Convey("test namespace not found", t, func() {
+		notFound := mongo.CommandError{Code: 26, Name: "NamespaceNotFound"}
+		So(namespaceNotFound(notFound), ShouldBeTrue)
+		So(namespaceNotFound(fmt.Errorf("list indexes: %w", notFound)), ShouldBeTrue)
+		So(namespaceNotFound(wrapErr("SyncIndexes", "profile", notFound)), ShouldBeTrue)
+		So(namespaceNotFound(mongo.CommandError{Code: 13, Name: "Unauthorized"}), ShouldBeFalse)
+		So(namespaceNotFound(errors.New("boom")), ShouldBeFalse)
+	})
+
+	Convey("test bulk error kind", t, func() {
+		bwe := mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+			{WriteError: mongo.WriteError{Index: 1, Code: 11000, Message: "E11000 duplicate key error"}},
+		}}
+		err := wrapErr("BulkWrite", "profile", bulkError(bwe))
+		So(errors.Is(err, ErrIsDuplicate), ShouldBeTrue)
+		So(mongo.IsDuplicateKeyError(err), ShouldBeTrue)
+		So(errors.Is(err, ErrValidation), ShouldBeFalse)
+		var bulkErr *BulkError
+		So(errors.As(err, &bulkErr), ShouldBeTrue)
+		So(bulkErr.Errors[0].Index, ShouldEqual, 1)
+
+		bwe.WriteErrors[0].Code = 121
+		err = bulkError(bwe)
+		So(errors.Is(err, ErrValidation), ShouldBeTrue)
+		So(errors.Is(err, ErrIsDuplicate), ShouldBeFalse)
+		So(mongo.IsDuplicateKeyError(err), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,256 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: 查询计划(explain)及全表扫描检查
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// ErrCollScan is returned by guarded queries whose winning plan scans the whole collection
+var ErrCollScan = errors.New("collection scan")
+
+// explain命令的默认超时时间
+const defaultExplainTimeout = 5 * time.Second
+
+// ExplainResult is the queryPlanner output of a find
+type ExplainResult struct {
+	Namespace string
+	// 胜出计划的各阶段，由外到内，如FETCH、IXSCAN
+	Stages []string
+	// 胜出计划使用的索引
+	Indexes []string
+	// 原始的queryPlanner
+	Raw bson.Raw
+}
+
+// CollScan reports whether the winning plan scans the whole collection
+func (r *ExplainResult) CollScan() bool {
+	for _, stage := range r.Stages {
+		if stage == "COLLSCAN" {
+			return true
+		}
+	}
+	return false
+}
+
+// Explain returns the plan the server chooses for the query, nothing is read
+//
+//	plan, err := session.DB(db).C("order").Find(bson.M{"status": "paid"}).Sort(bson.M{"created_at": -1}).Explain(ctx)
+//	if err == nil && plan.CollScan() {
+//		...
+//	}
+func (s *Session) Explain(ctx context.Context) (*ExplainResult, error) {
+	coll, op := s.resolve(ctx)
+	filter := s.filter
+	if filter == nil {
+		filter = bson.D{}
+	}
+	find := bson.D{{Key: "find", Value: coll.Name()}, {Key: "filter", Value: filter}}
+	if s.sort != nil {
+		find = append(find, bson.E{Key: "sort", Value: s.sort})
+	}
+	if s.project != nil {
+		find = append(find, bson.E{Key: "projection", Value: s.project})
+	}
+	if s.skip != nil {
+		find = append(find, bson.E{Key: "skip", Value: *s.skip})
+	}
+	if s.limit != nil {
+		find = append(find, bson.E{Key: "limit", Value: *s.limit})
+	}
+	if op.Hint != nil {
+		find = append(find, bson.E{Key: "hint", Value: op.Hint})
+	}
+	if op.Collation != nil {
+		find = append(find, bson.E{Key: "collation", Value: op.Collation.ToDocument()})
+	}
+
+	cmd := bson.D{{Key: "explain", Value: find}, {Key: "verbosity", Value: "queryPlanner"}}
+	raw, err := coll.Database().RunCommand(ctx, cmd).Raw()
+	if err != nil {
+		return nil, err
+	}
+	planner, ok := raw.Lookup("queryPlanner").DocumentOK()
+	if !ok {
+		return nil, fmt.Errorf("explain %s: no queryPlanner in %s", coll.Name(), raw)
+	}
+	return parsePlanner(planner), nil
+}
+
+func parsePlanner(planner bson.Raw) *ExplainResult {
+	r := &ExplainResult{Raw: planner}
+	r.Namespace, _ = planner.Lookup("namespace").StringValueOK()
+	if plan, ok := planner.Lookup("winningPlan").DocumentOK(); ok {
+		r.walk(plan)
+	}
+	return r
+}
+
+// walk 遍历计划树：inputStage/inputStages为子阶段，7.0+的SBE计划在queryPlan中，分片集群在shards中
+func (r *ExplainResult) walk(plan bson.Raw) {
+	if stage, ok := plan.Lookup("stage").StringValueOK(); ok {
+		r.Stages = append(r.Stages, stage)
+	}
+	if index, ok := plan.Lookup("indexName").StringValueOK(); ok {
+		r.Indexes = append(r.Indexes, index)
+	}
+	for _, key := range []string{"queryPlan", "inputStage", "winningPlan"} {
+		if child, ok := plan.Lookup(key).DocumentOK(); ok {
+			r.walk(child)
+		}
+	}
+	for _, key := range []string{"inputStages", "shards"} {
+		children, ok := plan.Lookup(key).ArrayOK()
+		if !ok {
+			continue
+		}
+		values, _ := children.Values()
+		for _, v := range values {
+			if child, ok := v.DocumentOK(); ok {
+				r.walk(child)
+			}
+		}
+	}
+}
+
+// ScanGuardOptions explains each query shape on first use and reports the ones
+// whose winning plan is a COLLSCAN, meant for development and tests
+type ScanGuardOptions struct {
+	// 数据量大的集合，为空时检查所有集合
+	Collections []string
+	// 命中全表扫描时查询返回ErrCollScan，用于测试中使其失败
+	Fail bool
+	// 每种查询形状只回调一次
+	OnCollScan func(CollScan)
+}
+
+// CollScan describes a query that scans the whole collection
+type CollScan struct {
+	Namespace string
+	// 过滤条件与排序的字段及操作符，不含具体的值，可直接写入日志
+	Shape string
+	Plan  *ExplainResult
+}
+
+type scanGuard struct {
+	opt   ScanGuardOptions
+	large map[string]bool
+	m     sync.Mutex
+	// 查询形状 -> 是否全表扫描
+	seen    map[string]bool
+	explain func(s *Session) (*ExplainResult, error)
+}
+
+func newScanGuard(opt ScanGuardOptions) *scanGuard {
+	g := &scanGuard{opt: opt, large: map[string]bool{}, seen: map[string]bool{}}
+	for _, name := range opt.Collections {
+		g.large[name] = true
+	}
+	g.explain = func(s *Session) (*ExplainResult, error) {
+		// 不使用调用方的ctx：事务中不能explain
+		ctx, cancel := context.WithTimeout(context.Background(), defaultExplainTimeout)
+		defer cancel()
+		return s.Explain(ctx)
+	}
+	return g
+}
+
+// check explains the query of s with the options resolved from ctx the first time
+// its shape is seen. Explain errors let the query run and are retried next time.
+func (g *scanGuard) check(ctx context.Context, s *Session) error {
+	if g == nil || s.collection == nil {
+		return nil
+	}
+	name := s.collection.Name()
+	if len(g.large) > 0 && !g.large[name] {
+		return nil
+	}
+	ns := s.collection.Database().Name() + "." + name
+	_, op := s.resolve(ctx)
+	shape := s.shape(op)
+	key := ns + " " + shape
+
+	g.m.Lock()
+	scan, ok := g.seen[key]
+	g.m.Unlock()
+	if !ok {
+		// explain不使用调用方的ctx，选项已合并到查询上
+		q := &Session{collection: s.collection, filter: s.filter, sort: s.sort, project: s.project, skip: s.skip, limit: s.limit, op: op}
+		plan, err := g.explain(q)
+		if err != nil {
+			return nil
+		}
+		scan = plan.CollScan()
+		g.m.Lock()
+		g.seen[key] = scan
+		g.m.Unlock()
+		if scan && g.opt.OnCollScan != nil {
+			g.opt.OnCollScan(CollScan{Namespace: ns, Shape: shape, Plan: plan})
+		}
+	}
+	if scan && g.opt.Fail {
+		return fmt.Errorf("%w: %s", ErrCollScan, key)
+	}
+	return nil
+}
+
+// shape 查询形状：过滤条件与排序的字段及操作符，忽略具体的值；索引提示与排序规则会改变计划
+func (s *Session) shape(op OpOptions) string {
+	shape := "filter:" + valueShape(s.filter)
+	if s.sort != nil {
+		shape += " sort:" + valueShape(s.sort)
+	}
+	if op.Hint != nil {
+		shape += " hint:" + fmt.Sprint(op.Hint)
+	}
+	if op.Collation != nil {
+		shape += " collation:" + fmt.Sprint(op.Collation.ToDocument())
+	}
+	return shape
+}
+
+func valueShape(v interface{}) string {
+	if v == nil {
+		return "{}"
+	}
+	t, data, err := bson.MarshalValue(v)
+	if err != nil {
+		return fmt.Sprintf("%T", v)
+	}
+	return rawShape(bson.RawValue{Type: t, Value: data})
+}
+
+func rawShape(v bson.RawValue) string {
+	switch v.Type {
+	case bsontype.EmbeddedDocument:
+		elems, _ := v.Document().Elements()
+		fields := make([]string, 0, len(elems))
+		for _, e := range elems {
+			fields = append(fields, e.Key()+":"+rawShape(e.Value()))
+		}
+		sort.Strings(fields)
+		return "{" + strings.Join(fields, ",") + "}"
+	case bsontype.Array:
+		values, _ := v.Array().Values()
+		var items []string
+		for _, item := range values {
+			// $in等数组中的值不影响计划，$and/$or中的子条件保留
+			if item.Type == bsontype.EmbeddedDocument {
+				items = append(items, rawShape(item))
+			}
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	}
+	return "?"
+}
@@ -0,0 +1,132 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc:
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestExplain(t *testing.T) {
+	planner := func(winningPlan bson.M) bson.Raw {
+		raw, err := bson.Marshal(bson.M{"namespace": "test.order", "winningPlan": winningPlan})
+		So(err, ShouldBeNil)
+		return raw
+	}
+
+	Convey("test explain plan", t, func() {
+		r := parsePlanner(planner(bson.M{
+			"stage":      "FETCH",
+			"inputStage": bson.M{"stage": "IXSCAN", "indexName": "status_1"},
+		}))
+		So(r.Namespace, ShouldEqual, "test.order")
+		So(r.Stages, ShouldResemble, []string{"FETCH", "IXSCAN"})
+		So(r.Indexes, ShouldResemble, []string{"status_1"})
+		So(r.CollScan(), ShouldBeFalse)
+
+		// 7.0+ SBE
+		r = parsePlanner(planner(bson.M{
+			"queryPlan":     bson.M{"stage": "SORT", "inputStage": bson.M{"stage": "COLLSCAN"}},
+			"slotBasedPlan": bson.M{"stages": "..."},
+		}))
+		So(r.Stages, ShouldResemble, []string{"SORT", "COLLSCAN"})
+		So(r.CollScan(), ShouldBeTrue)
+
+		// 分片集群
+		r = parsePlanner(planner(bson.M{
+			"stage": "SHARD_MERGE",
+			"shards": bson.A{
+				bson.M{"shardName": "rs0", "winningPlan": bson.M{"stage": "IXSCAN", "indexName": "_id_"}},
+				bson.M{"shardName": "rs1", "winningPlan": bson.M{"stage": "OR", "inputStages": bson.A{
+					bson.M{"stage": "IXSCAN", "indexName": "_id_"},
+					bson.M{"stage": "COLLSCAN"},
+				}}},
+			},
+		}))
+		So(r.Stages, ShouldResemble, []string{"SHARD_MERGE", "IXSCAN", "OR", "IXSCAN", "COLLSCAN"})
+		So(r.CollScan(), ShouldBeTrue)
+	})
+
+	Convey("test query shape", t, func() {
+		shape := func(filter interface{}) string {
+			return (&Session{filter: filter}).shape(OpOptions{})
+		}
+		So(shape(bson.M{"status": "paid", "amount": bson.M{"$gt": 10}}), ShouldEqual,
+			shape(bson.D{{Key: "amount", Value: bson.M{"$gt": 99}}, {Key: "status", Value: "new"}}))
+		So(shape(bson.M{"_id": bson.M{"$in": bson.A{1, 2}}}), ShouldEqual, shape(bson.M{"_id": bson.M{"$in": bson.A{3}}}))
+		So(shape(bson.M{"$or": bson.A{bson.M{"a": 1}, bson.M{"b": 1}}}), ShouldNotEqual, shape(bson.M{"$or": bson.A{bson.M{"a": 1}}}))
+		So(shape(bson.M{"phone": "13800000000"}), ShouldNotContainSubstring, "138")
+		So(shape(nil), ShouldEqual, "filter:{}")
+	})
+
+	Convey("test scan guard", t, func() {
+		client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://127.0.0.1:27017"))
+		So(err, ShouldBeNil)
+		s := &Session{client: client, db: "test"}
+
+		var scans []CollScan
+		explained := 0
+		s.SetScanGuard(ScanGuardOptions{
+			Collections: []string{"order"},
+			Fail:        true,
+			OnCollScan:  func(scan CollScan) { scans = append(scans, scan) },
+		})
+		s.guard.explain = func(q *Session) (*ExplainResult, error) {
+			explained++
+			if q.filter == nil {
+				return nil, errors.New("not authorized")
+			}
+			if _, ok := q.filter.(bson.M)["status"]; ok && q.op.Hint == nil && q.op.Collation == nil {
+				return &ExplainResult{Stages: []string{"COLLSCAN"}}, nil
+			}
+			return &ExplainResult{Stages: []string{"FETCH", "IXSCAN"}}, nil
+		}
+		guard := s.C("order").guard
+
+		ctx := context.Background()
+		err = guard.check(ctx, s.C("order").Find(bson.M{"status": "paid"}))
+		So(errors.Is(err, ErrCollScan), ShouldBeTrue)
+		err = guard.check(ctx, s.C("order").Options(Comment("report")).Find(bson.M{"status": "new"}).Limit(10))
+		So(errors.Is(err, ErrCollScan), ShouldBeTrue)
+		So(explained, ShouldEqual, 1)
+		So(len(scans), ShouldEqual, 1)
+		So(scans[0].Namespace, ShouldEqual, "test.order")
+		So(scans[0].Shape, ShouldEqual, "filter:{status:?}")
+
+		So(guard.check(ctx, s.C("order").Find(bson.M{"_id": 1})), ShouldBeNil)
+		So(guard.check(ctx, s.C("profile").Find(bson.M{"status": "paid"})), ShouldBeNil)
+		So(explained, ShouldEqual, 2)
+
+		// explain失败不缓存，下次重新检查
+		So(guard.check(ctx, s.C("order").Find(nil)), ShouldBeNil)
+		So(guard.check(ctx, s.C("order").Find(nil)), ShouldBeNil)
+		So(explained, ShouldEqual, 4)
+
+		// 索引提示与ctx上的排序规则属于查询形状，并用于explain
+		var hinted *Session
+		explain := s.guard.explain
+		s.guard.explain = func(q *Session) (*ExplainResult, error) {
+			hinted = q
+			return explain(q)
+		}
+		hint := withOpOptions(ctx, OpOptions{Hint: "status_1"})
+		So(guard.check(hint, s.C("order").Find(bson.M{"status": "paid"})), ShouldBeNil)
+		So(hinted.op.Hint, ShouldEqual, "status_1")
+		collation := WithOptions(ctx, Collation(&options.Collation{Locale: "zh"}))
+		So(guard.check(collation, s.C("order").Find(bson.M{"status": "paid"})), ShouldBeNil)
+		So(hinted.op.Collation.Locale, ShouldEqual, "zh")
+		So(explained, ShouldEqual, 6)
+		So(len(scans), ShouldEqual, 1)
+
+		var none *scanGuard
+		So(none.check(ctx, s.C("order").Find(bson.M{"status": "paid"})), ShouldBeNil)
+	})
+}
@@ -0,0 +1,134 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: 原子的查找并修改(findAndModify)
+
+package lib_mongo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindAndModifyOptions controls FindOneAndUpdate, FindOneAndReplace and FindOneAndDelete
+type FindAndModifyOptions struct {
+	// 多个文档匹配时按该顺序取第一个
+	Sort       interface{}
+	Projection interface{}
+	// 没有匹配的文档时插入，FindOneAndDelete忽略
+	Upsert bool
+	// 返回修改后的文档，默认返回修改前的文档，FindOneAndDelete忽略
+	ReturnNew bool
+}
+
+func (opt FindAndModifyOptions) returnDocument() options.ReturnDocument {
+	if opt.ReturnNew {
+		return options.After
+	}
+	return options.Before
+}
+
+func filterOrAll(filter interface{}) interface{} {
+	if filter == nil {
+		return bson.D{}
+	}
+	return filter
+}
+
+// FindOneAndUpdate applies the update operators to the first matching document
+// and decodes it into result, it returns mongo.ErrNoDocuments when nothing is returned
+func (c *Collection) FindOneAndUpdate(filter, update interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return c.FindOneAndUpdateCtx(context.TODO(), filter, update, opt, result)
+}
+
+// FindOneAndUpdateCtx
+func (c *Collection) FindOneAndUpdateCtx(ctx context.Context, filter, update interface{}, opt FindAndModifyOptions, result interface{}) error {
+	o := options.FindOneAndUpdate().SetUpsert(opt.Upsert).SetReturnDocument(opt.returnDocument())
+	if opt.Sort != nil {
+		o.SetSort(opt.Sort)
+	}
+	if opt.Projection != nil {
+		o.SetProjection(opt.Projection)
+	}
+	coll, op := c.resolve(ctx)
+	return coll.FindOneAndUpdate(ctx, filterOrAll(filter), update, op.findOneAndUpdate(), o).Decode(result)
+}
+
+// FindOneAndReplace replaces the first matching document and decodes it into result
+func (c *Collection) FindOneAndReplace(filter, replacement interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return c.FindOneAndReplaceCtx(context.TODO(), filter, replacement, opt, result)
+}
+
+// FindOneAndReplaceCtx
+func (c *Collection) FindOneAndReplaceCtx(ctx context.Context, filter, replacement interface{}, opt FindAndModifyOptions, result interface{}) error {
+	o := options.FindOneAndReplace().SetUpsert(opt.Upsert).SetReturnDocument(opt.returnDocument())
+	if opt.Sort != nil {
+		o.SetSort(opt.Sort)
+	}
+	if opt.Projection != nil {
+		o.SetProjection(opt.Projection)
+	}
+	coll, op := c.resolve(ctx)
+	return coll.FindOneAndReplace(ctx, filterOrAll(filter), replacement, op.findOneAndReplace(), o).Decode(result)
+}
+
+// FindOneAndDelete deletes the first matching document and decodes it into result
+func (c *Collection) FindOneAndDelete(filter interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return c.FindOneAndDeleteCtx(context.TODO(), filter, opt, result)
+}
+
+// FindOneAndDeleteCtx
+func (c *Collection) FindOneAndDeleteCtx(ctx context.Context, filter interface{}, opt FindAndModifyOptions, result interface{}) error {
+	o := options.FindOneAndDelete()
+	if opt.Sort != nil {
+		o.SetSort(opt.Sort)
+	}
+	if opt.Projection != nil {
+		o.SetProjection(opt.Projection)
+	}
+	coll, op := c.resolve(ctx)
+	return coll.FindOneAndDelete(ctx, filterOrAll(filter), op.findOneAndDelete(), o).Decode(result)
+}
+
+// 原子的查找并更新，update为$set/$inc等原始操作符
+//
+//	// 领取一个待处理任务
+//	var job Job
+//	err := env.MongoCli.FindOneAndUpdate("jobs", bson.M{"status": "pending"},
+//		bson.M{"$set": bson.M{"status": "running", "worker": id}},
+//		lib_mongo.FindAndModifyOptions{Sort: bson.D{{Key: "created_at", Value: 1}}, ReturnNew: true}, &job)
+//	if errors.Is(err, lib_mongo.ErrNotFound) {
+//		// 没有待处理任务
+//	}
+func (ms *MongoSession) FindOneAndUpdate(name string, filter, update interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return ms.FindOneAndUpdateCtx(context.TODO(), name, filter, update, opt, result)
+}
+
+func (ms *MongoSession) FindOneAndUpdateCtx(ctx context.Context, name string, filter, update interface{}, opt FindAndModifyOptions, result interface{}) error {
+	ctx = ms.bindCtx(ctx)
+	err := ms.session.DB(ms.dbName).C(name).FindOneAndUpdateCtx(ctx, filter, update, opt, result)
+	return wrapErr("FindOneAndUpdate", name, err)
+}
+
+// 原子的查找并替换
+func (ms *MongoSession) FindOneAndReplace(name string, filter, replacement interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return ms.FindOneAndReplaceCtx(context.TODO(), name, filter, replacement, opt, result)
+}
+
+func (ms *MongoSession) FindOneAndReplaceCtx(ctx context.Context, name string, filter, replacement interface{}, opt FindAndModifyOptions, result interface{}) error {
+	ctx = ms.bindCtx(ctx)
+	err := ms.session.DB(ms.dbName).C(name).FindOneAndReplaceCtx(ctx, filter, replacement, opt, result)
+	return wrapErr("FindOneAndReplace", name, err)
+}
+
+// 原子的查找并删除，result为删除前的文档
+func (ms *MongoSession) FindOneAndDelete(name string, filter interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return ms.FindOneAndDeleteCtx(context.TODO(), name, filter, opt, result)
+}
+
+func (ms *MongoSession) FindOneAndDeleteCtx(ctx context.Context, name string, filter interface{}, opt FindAndModifyOptions, result interface{}) error {
+	ctx = ms.bindCtx(ctx)
+	err := ms.session.DB(ms.dbName).C(name).FindOneAndDeleteCtx(ctx, filter, opt, result)
+	return wrapErr("FindOneAndDelete", name, err)
+}
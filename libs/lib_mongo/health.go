@@ -0,0 +1,203 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: 健康检查与拓扑状态
+
+package lib_mongo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/description"
+)
+
+type HealthStatus string
+
+const (
+	// 未开启健康检查或尚未检查
+	HealthUnknown HealthStatus = "unknown"
+	HealthUp      HealthStatus = "up"
+	// 主节点不可达但仍有节点可读，或部分节点不可达
+	HealthDegraded HealthStatus = "degraded"
+	HealthDown     HealthStatus = "down"
+)
+
+const (
+	defaultHealthInterval = 10 * time.Second
+	defaultHealthTimeout  = 2 * time.Second
+)
+
+// ServerHealth is the state of one server as seen by the driver
+type ServerHealth struct {
+	Addr string
+	// RSPrimary/RSSecondary/Standalone/Mongos/Unknown等，Unknown表示不可达
+	Kind string
+	RTT  time.Duration
+	Err  string
+}
+
+func (s ServerHealth) reachable() bool {
+	return s.Kind != description.ServerKind(description.Unknown).String()
+}
+
+// Health is a snapshot of the deployment health
+type Health struct {
+	Status HealthStatus
+	// 可写节点(主节点/单机/mongos)是否可达
+	Writable bool
+	Servers  []ServerHealth
+	// 最近一次ping的耗时
+	Latency   time.Duration
+	CheckedAt time.Time
+	// 最近一次ping的错误
+	Err string
+}
+
+// HealthOptions configures the background health check
+type HealthOptions struct {
+	// 默认10秒
+	Interval time.Duration
+	// 单次ping超时，默认2秒
+	Timeout time.Duration
+	// Status变化时回调
+	OnChange func(prev, cur Health)
+}
+
+// healthMonitor pings the deployment periodically and tracks the topology
+type healthMonitor struct {
+	opt  HealthOptions
+	ping func(ctx context.Context) error
+
+	m       sync.RWMutex
+	health  Health
+	servers []ServerHealth
+
+	// 首次ping成功时关闭
+	ready     chan struct{}
+	readyOnce sync.Once
+	stop      chan struct{}
+	stopOnce  sync.Once
+	done      chan struct{}
+}
+
+func newHealthMonitor(opt HealthOptions, ping func(ctx context.Context) error) *healthMonitor {
+	if opt.Interval <= 0 {
+		opt.Interval = defaultHealthInterval
+	}
+	if opt.Timeout <= 0 {
+		opt.Timeout = defaultHealthTimeout
+	}
+	return &healthMonitor{
+		opt:    opt,
+		ping:   ping,
+		health: Health{Status: HealthUnknown},
+		ready:  make(chan struct{}),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+func (h *healthMonitor) serverMonitor() *event.ServerMonitor {
+	return &event.ServerMonitor{TopologyDescriptionChanged: h.topologyChanged}
+}
+
+// topologyChanged is called with the topology locked, it must not run operations
+func (h *healthMonitor) topologyChanged(ev *event.TopologyDescriptionChangedEvent) {
+	servers := make([]ServerHealth, 0, len(ev.NewDescription.Servers))
+	for _, s := range ev.NewDescription.Servers {
+		server := ServerHealth{Addr: s.Addr.String(), Kind: s.Kind.String(), RTT: s.AverageRTT}
+		if s.LastError != nil {
+			server.Err = s.LastError.Error()
+		}
+		servers = append(servers, server)
+	}
+	h.m.Lock()
+	h.servers = servers
+	h.m.Unlock()
+}
+
+func (h *healthMonitor) run() {
+	defer close(h.done)
+	ticker := time.NewTicker(h.opt.Interval)
+	defer ticker.Stop()
+	for {
+		h.check()
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check pings once and updates the health
+func (h *healthMonitor) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), h.opt.Timeout)
+	start := time.Now()
+	err := h.ping(ctx)
+	latency := time.Since(start)
+	cancel()
+
+	h.m.Lock()
+	prev := h.health
+	cur := evaluateHealth(err, latency, append([]ServerHealth(nil), h.servers...))
+	h.health = cur
+	h.m.Unlock()
+
+	if err == nil {
+		h.readyOnce.Do(func() { close(h.ready) })
+	}
+	if prev.Status != cur.Status && h.opt.OnChange != nil {
+		h.opt.OnChange(prev, cur)
+	}
+}
+
+// evaluateHealth derives the status from the ping result and the topology
+func evaluateHealth(pingErr error, latency time.Duration, servers []ServerHealth) Health {
+	health := Health{Servers: servers, Latency: latency, CheckedAt: time.Now()}
+	reachable := 0
+	for _, s := range servers {
+		if s.reachable() {
+			reachable++
+		}
+	}
+	switch {
+	case pingErr == nil && reachable == len(servers):
+		health.Status = HealthUp
+		health.Writable = true
+	case pingErr == nil:
+		health.Status = HealthDegraded
+		health.Writable = true
+	case reachable > 0:
+		health.Status = HealthDegraded
+	default:
+		health.Status = HealthDown
+	}
+	if pingErr != nil {
+		health.Err = pingErr.Error()
+	}
+	return health
+}
+
+func (h *healthMonitor) get() Health {
+	h.m.RLock()
+	defer h.m.RUnlock()
+	return h.health
+}
+
+// wait blocks until a ping succeeds
+func (h *healthMonitor) wait(ctx context.Context) error {
+	select {
+	case <-h.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *healthMonitor) close() {
+	h.stopOnce.Do(func() { close(h.stop) })
+	<-h.done
+}
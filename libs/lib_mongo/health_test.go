@@ -0,0 +1,100 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc:
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/address"
+	"go.mongodb.org/mongo-driver/mongo/description"
+)
+
+func TestHealth(t *testing.T) {
+	topology := func(kinds ...description.ServerKind) *event.TopologyDescriptionChangedEvent {
+		ev := &event.TopologyDescriptionChangedEvent{}
+		for i, kind := range kinds {
+			ev.NewDescription.Servers = append(ev.NewDescription.Servers, description.Server{
+				Addr: address.Address("10.0.0." + string(rune('1'+i)) + ":27017"),
+				Kind: kind,
+			})
+		}
+		return ev
+	}
+
+	Convey("test health", t, func() {
+		var m sync.Mutex
+		var pingErr error
+		var changes []HealthStatus
+		h := newHealthMonitor(HealthOptions{
+			Interval: time.Hour,
+			OnChange: func(prev, cur Health) {
+				changes = append(changes, cur.Status)
+			},
+		}, func(ctx context.Context) error {
+			m.Lock()
+			defer m.Unlock()
+			return pingErr
+		})
+		setPing := func(err error) {
+			m.Lock()
+			pingErr = err
+			m.Unlock()
+		}
+		So(h.get().Status, ShouldEqual, HealthUnknown)
+
+		setPing(errors.New("server selection timeout"))
+		h.topologyChanged(topology(description.Unknown, description.Unknown))
+		h.check()
+		So(h.get().Status, ShouldEqual, HealthDown)
+		So(h.get().Err, ShouldNotBeEmpty)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		So(h.wait(ctx), ShouldNotBeNil)
+		cancel()
+
+		h.topologyChanged(topology(description.RSSecondary, description.Unknown))
+		h.check()
+		So(h.get().Status, ShouldEqual, HealthDegraded)
+		So(h.get().Writable, ShouldBeFalse)
+
+		setPing(nil)
+		h.topologyChanged(topology(description.RSSecondary, description.RSPrimary))
+		h.check()
+		health := h.get()
+		So(health.Status, ShouldEqual, HealthUp)
+		So(health.Writable, ShouldBeTrue)
+		So(len(health.Servers), ShouldEqual, 2)
+		So(health.Servers[1].Kind, ShouldEqual, "RSPrimary")
+		So(h.wait(context.Background()), ShouldBeNil)
+
+		h.check()
+		So(changes, ShouldResemble, []HealthStatus{HealthDown, HealthDegraded, HealthUp})
+
+		Convey("run checks until closed", func() {
+			go h.run()
+			h.close()
+			h.close()
+		})
+	})
+
+	Convey("test memory health", t, func() {
+		var db DBAdaptor = NewMemorySession()
+		So(db.Health().Status, ShouldEqual, HealthUp)
+		So(NewMongoSession().Health().Status, ShouldEqual, HealthUnknown)
+
+		ms := &MongoSession{session: New("mongodb://127.0.0.1:27017")}
+		ms.MarkDown(errors.New("schema not initialized"))
+		So(ms.Health().Status, ShouldEqual, HealthDown)
+		So(ms.Health().Err, ShouldEqual, "schema not initialized")
+		ms.MarkDown(nil)
+		So(ms.Health().Status, ShouldEqual, HealthUnknown)
+	})
+}
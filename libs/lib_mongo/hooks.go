@@ -0,0 +1,549 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: 文档钩子，插入/更新/删除前后回调，内置时间戳钩子
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 注册到所有集合的钩子
+const AllCollections = "*"
+
+// ErrAfterHook wraps the error of an After hook, the write itself was applied
+var ErrAfterHook = errors.New("lib_mongo: after hook failed, the write was applied")
+
+const (
+	CreatedAtField = "created_at"
+	UpdatedAtField = "updated_at"
+)
+
+// UpdateEvent is the update passed to BeforeUpdate, hooks may modify Update
+type UpdateEvent struct {
+	Collection string
+	Filter     interface{}
+	// 更新操作符文档，Update/UpdateById的字段已包装在$set中
+	Update bson.M
+	Multi  bool
+	Upsert bool
+}
+
+// Hooks are the callbacks of a collection, any of them may be nil.
+// An error of a Before hook aborts the operation.
+type Hooks struct {
+	// doc可以修改，_id在调用前已分配
+	BeforeInsert func(ctx context.Context, name string, doc bson.M) error
+	AfterInsert  func(ctx context.Context, name string, doc bson.M) error
+	BeforeUpdate func(ctx context.Context, ev *UpdateEvent) error
+	AfterDelete  func(ctx context.Context, name string, filter interface{}) error
+}
+
+var hookRegistry = struct {
+	sync.Mutex
+	hooks map[string][]Hooks
+}{hooks: map[string][]Hooks{}}
+
+// RegisterHooks registers hooks of the collection name, or of every collection
+// with AllCollections, for the HookDBs created afterwards. Usually from an init function.
+func RegisterHooks(name string, hooks Hooks) {
+	hookRegistry.Lock()
+	hookRegistry.hooks[name] = append(hookRegistry.hooks[name], hooks)
+	hookRegistry.Unlock()
+}
+
+// TimestampHooks fills created_at on insert and upsert and updated_at on every write
+func TimestampHooks() Hooks {
+	return Hooks{
+		BeforeInsert: func(ctx context.Context, name string, doc bson.M) error {
+			now := time.Now()
+			if isZeroTime(doc[CreatedAtField]) {
+				doc[CreatedAtField] = now
+			}
+			if isZeroTime(doc[UpdatedAtField]) {
+				doc[UpdatedAtField] = now
+			}
+			return nil
+		},
+		BeforeUpdate: func(ctx context.Context, ev *UpdateEvent) error {
+			now := time.Now()
+			set, err := operatorFields(ev.Update, "$set")
+			if err != nil {
+				return err
+			}
+			set[UpdatedAtField] = now
+			if ev.Upsert {
+				if _, ok := set[CreatedAtField]; !ok {
+					setOnInsert, err := operatorFields(ev.Update, "$setOnInsert")
+					if err != nil {
+						return err
+					}
+					if _, ok = setOnInsert[CreatedAtField]; !ok {
+						setOnInsert[CreatedAtField] = now
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// operatorFields returns the fields of the update operator op, adding it when missing
+func operatorFields(update bson.M, op string) (bson.M, error) {
+	if update[op] == nil {
+		fields := bson.M{}
+		update[op] = fields
+		return fields, nil
+	}
+	fields, err := toM(update[op])
+	if err != nil {
+		return nil, err
+	}
+	update[op] = fields
+	return fields, nil
+}
+
+func isZeroTime(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return true
+	case time.Time:
+		return t.IsZero()
+	case primitive.DateTime:
+		return t.Time().IsZero()
+	}
+	return false
+}
+
+// HookDB wraps a DBAdaptor and runs the hooks of the collections around
+// Insert*, Update*, FindOneAndUpdate, FindOneAndReplace, Remove*, FindOneAndDelete
+// and each operation of BulkWrite. Replacements go through BeforeUpdate as a $set
+// of the whole document. After hooks of a bulk only run when the whole bulk succeeded.
+// Errors of After hooks are wrapped in ErrAfterHook.
+//
+//	db := lib_mongo.NewHookDB(mongoCli).Register(lib_mongo.AllCollections, lib_mongo.TimestampHooks())
+type HookDB struct {
+	DBAdaptor
+	hooks map[string][]Hooks
+}
+
+// NewHookDB returns db with the hooks registered with RegisterHooks
+func NewHookDB(db DBAdaptor) *HookDB {
+	h := &HookDB{DBAdaptor: db, hooks: map[string][]Hooks{}}
+	hookRegistry.Lock()
+	for name, hooks := range hookRegistry.hooks {
+		h.hooks[name] = append([]Hooks(nil), hooks...)
+	}
+	hookRegistry.Unlock()
+	return h
+}
+
+// Register adds hooks of the collection name, or of every collection with AllCollections
+func (h *HookDB) Register(name string, hooks Hooks) *HookDB {
+	h.hooks[name] = append(h.hooks[name], hooks)
+	return h
+}
+
+// of returns the hooks of the collection, the AllCollections ones first
+func (h *HookDB) of(name string) []Hooks {
+	all, own := h.hooks[AllCollections], h.hooks[name]
+	if len(own) == 0 {
+		return all
+	}
+	return append(append([]Hooks(nil), all...), own...)
+}
+
+func (h *HookDB) Insert(name string, doc interface{}) error {
+	return h.InsertCtx(context.TODO(), name, doc)
+}
+
+func (h *HookDB) InsertCtx(ctx context.Context, name string, doc interface{}) error {
+	return h.InsertAllCtx(ctx, name, doc)
+}
+
+func (h *HookDB) InsertAll(name string, docs ...interface{}) error {
+	return h.InsertAllCtx(context.TODO(), name, docs...)
+}
+
+func (h *HookDB) InsertAllCtx(ctx context.Context, name string, docs ...interface{}) error {
+	if len(h.of(name)) == 0 {
+		return h.DBAdaptor.InsertAllCtx(ctx, name, docs...)
+	}
+
+	values := make([]bson.M, 0, len(docs))
+	for _, v := range docs {
+		doc, err := h.beforeInsert(ctx, name, v)
+		if err != nil {
+			return err
+		}
+		values = append(values, doc)
+	}
+
+	var err error
+	if len(values) == 1 {
+		err = h.DBAdaptor.InsertCtx(ctx, name, values[0])
+	} else {
+		args := make([]interface{}, len(values))
+		for i, doc := range values {
+			args[i] = doc
+		}
+		err = h.DBAdaptor.InsertAllCtx(ctx, name, args...)
+	}
+	if err != nil {
+		return err
+	}
+
+	return h.afterInsert(ctx, name, values)
+}
+
+// beforeInsert converts doc, assigns its _id and runs the BeforeInsert hooks
+func (h *HookDB) beforeInsert(ctx context.Context, name string, v interface{}) (bson.M, error) {
+	doc, err := toM(v)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := doc["_id"]; !ok {
+		doc["_id"] = primitive.NewObjectID()
+	}
+	for _, hook := range h.of(name) {
+		if hook.BeforeInsert == nil {
+			continue
+		}
+		if err = hook.BeforeInsert(ctx, name, doc); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// afterInsert runs the AfterInsert hooks on the inserted docs
+func (h *HookDB) afterInsert(ctx context.Context, name string, docs []bson.M) error {
+	for _, doc := range docs {
+		for _, hook := range h.of(name) {
+			if hook.AfterInsert == nil {
+				continue
+			}
+			if err := hook.AfterInsert(ctx, name, doc); err != nil {
+				return fmt.Errorf("%w: %w", ErrAfterHook, err)
+			}
+		}
+	}
+	return nil
+}
+
+// beforeUpdate runs the BeforeUpdate hooks, they may modify ev.Update
+func (h *HookDB) beforeUpdate(ctx context.Context, ev *UpdateEvent) error {
+	for _, hook := range h.of(ev.Collection) {
+		if hook.BeforeUpdate == nil {
+			continue
+		}
+		if err := hook.BeforeUpdate(ctx, ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setFields runs the hooks on the $set-wrapped update of Update/UpdateById and
+// returns the fields to pass to the wrapped adaptor
+func (h *HookDB) setFields(ctx context.Context, name string, filter, update interface{}, multi bool) (interface{}, error) {
+	if len(h.of(name)) == 0 {
+		return update, nil
+	}
+	fields, err := toM(update)
+	if err != nil {
+		return nil, err
+	}
+	ev := &UpdateEvent{Collection: name, Filter: filter, Update: bson.M{"$set": fields}, Multi: multi}
+	if err = h.beforeUpdate(ctx, ev); err != nil {
+		return nil, err
+	}
+	for op := range ev.Update {
+		if op != "$set" {
+			return nil, fmt.Errorf("lib_mongo: hook added %s to Update of %s, use UpdateRaw", op, name)
+		}
+	}
+	return ev.Update["$set"], nil
+}
+
+func (h *HookDB) Update(name string, query, update interface{}, multi bool) error {
+	return h.UpdateCtx(context.TODO(), name, query, update, multi)
+}
+
+func (h *HookDB) UpdateCtx(ctx context.Context, name string, query, update interface{}, multi bool) error {
+	fields, err := h.setFields(ctx, name, query, update, multi)
+	if err != nil {
+		return err
+	}
+	return h.DBAdaptor.UpdateCtx(ctx, name, query, fields, multi)
+}
+
+func (h *HookDB) UpdateById(name string, id, update interface{}) error {
+	return h.UpdateByIdCtx(context.TODO(), name, id, update)
+}
+
+func (h *HookDB) UpdateByIdCtx(ctx context.Context, name string, id, update interface{}) error {
+	fields, err := h.setFields(ctx, name, bson.M{"_id": id}, update, false)
+	if err != nil {
+		return err
+	}
+	return h.DBAdaptor.UpdateByIdCtx(ctx, name, id, fields)
+}
+
+func (h *HookDB) UpdateRaw(name string, query, update interface{}, multi bool) error {
+	return h.UpdateRawCtx(context.TODO(), name, query, update, multi)
+}
+
+// UpdateRawCtx runs the hooks with Upsert set, as UpdateRaw upserts
+func (h *HookDB) UpdateRawCtx(ctx context.Context, name string, query, update interface{}, multi bool) error {
+	if len(h.of(name)) == 0 {
+		return h.DBAdaptor.UpdateRawCtx(ctx, name, query, update, multi)
+	}
+	change, err := toM(update)
+	if err != nil {
+		return err
+	}
+	ev := &UpdateEvent{Collection: name, Filter: query, Update: change, Multi: multi, Upsert: true}
+	if err = h.beforeUpdate(ctx, ev); err != nil {
+		return err
+	}
+	return h.DBAdaptor.UpdateRawCtx(ctx, name, query, ev.Update, multi)
+}
+
+func (h *HookDB) FindOneAndUpdate(name string, filter, update interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return h.FindOneAndUpdateCtx(context.TODO(), name, filter, update, opt, result)
+}
+
+func (h *HookDB) FindOneAndUpdateCtx(ctx context.Context, name string, filter, update interface{}, opt FindAndModifyOptions, result interface{}) error {
+	if len(h.of(name)) == 0 {
+		return h.DBAdaptor.FindOneAndUpdateCtx(ctx, name, filter, update, opt, result)
+	}
+	change, err := toM(update)
+	if err != nil {
+		return err
+	}
+	ev := &UpdateEvent{Collection: name, Filter: filter, Update: change, Upsert: opt.Upsert}
+	if err = h.beforeUpdate(ctx, ev); err != nil {
+		return err
+	}
+	return h.DBAdaptor.FindOneAndUpdateCtx(ctx, name, filter, ev.Update, opt, result)
+}
+
+// replacement runs the BeforeUpdate hooks on the replacement wrapped in $set and
+// returns the document to write. On upsert the $setOnInsert fields missing from
+// the document are added to it, a replacement always carries the whole document.
+func (h *HookDB) replacement(ctx context.Context, name string, filter, doc interface{}, upsert bool) (interface{}, error) {
+	if len(h.of(name)) == 0 {
+		return doc, nil
+	}
+	fields, err := toM(doc)
+	if err != nil {
+		return nil, err
+	}
+	ev := &UpdateEvent{Collection: name, Filter: filter, Update: bson.M{"$set": fields}, Upsert: upsert}
+	if err = h.beforeUpdate(ctx, ev); err != nil {
+		return nil, err
+	}
+	replacement, err := toM(ev.Update["$set"])
+	if err != nil {
+		return nil, err
+	}
+	for op, v := range ev.Update {
+		switch op {
+		case "$set":
+		case "$setOnInsert":
+			if !upsert {
+				continue
+			}
+			onInsert, err := toM(v)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range onInsert {
+				if _, ok := replacement[k]; !ok {
+					replacement[k] = v
+				}
+			}
+		default:
+			return nil, fmt.Errorf("lib_mongo: hook added %s to the replacement of %s", op, name)
+		}
+	}
+	return replacement, nil
+}
+
+func (h *HookDB) FindOneAndReplace(name string, filter, replacement interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return h.FindOneAndReplaceCtx(context.TODO(), name, filter, replacement, opt, result)
+}
+
+func (h *HookDB) FindOneAndReplaceCtx(ctx context.Context, name string, filter, replacement interface{}, opt FindAndModifyOptions, result interface{}) error {
+	doc, err := h.replacement(ctx, name, filter, replacement, opt.Upsert)
+	if err != nil {
+		return err
+	}
+	return h.DBAdaptor.FindOneAndReplaceCtx(ctx, name, filter, doc, opt, result)
+}
+
+func (h *HookDB) BulkWrite(name string, b *Bulk) (*BulkResult, error) {
+	return h.BulkWriteCtx(context.TODO(), name, b)
+}
+
+// BulkWriteCtx runs the Before hooks on each operation, and the After hooks
+// once every operation succeeded
+func (h *HookDB) BulkWriteCtx(ctx context.Context, name string, b *Bulk) (*BulkResult, error) {
+	if len(h.of(name)) == 0 || b == nil || b.Len() == 0 {
+		return h.DBAdaptor.BulkWriteCtx(ctx, name, b)
+	}
+
+	hooked := &Bulk{ops: make([]bulkOp, 0, len(b.ops)), ordered: b.ordered}
+	var inserted []bson.M
+	for _, op := range b.ops {
+		switch op.kind {
+		case bulkInsert:
+			doc, err := h.beforeInsert(ctx, name, op.doc)
+			if err != nil {
+				return nil, err
+			}
+			inserted = append(inserted, doc)
+			op.doc = doc
+		case bulkUpdateOne, bulkUpdateMany:
+			change, err := toM(op.doc)
+			if err != nil {
+				return nil, err
+			}
+			ev := &UpdateEvent{Collection: name, Filter: op.filter, Update: change, Multi: op.kind == bulkUpdateMany, Upsert: op.upsert}
+			if err = h.beforeUpdate(ctx, ev); err != nil {
+				return nil, err
+			}
+			op.doc = ev.Update
+		case bulkReplaceOne:
+			doc, err := h.replacement(ctx, name, op.filter, op.doc, op.upsert)
+			if err != nil {
+				return nil, err
+			}
+			op.doc = doc
+		}
+		hooked.ops = append(hooked.ops, op)
+	}
+
+	res, err := h.DBAdaptor.BulkWriteCtx(ctx, name, hooked)
+	if err != nil {
+		return res, err
+	}
+	if err = h.afterInsert(ctx, name, inserted); err != nil {
+		return res, err
+	}
+	for _, op := range b.ops {
+		if op.kind == bulkDeleteOne || op.kind == bulkDeleteMany {
+			if err = h.afterDelete(ctx, name, op.filter); err != nil {
+				return res, err
+			}
+		}
+	}
+	return res, nil
+}
+
+// afterDelete runs the AfterDelete hooks
+func (h *HookDB) afterDelete(ctx context.Context, name string, filter interface{}) error {
+	for _, hook := range h.of(name) {
+		if hook.AfterDelete == nil {
+			continue
+		}
+		if err := hook.AfterDelete(ctx, name, filter); err != nil {
+			return fmt.Errorf("%w: %w", ErrAfterHook, err)
+		}
+	}
+	return nil
+}
+
+func (h *HookDB) Remove(name string, query interface{}, multi bool) error {
+	return h.RemoveCtx(context.TODO(), name, query, multi)
+}
+
+func (h *HookDB) RemoveCtx(ctx context.Context, name string, query interface{}, multi bool) error {
+	if err := h.DBAdaptor.RemoveCtx(ctx, name, query, multi); err != nil {
+		return err
+	}
+	return h.afterDelete(ctx, name, query)
+}
+
+func (h *HookDB) RemoveById(name string, id interface{}) error {
+	return h.RemoveByIdCtx(context.TODO(), name, id)
+}
+
+func (h *HookDB) RemoveByIdCtx(ctx context.Context, name string, id interface{}) error {
+	if err := h.DBAdaptor.RemoveByIdCtx(ctx, name, id); err != nil {
+		return err
+	}
+	return h.afterDelete(ctx, name, bson.M{"_id": id})
+}
+
+func (h *HookDB) FindOneAndDelete(name string, filter interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return h.FindOneAndDeleteCtx(context.TODO(), name, filter, opt, result)
+}
+
+func (h *HookDB) FindOneAndDeleteCtx(ctx context.Context, name string, filter interface{}, opt FindAndModifyOptions, result interface{}) error {
+	if err := h.DBAdaptor.FindOneAndDeleteCtx(ctx, name, filter, opt, result); err != nil {
+		return err
+	}
+	return h.afterDelete(ctx, name, filter)
+}
+
+// Unscoped returns the hooks on top of the DBAdaptor under the soft delete, which
+// sees and hard deletes every document, or h when soft delete is not enabled
+func (h *HookDB) Unscoped() DBAdaptor {
+	if s, ok := h.DBAdaptor.(*SoftDeleteDB); ok {
+		return &HookDB{DBAdaptor: s.Unscoped(), hooks: h.hooks}
+	}
+	return h
+}
+
+// softDeleter 被包装的SoftDeleter，未启用软删除时返回ErrNotSoftDeleted
+func (h *HookDB) softDeleter(name string) (SoftDeleter, error) {
+	if sd, ok := h.DBAdaptor.(SoftDeleter); ok {
+		return sd, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotSoftDeleted, name)
+}
+
+// SoftDeleted see SoftDeleteDB.SoftDeleted
+func (h *HookDB) SoftDeleted(name string) bool {
+	sd, ok := h.DBAdaptor.(SoftDeleter)
+	return ok && sd.SoftDeleted(name)
+}
+
+// Restore see SoftDeleteDB.Restore
+func (h *HookDB) Restore(ctx context.Context, name string, query interface{}, multi bool) error {
+	sd, err := h.softDeleter(name)
+	if err != nil {
+		return err
+	}
+	return sd.Restore(ctx, name, query, multi)
+}
+
+// Purge see SoftDeleteDB.Purge
+func (h *HookDB) Purge(ctx context.Context, name string, olderThan time.Duration) error {
+	return h.purge(ctx, name, nil, olderThan)
+}
+
+func (h *HookDB) purge(ctx context.Context, name string, query interface{}, olderThan time.Duration) error {
+	sd, err := h.softDeleter(name)
+	if err != nil {
+		return err
+	}
+	return sd.purge(ctx, name, query, olderThan)
+}
+
+// WithTransaction runs fn with a tx that runs the hooks as well
+func (h *HookDB) WithTransaction(ctx context.Context, fn func(tx DBAdaptor) error, opts ...*options.TransactionOptions) error {
+	return h.DBAdaptor.WithTransaction(ctx, func(tx DBAdaptor) error {
+		return fn(&HookDB{DBAdaptor: tx, hooks: h.hooks})
+	}, opts...)
+}
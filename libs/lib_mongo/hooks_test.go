@@ -0,0 +1,130 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc:
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestHooks(t *testing.T) {
+	type profile struct {
+		ID        int32     `bson:"_id"`
+		Name      string    `bson:"name"`
+		CreatedAt time.Time `bson:"created_at"`
+		UpdatedAt time.Time `bson:"updated_at"`
+	}
+
+	Convey("test hooks", t, func() {
+		mem := NewMemorySession()
+		var deleted []interface{}
+		db := NewHookDB(mem).
+			Register(AllCollections, TimestampHooks()).
+			Register("profile", Hooks{
+				BeforeInsert: func(ctx context.Context, name string, doc bson.M) error {
+					if doc["name"] == "" {
+						return errors.New("name is required")
+					}
+					return nil
+				},
+				AfterDelete: func(ctx context.Context, name string, filter interface{}) error {
+					deleted = append(deleted, filter)
+					return nil
+				},
+			})
+
+		So(db.Insert("profile", &profile{ID: 1, Name: "alice"}), ShouldBeNil)
+		So(db.Insert("profile", &profile{ID: 2}), ShouldNotBeNil)
+
+		var p profile
+		err, _ := db.FindOne("profile", bson.M{"_id": 1}, &p)
+		So(err, ShouldBeNil)
+		So(p.CreatedAt.IsZero(), ShouldBeFalse)
+		So(p.UpdatedAt, ShouldEqual, p.CreatedAt)
+		created := p.CreatedAt
+
+		Convey("update and update raw set updated_at", func() {
+			time.Sleep(2 * time.Millisecond)
+			So(db.UpdateById("profile", 1, bson.M{"name": "alicia"}), ShouldBeNil)
+			err, _ := db.FindOne("profile", bson.M{"_id": 1}, &p)
+			So(err, ShouldBeNil)
+			So(p.Name, ShouldEqual, "alicia")
+			So(p.CreatedAt, ShouldEqual, created)
+			So(p.UpdatedAt.After(created), ShouldBeTrue)
+
+			So(db.UpdateRaw("profile", bson.M{"_id": 3}, bson.M{"$set": bson.M{"name": "carol"}}, false), ShouldBeNil)
+			err, _ = db.FindOne("profile", bson.M{"_id": 3}, &p)
+			So(err, ShouldBeNil)
+			So(p.CreatedAt.IsZero(), ShouldBeFalse)
+			So(p.UpdatedAt.IsZero(), ShouldBeFalse)
+		})
+
+		Convey("after delete", func() {
+			So(db.RemoveById("profile", 1), ShouldBeNil)
+			So(deleted, ShouldResemble, []interface{}{bson.M{"_id": 1}})
+		})
+
+		Convey("replacements keep created_at and set updated_at", func() {
+			time.Sleep(2 * time.Millisecond)
+			var got profile
+			So(db.FindOneAndReplace("profile", bson.M{"_id": 1}, &profile{ID: 1, Name: "alicia", CreatedAt: created},
+				FindAndModifyOptions{ReturnNew: true}, &got), ShouldBeNil)
+			So(got.Name, ShouldEqual, "alicia")
+			So(got.CreatedAt, ShouldEqual, created)
+			So(got.UpdatedAt.After(created), ShouldBeTrue)
+
+			So(db.FindOneAndReplace("profile", bson.M{"_id": 5}, bson.M{"name": "eve"},
+				FindAndModifyOptions{Upsert: true, ReturnNew: true}, &got), ShouldBeNil)
+			So(got.CreatedAt.IsZero(), ShouldBeFalse)
+			So(got.UpdatedAt.IsZero(), ShouldBeFalse)
+
+			So(ReplaceVersioned(context.TODO(), db, "profile", 1, 0, bson.M{"name": "ally", CreatedAtField: created}, &got), ShouldBeNil)
+			So(got.UpdatedAt.After(created), ShouldBeTrue)
+		})
+
+		Convey("bulk operations run the hooks", func() {
+			time.Sleep(2 * time.Millisecond)
+			b := NewBulk().
+				Insert(&profile{ID: 2, Name: "bob"}).
+				UpdateOne(bson.M{"_id": 1}, bson.M{"$set": bson.M{"name": "alicia"}}, false).
+				UpdateOne(bson.M{"_id": 3}, bson.M{"$set": bson.M{"name": "carol"}}, true).
+				ReplaceOne(bson.M{"_id": 4}, bson.M{"name": "dave"}, true).
+				DeleteOne(bson.M{"_id": 2})
+			_, err := db.BulkWrite("profile", b)
+			So(err, ShouldBeNil)
+
+			var all []profile
+			So(db.FindAll("profile", bson.M{}, &all), ShouldBeNil)
+			So(len(all), ShouldEqual, 3)
+			for _, p := range all {
+				So(p.CreatedAt.IsZero(), ShouldBeFalse)
+				So(p.UpdatedAt.After(created), ShouldBeTrue)
+			}
+			So(all[0].CreatedAt, ShouldEqual, created)
+			So(deleted, ShouldResemble, []interface{}{bson.M{"_id": 2}})
+
+			_, err = db.BulkWrite("profile", NewBulk().Insert(&profile{ID: 6}))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("errors of after hooks are told apart from failed writes", func() {
+			db.Register("profile", Hooks{
+				AfterDelete: func(ctx context.Context, name string, filter interface{}) error {
+					return errors.New("cache unavailable")
+				},
+			})
+			err := db.RemoveById("profile", 1)
+			So(errors.Is(err, ErrAfterHook), ShouldBeTrue)
+			n, err := db.FindCount("profile", bson.M{"_id": 1})
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,296 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: 索引声明与启动时同步
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexSpec declares one index, it can be registered in code or loaded from config.yaml
+//
+// Keys are written as "field" (ascending), "-field" (descending) or
+// "field:type" for special indexes such as "title:text" or "loc:2dsphere".
+type IndexSpec struct {
+	Collection string   `yaml:"Collection"`
+	Name       string   `yaml:"Name"`
+	Keys       []string `yaml:"Keys"`
+	Unique     bool     `yaml:"Unique"`
+	Sparse     bool     `yaml:"Sparse"`
+	// TTL索引过期时间(秒)
+	ExpireAfterSeconds *int32 `yaml:"ExpireAfterSeconds"`
+	// 部分索引过滤条件
+	PartialFilter map[string]interface{} `yaml:"PartialFilter"`
+}
+
+// KeysDoc returns the keys as an ordered index key document
+func (spec IndexSpec) KeysDoc() bson.D {
+	keys := make(bson.D, 0, len(spec.Keys))
+	for _, key := range spec.Keys {
+		switch {
+		case strings.HasPrefix(key, "-"):
+			keys = append(keys, bson.E{Key: key[1:], Value: int32(-1)})
+		case strings.Contains(key, ":"):
+			i := strings.LastIndex(key, ":")
+			keys = append(keys, bson.E{Key: key[:i], Value: key[i+1:]})
+		default:
+			keys = append(keys, bson.E{Key: key, Value: int32(1)})
+		}
+	}
+	return keys
+}
+
+// IndexName returns Name, or the name mongo generates from the keys
+func (spec IndexSpec) IndexName() string {
+	if spec.Name != "" {
+		return spec.Name
+	}
+	parts := make([]string, 0, len(spec.Keys)*2)
+	for _, e := range spec.KeysDoc() {
+		parts = append(parts, e.Key, fmt.Sprint(e.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+func (spec IndexSpec) isText() bool {
+	for _, e := range spec.KeysDoc() {
+		if e.Value == "text" {
+			return true
+		}
+	}
+	return false
+}
+
+func (spec IndexSpec) model() mongo.IndexModel {
+	opt := options.Index().SetName(spec.IndexName())
+	if spec.Unique {
+		opt.SetUnique(true)
+	}
+	if spec.Sparse {
+		opt.SetSparse(true)
+	}
+	if spec.ExpireAfterSeconds != nil {
+		opt.SetExpireAfterSeconds(*spec.ExpireAfterSeconds)
+	}
+	if len(spec.PartialFilter) > 0 {
+		opt.SetPartialFilterExpression(spec.PartialFilter)
+	}
+	return mongo.IndexModel{Keys: spec.KeysDoc(), Options: opt}
+}
+
+// IndexSyncOptions controls SyncIndexes
+type IndexSyncOptions struct {
+	// 只计算差异，不做任何修改
+	DryRun bool
+	// 删除未声明的索引，以及与声明不一致的索引(随后重建)
+	DropExtra bool
+}
+
+// IndexRef names an existing index
+type IndexRef struct {
+	Collection string
+	Name       string
+}
+
+// IndexDiff is the difference between the declared and the existing indexes
+type IndexDiff struct {
+	// 需要创建的索引
+	Missing []IndexSpec
+	// 同名但key或选项不一致的索引
+	Changed []IndexSpec
+	// 存在但未声明的索引
+	Extra []IndexRef
+}
+
+// Empty reports whether the declared indexes match the database
+func (d *IndexDiff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Changed) == 0 && len(d.Extra) == 0
+}
+
+// Lines renders the diff one index per line
+func (d *IndexDiff) Lines() []string {
+	var lines []string
+	for _, spec := range d.Missing {
+		lines = append(lines, fmt.Sprintf("+ %s.%s %v", spec.Collection, spec.IndexName(), spec.Keys))
+	}
+	for _, spec := range d.Changed {
+		lines = append(lines, fmt.Sprintf("~ %s.%s %v", spec.Collection, spec.IndexName(), spec.Keys))
+	}
+	for _, ref := range d.Extra {
+		lines = append(lines, fmt.Sprintf("- %s.%s", ref.Collection, ref.Name))
+	}
+	return lines
+}
+
+var indexRegistry = struct {
+	sync.Mutex
+	specs []IndexSpec
+}{}
+
+// RegisterIndexes declares indexes in code, usually from an init function
+func RegisterIndexes(specs ...IndexSpec) {
+	indexRegistry.Lock()
+	indexRegistry.specs = append(indexRegistry.specs, specs...)
+	indexRegistry.Unlock()
+}
+
+// RegisteredIndexes returns the indexes declared with RegisterIndexes
+func RegisteredIndexes() []IndexSpec {
+	indexRegistry.Lock()
+	defer indexRegistry.Unlock()
+	return append([]IndexSpec(nil), indexRegistry.specs...)
+}
+
+// existingIndex is one entry of listIndexes
+type existingIndex struct {
+	Name               string `bson:"name"`
+	Key                bson.D `bson:"key"`
+	Unique             bool   `bson:"unique"`
+	Sparse             bool   `bson:"sparse"`
+	ExpireAfterSeconds *int32 `bson:"expireAfterSeconds"`
+	PartialFilter      bson.M `bson:"partialFilterExpression"`
+}
+
+// sameAs reports whether the existing index matches the declaration
+func (idx existingIndex) sameAs(spec IndexSpec) bool {
+	if idx.Unique != spec.Unique || idx.Sparse != spec.Sparse {
+		return false
+	}
+	if (idx.ExpireAfterSeconds == nil) != (spec.ExpireAfterSeconds == nil) ||
+		(idx.ExpireAfterSeconds != nil && *idx.ExpireAfterSeconds != *spec.ExpireAfterSeconds) {
+		return false
+	}
+	if len(spec.PartialFilter) > 0 || len(idx.PartialFilter) > 0 {
+		want, err := toM(spec.PartialFilter)
+		if err != nil || !equalValues(want, idx.PartialFilter) {
+			return false
+		}
+	}
+	// text索引在服务端存储为_fts/_ftsx，不比较key
+	if spec.isText() {
+		return true
+	}
+	keys := spec.KeysDoc()
+	if len(keys) != len(idx.Key) {
+		return false
+	}
+	for i, e := range keys {
+		if idx.Key[i].Key != e.Key || !equalValues(idx.Key[i].Value, e.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// diffIndexes compares the declared indexes of one collection with the existing ones
+func diffIndexes(name string, specs []IndexSpec, existing []existingIndex, diff *IndexDiff) {
+	byName := make(map[string]existingIndex, len(existing))
+	for _, idx := range existing {
+		byName[idx.Name] = idx
+	}
+
+	declared := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		declared[spec.IndexName()] = true
+		idx, ok := byName[spec.IndexName()]
+		switch {
+		case !ok:
+			diff.Missing = append(diff.Missing, spec)
+		case !idx.sameAs(spec):
+			diff.Changed = append(diff.Changed, spec)
+		}
+	}
+	for _, idx := range existing {
+		if idx.Name != "_id_" && !declared[idx.Name] {
+			diff.Extra = append(diff.Extra, IndexRef{Collection: name, Name: idx.Name})
+		}
+	}
+}
+
+// groupIndexes groups specs by collection, in a stable order
+func groupIndexes(specs []IndexSpec) ([]string, map[string][]IndexSpec) {
+	groups := make(map[string][]IndexSpec)
+	var names []string
+	for _, spec := range specs {
+		if _, ok := groups[spec.Collection]; !ok {
+			names = append(names, spec.Collection)
+		}
+		groups[spec.Collection] = append(groups[spec.Collection], spec)
+	}
+	sort.Strings(names)
+	return names, groups
+}
+
+// listIndexes returns the indexes of the collection
+func (c *Collection) listIndexes(ctx context.Context) ([]existingIndex, error) {
+	cur, err := c.collection.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var indexes []existingIndex
+	if err = cur.All(ctx, &indexes); err != nil {
+		return nil, err
+	}
+	return indexes, nil
+}
+
+// namespaceNotFound reports whether err, possibly wrapped, says the collection does not exist
+func namespaceNotFound(err error) bool {
+	var ce mongo.CommandError
+	return errors.As(err, &ce) && ce.HasErrorCode(codeNamespaceNotFound)
+}
+
+// SyncIndexes creates the missing declared indexes. Only collections that
+// declare at least one index are inspected.
+func (ms *MongoSession) SyncIndexes(ctx context.Context, specs []IndexSpec, opt IndexSyncOptions) (*IndexDiff, error) {
+	diff := &IndexDiff{}
+	names, groups := groupIndexes(specs)
+	for _, name := range names {
+		c := ms.session.DB(ms.dbName).C(name)
+		existing, err := c.listIndexes(ctx)
+		if err != nil {
+			// 集合不存在时没有索引
+			if !namespaceNotFound(err) {
+				return diff, wrapErr("SyncIndexes", name, err)
+			}
+		}
+		diffIndexes(name, groups[name], existing, diff)
+	}
+	if opt.DryRun {
+		return diff, nil
+	}
+
+	if opt.DropExtra {
+		for _, ref := range diff.Extra {
+			if _, err := ms.session.DB(ms.dbName).C(ref.Collection).collection.Indexes().DropOne(ctx, ref.Name); err != nil {
+				return diff, wrapErr("SyncIndexes", ref.Collection, err)
+			}
+		}
+		for _, spec := range diff.Changed {
+			if _, err := ms.session.DB(ms.dbName).C(spec.Collection).collection.Indexes().DropOne(ctx, spec.IndexName()); err != nil {
+				return diff, wrapErr("SyncIndexes", spec.Collection, err)
+			}
+		}
+	}
+
+	create := diff.Missing
+	if opt.DropExtra {
+		create = append(append([]IndexSpec(nil), diff.Missing...), diff.Changed...)
+	}
+	for _, spec := range create {
+		if _, err := ms.session.DB(ms.dbName).C(spec.Collection).collection.Indexes().CreateOne(ctx, spec.model()); err != nil {
+			return diff, wrapErr("SyncIndexes", spec.Collection, err)
+		}
+	}
+	return diff, nil
+}
@@ -0,0 +1,105 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: 游标迭代器，流式读取查询结果
+
+package lib_mongo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Iter streams the documents of a cursor one by one
+//
+//	it, err := session.DB(db).C(name).Find(query).BatchSize(500).Iter(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	defer it.Close()
+//	for it.Next(&doc) {
+//		...
+//	}
+//	return it.Err()
+type Iter struct {
+	ctx    context.Context
+	cursor *mongo.Cursor
+	err    error
+}
+
+// Iter runs the query and returns an iterator over the results
+func (s *Session) Iter(ctx context.Context) (*Iter, error) {
+	if err := s.guard.check(ctx, s); err != nil {
+		return nil, err
+	}
+	coll, op := s.resolve(ctx)
+	cur, err := coll.Find(ctx, s.filter, op.find(), s.findOptions())
+	if err != nil {
+		return nil, err
+	}
+	return &Iter{ctx: ctx, cursor: cur}, nil
+}
+
+// PipeIter runs the aggregation and returns an iterator over the results
+func (s *Session) PipeIter(ctx context.Context, pipeline interface{}) (*Iter, error) {
+	opts := options.Aggregate()
+	opts.SetAllowDiskUse(true)
+	if s.batchSize != nil {
+		opts.SetBatchSize(*s.batchSize)
+	}
+
+	coll, op := s.resolve(ctx)
+	cur, err := coll.Aggregate(ctx, pipeline, op.aggregate(), opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Iter{ctx: ctx, cursor: cur}, nil
+}
+
+// Next decodes the next document into result, it returns false when the
+// cursor is exhausted or an error occurred, check Err afterwards.
+func (it *Iter) Next(result interface{}) bool {
+	if it.err != nil || !it.cursor.Next(it.ctx) {
+		return false
+	}
+	if err := it.cursor.Decode(result); err != nil {
+		it.err = err
+		return false
+	}
+	return true
+}
+
+// Current returns the raw current document, it is only valid until the next call of Next
+func (it *Iter) Current() bson.Raw {
+	return it.cursor.Current
+}
+
+// Err returns the error that stopped the iteration
+func (it *Iter) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.cursor.Err()
+}
+
+// Close closes the server side cursor
+func (it *Iter) Close() error {
+	return it.cursor.Close(context.Background())
+}
+
+// forEach calls fn with every raw document until the cursor is exhausted,
+// fn returns ErrStopIter to stop early
+func (it *Iter) forEach(fn func(raw bson.Raw) error) error {
+	defer it.Close()
+	for it.cursor.Next(it.ctx) {
+		if err := fn(it.cursor.Current); err != nil {
+			if err == ErrStopIter {
+				return nil
+			}
+			return err
+		}
+	}
+	return it.cursor.Err()
+}
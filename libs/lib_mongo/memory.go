@@ -0,0 +1,953 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: 内存版DBAdaptor，用于单元测试
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ DBAdaptor = (*MemorySession)(nil)
+
+// MemorySession is an in-memory DBAdaptor for tests, swap it into common.GEnv.MongoCli.
+//
+// Supported query operators: $eq $ne $in $nin $gt $gte $lt $lte $exists $not $and $or $nor.
+// Supported update operators: $set $inc $unset $setOnInsert, or a replacement document.
+// Aggregation supports the $match $sort $skip $limit $project stages.
+type MemorySession struct {
+	m    sync.RWMutex
+	data map[string][]bson.Raw
+	// 已同步的索引声明，只记录不生效
+	indexes map[string][]IndexSpec
+	// WithTransaction嵌套时为true
+	inTx bool
+}
+
+func NewMemorySession() *MemorySession {
+	return &MemorySession{data: map[string][]bson.Raw{}}
+}
+
+func (ms *MemorySession) Connect(uri, db string) error {
+	return nil
+}
+
+func (ms *MemorySession) ConnectCtx(ctx context.Context, uri, db string) error {
+	return nil
+}
+
+func (ms *MemorySession) Disconnect() {}
+
+func (ms *MemorySession) SetPoolLimit(limit uint64) {}
+
+func (ms *MemorySession) Health() Health {
+	return Health{Status: HealthUp, Writable: true, CheckedAt: time.Now()}
+}
+
+// Reset drops every collection
+func (ms *MemorySession) Reset() {
+	ms.m.Lock()
+	ms.data = map[string][]bson.Raw{}
+	ms.m.Unlock()
+}
+
+// docs decodes every document of the collection
+func (ms *MemorySession) docs(name string) ([]bson.M, error) {
+	raws := ms.data[name]
+	docs := make([]bson.M, 0, len(raws))
+	for _, raw := range raws {
+		doc, err := toM(raw)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// store replaces the content of the collection
+func (ms *MemorySession) store(name string, docs []bson.M) error {
+	raws := make([]bson.Raw, 0, len(docs))
+	for _, doc := range docs {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		raws = append(raws, raw)
+	}
+	ms.data[name] = raws
+	return nil
+}
+
+// find returns the matching documents after sort, skip, limit and projection
+func (ms *MemorySession) find(name string, query, selection, sorter interface{}, limit, skip int64) ([]bson.M, error) {
+	filter, err := toM(query)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := ms.docs(name)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]bson.M, 0)
+	for _, doc := range docs {
+		ok, err := matchFilter(doc, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, doc)
+		}
+	}
+
+	if sorter != nil {
+		spec, err := toD(sorter)
+		if err != nil {
+			return nil, err
+		}
+		sortDocs(matched, spec)
+	}
+	if skip > 0 {
+		if skip >= int64(len(matched)) {
+			matched = matched[:0]
+		} else {
+			matched = matched[skip:]
+		}
+	}
+	if limit > 0 && limit < int64(len(matched)) {
+		matched = matched[:limit]
+	}
+	if selection != nil {
+		spec, err := toD(selection)
+		if err != nil {
+			return nil, err
+		}
+		for i, doc := range matched {
+			matched[i] = project(doc, spec)
+		}
+	}
+	return matched, nil
+}
+
+// decodeOne decodes doc into result
+func decodeOne(doc bson.M, result interface{}) error {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, result)
+}
+
+// decodeAll decodes docs into result, which must be a pointer to a slice
+func decodeAll(docs []bson.M, result interface{}) error {
+	resultv := reflect.ValueOf(result)
+	if resultv.Kind() != reflect.Ptr {
+		return fmt.Errorf("%w: results argument must be a pointer to a slice, but was a %s", ErrorResultType, resultv.Kind())
+	}
+	slicev := resultv.Elem()
+	if slicev.Kind() == reflect.Interface {
+		slicev = slicev.Elem()
+	}
+	if slicev.Kind() != reflect.Slice {
+		return fmt.Errorf("%w: results argument must be a pointer to a slice, but was a pointer to %s", ErrorResultType, slicev.Kind())
+	}
+
+	slicev = slicev.Slice(0, 0)
+	elemt := slicev.Type().Elem()
+	for _, doc := range docs {
+		elemp := reflect.New(elemt)
+		if err := decodeOne(doc, elemp.Interface()); err != nil {
+			return err
+		}
+		slicev = reflect.Append(slicev, elemp.Elem())
+	}
+	resultv.Elem().Set(slicev)
+	return nil
+}
+
+func (ms *MemorySession) FindOne(name string, query, result interface{}) (err error, exist bool) {
+	return ms.FindOneCtx(context.TODO(), name, query, result)
+}
+
+func (ms *MemorySession) FindOneCtx(ctx context.Context, name string, query, result interface{}) (err error, exist bool) {
+	ms.m.RLock()
+	defer ms.m.RUnlock()
+	docs, err := ms.find(name, query, nil, nil, 1, 0)
+	if err != nil {
+		return err, false
+	}
+	if len(docs) == 0 {
+		return wrapErr("FindOne", name, ErrNotFound), false
+	}
+	return decodeOne(docs[0], result), true
+}
+
+func (ms *MemorySession) Find(name string, query, result interface{}, limit int64) error {
+	return ms.FindCtx(context.TODO(), name, query, result, limit)
+}
+
+func (ms *MemorySession) FindCtx(ctx context.Context, name string, query, result interface{}, limit int64) error {
+	if limit <= 0 {
+		return ErrorLimit
+	}
+	return ms.findAll(name, query, nil, nil, result, limit, 0)
+}
+
+func (ms *MemorySession) FindAll(name string, query, result interface{}) error {
+	return ms.FindAllCtx(context.TODO(), name, query, result)
+}
+
+func (ms *MemorySession) FindAllCtx(ctx context.Context, name string, query, result interface{}) error {
+	return ms.findAll(name, query, nil, nil, result, 0, 0)
+}
+
+func (ms *MemorySession) FindByLimitAndSkip(name string, query, result interface{}, limit, skip int64) error {
+	return ms.FindByLimitAndSkipCtx(context.TODO(), name, query, result, limit, skip)
+}
+
+func (ms *MemorySession) FindByLimitAndSkipCtx(ctx context.Context, name string, query, result interface{}, limit, skip int64) error {
+	if limit <= 0 || skip < 0 {
+		return ErrorLimit
+	}
+	return ms.findAll(name, query, nil, nil, result, limit, skip)
+}
+
+func (ms *MemorySession) FindWithSelect(name string, query, selection, result interface{}, limit int64) error {
+	return ms.FindWithSelectCtx(context.TODO(), name, query, selection, result, limit)
+}
+
+func (ms *MemorySession) FindWithSelectCtx(ctx context.Context, name string, query, selection, result interface{}, limit int64) error {
+	if limit <= 1 {
+		ms.m.RLock()
+		defer ms.m.RUnlock()
+		docs, err := ms.find(name, query, selection, nil, 1, 0)
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			return wrapErr("FindWithSelect", name, ErrNotFound)
+		}
+		return decodeOne(docs[0], result)
+	}
+	return ms.findAll(name, query, selection, nil, result, limit, 0)
+}
+
+func (ms *MemorySession) FindSelect(name string, query, selection, result interface{}) error {
+	return ms.FindSelectCtx(context.TODO(), name, query, selection, result)
+}
+
+func (ms *MemorySession) FindSelectCtx(ctx context.Context, name string, query, selection, result interface{}) error {
+	return ms.findAll(name, query, selection, nil, result, 0, 0)
+}
+
+func (ms *MemorySession) FindWithMultiple(name string, query, selection, sorter, result interface{}, limit, skip int64) error {
+	return ms.FindWithMultipleCtx(context.TODO(), name, query, selection, sorter, result, limit, skip)
+}
+
+func (ms *MemorySession) FindWithMultipleCtx(ctx context.Context, name string, query, selection, sorter, result interface{}, limit, skip int64) error {
+	if limit < 0 || skip < 0 {
+		return ErrorLimit
+	}
+	ms.m.RLock()
+	defer ms.m.RUnlock()
+	docs, err := ms.find(name, query, selection, sorter, limit, skip)
+	if err != nil {
+		return err
+	}
+	if limit == 1 {
+		if len(docs) == 0 {
+			return wrapErr("FindWithMultiple", name, mongo.ErrNoDocuments)
+		}
+		return decodeOne(docs[0], result)
+	}
+	return decodeAll(docs, result)
+}
+
+// findAll decodes every matching document into result, which must be a pointer to a slice
+func (ms *MemorySession) findAll(name string, query, selection, sorter, result interface{}, limit, skip int64) error {
+	ms.m.RLock()
+	defer ms.m.RUnlock()
+	docs, err := ms.find(name, query, selection, sorter, limit, skip)
+	if err != nil {
+		return err
+	}
+	return decodeAll(docs, result)
+}
+
+func (ms *MemorySession) FindCount(name string, query interface{}) (int64, error) {
+	return ms.FindCountCtx(context.TODO(), name, query)
+}
+
+func (ms *MemorySession) FindCountCtx(ctx context.Context, name string, query interface{}) (int64, error) {
+	ms.m.RLock()
+	defer ms.m.RUnlock()
+	docs, err := ms.find(name, query, nil, nil, 0, 0)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(docs)), nil
+}
+
+func (ms *MemorySession) FindSortByLimitAndSkip(name string, query, sorter, result interface{}, limit, skip int64) error {
+	return ms.FindSortByLimitAndSkipCtx(context.TODO(), name, query, sorter, result, limit, skip)
+}
+
+func (ms *MemorySession) FindSortByLimitAndSkipCtx(ctx context.Context, name string, query, sorter, result interface{}, limit, skip int64) error {
+	if limit < 0 || skip < 0 {
+		return ErrorLimit
+	}
+	return ms.findAll(name, query, nil, sorter, result, limit, skip)
+}
+
+func (ms *MemorySession) FindWithAggregation(name string, pipeline, result interface{}) error {
+	return ms.FindWithAggregationCtx(context.TODO(), name, pipeline, result)
+}
+
+func (ms *MemorySession) FindWithAggregationCtx(ctx context.Context, name string, pipeline, result interface{}) error {
+	docs, err := ms.aggregate(name, pipeline)
+	if err != nil {
+		return err
+	}
+	return decodeAll(docs, result)
+}
+
+// aggregate runs the supported stages: $match, $sort, $skip, $limit, $project and $count
+func (ms *MemorySession) aggregate(name string, pipeline interface{}) ([]bson.M, error) {
+	stages, ok := toList(pipeline)
+	if !ok {
+		return nil, fmt.Errorf("pipeline must be an array of stages, but was %T", pipeline)
+	}
+
+	ms.m.RLock()
+	docs, err := ms.find(name, nil, nil, nil, 0, 0)
+	ms.m.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stage := range stages {
+		d, err := toD(stage)
+		if err != nil {
+			return nil, err
+		}
+		if len(d) != 1 {
+			return nil, fmt.Errorf("a pipeline stage must have exactly one field")
+		}
+		op, arg := d[0].Key, d[0].Value
+		switch op {
+		case "$match":
+			filter, err := toM(arg)
+			if err != nil {
+				return nil, err
+			}
+			matched := make([]bson.M, 0, len(docs))
+			for _, doc := range docs {
+				ok, err := matchFilter(doc, filter)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					matched = append(matched, doc)
+				}
+			}
+			docs = matched
+		case "$sort":
+			spec, err := toD(arg)
+			if err != nil {
+				return nil, err
+			}
+			sortDocs(docs, spec)
+		case "$skip":
+			n, _ := toFloat(arg)
+			if int(n) >= len(docs) {
+				docs = docs[:0]
+			} else {
+				docs = docs[int(n):]
+			}
+		case "$limit":
+			n, _ := toFloat(arg)
+			if int(n) < len(docs) {
+				docs = docs[:int(n)]
+			}
+		case "$project":
+			spec, err := toD(arg)
+			if err != nil {
+				return nil, err
+			}
+			for i, doc := range docs {
+				docs[i] = project(doc, spec)
+			}
+		case "$count":
+			field, _ := arg.(string)
+			docs = []bson.M{{field: int32(len(docs))}}
+		default:
+			return nil, fmt.Errorf("%w: pipeline stage %s", ErrNotSupported, op)
+		}
+	}
+	return docs, nil
+}
+
+// Aggregate runs the pipeline in memory, the options of p are ignored
+func (ms *MemorySession) Aggregate(ctx context.Context, name string, p *Pipeline) (*Iter, error) {
+	docs, err := ms.aggregate(name, p.Stages())
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(docs))
+	for i, doc := range docs {
+		values[i] = doc
+	}
+	cur, err := mongo.NewCursorFromDocuments(values, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Iter{ctx: ctx, cursor: cur}, nil
+}
+
+func (ms *MemorySession) AggregateAll(ctx context.Context, name string, p *Pipeline, result interface{}) error {
+	docs, err := ms.aggregate(name, p.Stages())
+	if err != nil {
+		return err
+	}
+	return decodeAll(docs, result)
+}
+
+func (ms *MemorySession) Remove(name string, query interface{}, multi bool) error {
+	return ms.RemoveCtx(context.TODO(), name, query, multi)
+}
+
+func (ms *MemorySession) RemoveCtx(ctx context.Context, name string, query interface{}, multi bool) error {
+	_, err := ms.remove(name, query, multi)
+	return err
+}
+
+// remove deletes the matching documents and returns how many were deleted
+func (ms *MemorySession) remove(name string, query interface{}, multi bool) (int64, error) {
+	filter, err := toM(query)
+	if err != nil {
+		return 0, err
+	}
+	ms.m.Lock()
+	defer ms.m.Unlock()
+	docs, err := ms.docs(name)
+	if err != nil {
+		return 0, err
+	}
+
+	kept := make([]bson.M, 0, len(docs))
+	var removed int64
+	for _, doc := range docs {
+		if removed == 0 || multi {
+			ok, err := matchFilter(doc, filter)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				removed++
+				continue
+			}
+		}
+		kept = append(kept, doc)
+	}
+	return removed, ms.store(name, kept)
+}
+
+func (ms *MemorySession) RemoveById(name string, id interface{}) error {
+	return ms.RemoveByIdCtx(context.TODO(), name, id)
+}
+
+func (ms *MemorySession) RemoveByIdCtx(ctx context.Context, name string, id interface{}) error {
+	return ms.RemoveCtx(ctx, name, bson.M{"_id": id}, false)
+}
+
+func (ms *MemorySession) Insert(name string, doc interface{}) error {
+	return ms.InsertCtx(context.TODO(), name, doc)
+}
+
+func (ms *MemorySession) InsertCtx(ctx context.Context, name string, doc interface{}) error {
+	return ms.InsertAllCtx(ctx, name, doc)
+}
+
+func (ms *MemorySession) InsertAll(name string, docs ...interface{}) error {
+	return ms.InsertAllCtx(context.TODO(), name, docs...)
+}
+
+func (ms *MemorySession) InsertAllCtx(ctx context.Context, name string, docs ...interface{}) error {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+	stored, err := ms.docs(name)
+	if err != nil {
+		return err
+	}
+	for _, v := range docs {
+		doc, err := toM(v)
+		if err != nil {
+			return err
+		}
+		if err = insertDoc(&stored, doc); err != nil {
+			return wrapErr("InsertAll", name, err)
+		}
+	}
+	return ms.store(name, stored)
+}
+
+// insertDoc appends doc, assigning an ObjectID and enforcing a unique _id
+func insertDoc(docs *[]bson.M, doc bson.M) error {
+	if _, ok := doc["_id"]; !ok {
+		doc["_id"] = primitive.NewObjectID()
+	}
+	for _, exist := range *docs {
+		if equalValues(exist["_id"], doc["_id"]) {
+			return ErrIsDuplicate
+		}
+	}
+	*docs = append(*docs, doc)
+	return nil
+}
+
+func (ms *MemorySession) Update(name string, query, update interface{}, multi bool) error {
+	return ms.UpdateCtx(context.TODO(), name, query, update, multi)
+}
+
+func (ms *MemorySession) UpdateCtx(ctx context.Context, name string, query, update interface{}, multi bool) error {
+	_, err := ms.update(name, query, bson.M{"$set": update}, multi, false)
+	return err
+}
+
+func (ms *MemorySession) UpdateById(name string, id, update interface{}) error {
+	return ms.UpdateByIdCtx(context.TODO(), name, id, update)
+}
+
+func (ms *MemorySession) UpdateByIdCtx(ctx context.Context, name string, id, update interface{}) error {
+	_, err := ms.update(name, bson.M{"_id": id}, bson.M{"$set": update}, false, false)
+	return err
+}
+
+func (ms *MemorySession) UpdateRaw(name string, query, update interface{}, multi bool) error {
+	return ms.UpdateRawCtx(context.TODO(), name, query, update, multi)
+}
+
+func (ms *MemorySession) UpdateRawCtx(ctx context.Context, name string, query, update interface{}, multi bool) error {
+	_, err := ms.update(name, query, update, multi, true)
+	return err
+}
+
+// memUpdate is the outcome of MemorySession.update
+type memUpdate struct {
+	matched    int64
+	modified   int64
+	upsertedID interface{}
+	// 更新或upsert之后的文档
+	docs []bson.M
+}
+
+// update applies update to the matching documents
+func (ms *MemorySession) update(name string, query, update interface{}, multi, upsert bool) (*memUpdate, error) {
+	filter, err := toM(query)
+	if err != nil {
+		return nil, err
+	}
+	change, err := toM(update)
+	if err != nil {
+		return nil, err
+	}
+
+	ms.m.Lock()
+	defer ms.m.Unlock()
+	docs, err := ms.docs(name)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &memUpdate{}
+	for i, doc := range docs {
+		ok, err := matchFilter(doc, filter)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if docs[i], err = applyUpdate(doc, change); err != nil {
+			return nil, err
+		}
+		res.matched++
+		if !equalValues(doc, docs[i]) {
+			res.modified++
+		}
+		res.docs = append(res.docs, docs[i])
+		if !multi {
+			break
+		}
+	}
+
+	if res.matched == 0 && upsert {
+		doc, err := applyUpdate(upsertSeed(filter), change)
+		if err != nil {
+			return nil, err
+		}
+		if err = setOnInsert(doc, change); err != nil {
+			return nil, err
+		}
+		if err = insertDoc(&docs, doc); err != nil {
+			return nil, err
+		}
+		res.upsertedID = doc["_id"]
+		res.docs = append(res.docs, doc)
+	}
+	return res, ms.store(name, docs)
+}
+
+func (ms *MemorySession) GetNextSequence(name string) (int32, error) {
+	return ms.GetNextSequenceCtx(context.TODO(), name)
+}
+
+func (ms *MemorySession) GetNextSequenceCtx(ctx context.Context, name string) (int32, error) {
+	res, err := ms.update(SequenceCollection, bson.M{"_id": name}, bson.M{"$inc": bson.M{"seq": 1}}, false, true)
+	if err != nil {
+		return -1, err
+	}
+	seq, _ := toFloat(res.docs[0]["seq"])
+	return int32(seq), nil
+}
+
+func (ms *MemorySession) FindOneAndUpdate(name string, filter, update interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return ms.FindOneAndUpdateCtx(context.TODO(), name, filter, update, opt, result)
+}
+
+func (ms *MemorySession) FindOneAndUpdateCtx(ctx context.Context, name string, filter, update interface{}, opt FindAndModifyOptions, result interface{}) error {
+	change, err := toM(update)
+	if err != nil {
+		return err
+	}
+	if _, ok := isOperatorDoc(change); !ok {
+		return fmt.Errorf("update document must contain only update operators")
+	}
+	err = ms.findAndModify(name, filter, change, opt, result)
+	return wrapErr("FindOneAndUpdate", name, err)
+}
+
+func (ms *MemorySession) FindOneAndReplace(name string, filter, replacement interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return ms.FindOneAndReplaceCtx(context.TODO(), name, filter, replacement, opt, result)
+}
+
+func (ms *MemorySession) FindOneAndReplaceCtx(ctx context.Context, name string, filter, replacement interface{}, opt FindAndModifyOptions, result interface{}) error {
+	change, err := toM(replacement)
+	if err != nil {
+		return err
+	}
+	if _, ok := isOperatorDoc(change); ok {
+		return fmt.Errorf("replacement document cannot contain update operators")
+	}
+	err = ms.findAndModify(name, filter, change, opt, result)
+	return wrapErr("FindOneAndReplace", name, err)
+}
+
+func (ms *MemorySession) FindOneAndDelete(name string, filter interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return ms.FindOneAndDeleteCtx(context.TODO(), name, filter, opt, result)
+}
+
+func (ms *MemorySession) FindOneAndDeleteCtx(ctx context.Context, name string, filter interface{}, opt FindAndModifyOptions, result interface{}) error {
+	err := ms.findAndModify(name, filter, nil, FindAndModifyOptions{Sort: opt.Sort, Projection: opt.Projection}, result)
+	return wrapErr("FindOneAndDelete", name, err)
+}
+
+// findAndModify updates or, when change is nil, deletes the first matching
+// document in the sort order and decodes the document before or after into result
+func (ms *MemorySession) findAndModify(name string, query interface{}, change bson.M, opt FindAndModifyOptions, result interface{}) error {
+	filter, err := toM(query)
+	if err != nil {
+		return err
+	}
+
+	ms.m.Lock()
+	defer ms.m.Unlock()
+	docs, err := ms.docs(name)
+	if err != nil {
+		return err
+	}
+
+	matched := make([]bson.M, 0)
+	for _, doc := range docs {
+		ok, err := matchFilter(doc, filter)
+		if err != nil {
+			return err
+		}
+		if ok {
+			matched = append(matched, doc)
+		}
+	}
+	if opt.Sort != nil {
+		spec, err := toD(opt.Sort)
+		if err != nil {
+			return err
+		}
+		sortDocs(matched, spec)
+	}
+
+	var before, after bson.M
+	switch {
+	case len(matched) > 0:
+		before = matched[0]
+		for i, doc := range docs {
+			if !equalValues(doc["_id"], before["_id"]) {
+				continue
+			}
+			if change == nil {
+				docs = append(docs[:i], docs[i+1:]...)
+			} else if after, err = applyUpdate(doc, change); err != nil {
+				return err
+			} else {
+				docs[i] = after
+			}
+			break
+		}
+	case change != nil && opt.Upsert:
+		if after, err = applyUpdate(upsertSeed(filter), change); err != nil {
+			return err
+		}
+		if err = setOnInsert(after, change); err != nil {
+			return err
+		}
+		if err = insertDoc(&docs, after); err != nil {
+			return err
+		}
+	}
+	if err = ms.store(name, docs); err != nil {
+		return err
+	}
+
+	doc := before
+	if opt.ReturnNew {
+		doc = after
+	}
+	if doc == nil {
+		return ErrNotFound
+	}
+	if opt.Projection != nil {
+		spec, err := toD(opt.Projection)
+		if err != nil {
+			return err
+		}
+		doc = project(doc, spec)
+	}
+	return decodeOne(doc, result)
+}
+
+func (ms *MemorySession) FindWithDistinct(name, distinct string, query interface{}) ([]interface{}, error) {
+	return ms.FindWithDistinctCtx(context.TODO(), name, distinct, query)
+}
+
+func (ms *MemorySession) FindWithDistinctCtx(ctx context.Context, name, distinct string, query interface{}) ([]interface{}, error) {
+	ms.m.RLock()
+	defer ms.m.RUnlock()
+	docs, err := ms.find(name, query, nil, nil, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]interface{}, 0)
+	for _, doc := range docs {
+		for _, v := range expandDistinct(lookup(doc, distinct)) {
+			if !matchEq(result, v) {
+				result = append(result, v)
+			}
+		}
+	}
+	return result, nil
+}
+
+// expandDistinct unwinds array values like the distinct command
+func expandDistinct(values []interface{}) []interface{} {
+	var out []interface{}
+	for _, v := range values {
+		if l, ok := toList(v); ok {
+			out = append(out, l...)
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+func (ms *MemorySession) ForEach(name string, query interface{}, fn func(raw bson.Raw) error) error {
+	return ms.ForEachCtx(context.TODO(), name, query, fn)
+}
+
+func (ms *MemorySession) ForEachCtx(ctx context.Context, name string, query interface{}, fn func(raw bson.Raw) error) error {
+	ms.m.RLock()
+	docs, err := ms.find(name, query, nil, nil, 0, 0)
+	ms.m.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		if err = fn(raw); err != nil {
+			if err == ErrStopIter {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (ms *MemorySession) BulkWrite(name string, b *Bulk) (*BulkResult, error) {
+	return ms.BulkWriteCtx(context.TODO(), name, b)
+}
+
+// BulkWriteCtx runs the operations one by one, it is not atomic
+func (ms *MemorySession) BulkWriteCtx(ctx context.Context, name string, b *Bulk) (*BulkResult, error) {
+	result := &BulkResult{}
+	if b == nil || b.Len() == 0 {
+		return result, ErrEmptyBulk
+	}
+
+	bulkErr := &BulkError{}
+	for i, op := range b.ops {
+		var err error
+		switch op.kind {
+		case bulkInsert:
+			if err = ms.InsertCtx(ctx, name, op.doc); err == nil {
+				result.InsertedCount++
+			}
+		case bulkUpdateOne, bulkUpdateMany, bulkReplaceOne:
+			var res *memUpdate
+			res, err = ms.update(name, op.filter, op.doc, op.kind == bulkUpdateMany, op.upsert)
+			if err == nil {
+				result.MatchedCount += res.matched
+				result.ModifiedCount += res.modified
+				if res.upsertedID != nil {
+					if result.UpsertedIDs == nil {
+						result.UpsertedIDs = map[int64]interface{}{}
+					}
+					result.UpsertedCount++
+					result.UpsertedIDs[int64(i)] = res.upsertedID
+				}
+			}
+		case bulkDeleteOne, bulkDeleteMany:
+			var n int64
+			n, err = ms.remove(name, op.filter, op.kind == bulkDeleteMany)
+			result.DeletedCount += n
+		}
+
+		if err != nil {
+			opErr := BulkOpError{Index: i, Message: err.Error()}
+			if errors.Is(err, ErrIsDuplicate) {
+				opErr.Code = 11000
+			}
+			bulkErr.Errors = append(bulkErr.Errors, opErr)
+			if b.ordered {
+				break
+			}
+		}
+	}
+
+	if len(bulkErr.Errors) > 0 {
+		return result, bulkErr
+	}
+	return result, nil
+}
+
+// SyncIndexes records the declared indexes, they are not enforced
+func (ms *MemorySession) SyncIndexes(ctx context.Context, specs []IndexSpec, opt IndexSyncOptions) (*IndexDiff, error) {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+	if ms.indexes == nil {
+		ms.indexes = map[string][]IndexSpec{}
+	}
+
+	diff := &IndexDiff{}
+	names, groups := groupIndexes(specs)
+	for _, name := range names {
+		var existing []existingIndex
+		for _, spec := range ms.indexes[name] {
+			filter, _ := toM(spec.PartialFilter)
+			existing = append(existing, existingIndex{
+				Name:               spec.IndexName(),
+				Key:                spec.KeysDoc(),
+				Unique:             spec.Unique,
+				Sparse:             spec.Sparse,
+				ExpireAfterSeconds: spec.ExpireAfterSeconds,
+				PartialFilter:      filter,
+			})
+		}
+		diffIndexes(name, groups[name], existing, diff)
+	}
+	if opt.DryRun {
+		return diff, nil
+	}
+
+	for _, name := range names {
+		old := map[string]IndexSpec{}
+		for _, spec := range ms.indexes[name] {
+			old[spec.IndexName()] = spec
+		}
+		kept := make([]IndexSpec, 0, len(groups[name]))
+		for _, spec := range groups[name] {
+			// 不一致的索引只有DropExtra时才重建
+			if prev, ok := old[spec.IndexName()]; ok && !opt.DropExtra {
+				spec = prev
+			}
+			delete(old, spec.IndexName())
+			kept = append(kept, spec)
+		}
+		if !opt.DropExtra {
+			for _, spec := range old {
+				kept = append(kept, spec)
+			}
+		}
+		ms.indexes[name] = kept
+	}
+	return diff, nil
+}
+
+// Watch is not supported in memory
+func (ms *MemorySession) Watch(ctx context.Context, name string, pipeline interface{}, opt WatchOptions) (*ChangeStream, error) {
+	return nil, ErrNotSupported
+}
+
+// WithTransaction snapshots the data and restores it when fn fails.
+// It is not isolated from concurrent writers.
+func (ms *MemorySession) WithTransaction(ctx context.Context, fn func(tx DBAdaptor) error, opts ...*options.TransactionOptions) error {
+	ms.m.Lock()
+	if ms.inTx {
+		ms.m.Unlock()
+		return fn(ms)
+	}
+	snapshot := make(map[string][]bson.Raw, len(ms.data))
+	for name, raws := range ms.data {
+		snapshot[name] = append([]bson.Raw(nil), raws...)
+	}
+	ms.inTx = true
+	ms.m.Unlock()
+
+	err := fn(ms)
+
+	ms.m.Lock()
+	defer ms.m.Unlock()
+	ms.inTx = false
+	if err != nil {
+		ms.data = snapshot
+	}
+	return err
+}
@@ -0,0 +1,649 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: 内存版DBAdaptor的查询/更新求值
+
+package lib_mongo
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// toM converts any bson document (bson.M, bson.D, struct, nil ...) to bson.M
+func toM(v interface{}) (bson.M, error) {
+	if v == nil {
+		return bson.M{}, nil
+	}
+	if raw, ok := v.(bson.Raw); ok {
+		m := bson.M{}
+		err := bson.Unmarshal(raw, &m)
+		return m, err
+	}
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := bson.M{}
+	err = bson.Unmarshal(data, &m)
+	return m, err
+}
+
+// toD converts any bson document to bson.D, keeping the key order
+func toD(v interface{}) (bson.D, error) {
+	if v == nil {
+		return bson.D{}, nil
+	}
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	d := bson.D{}
+	err = bson.Unmarshal(data, &d)
+	return d, err
+}
+
+// toList converts a pipeline or an array value to a slice
+func toList(v interface{}) ([]interface{}, bool) {
+	switch l := v.(type) {
+	case primitive.A:
+		return l, true
+	case []interface{}:
+		return l, true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	// bson.D is a slice as well but a document
+	if _, ok := v.(bson.D); ok {
+		return nil, false
+	}
+	l := make([]interface{}, rv.Len())
+	for i := range l {
+		l[i] = rv.Index(i).Interface()
+	}
+	return l, true
+}
+
+// asM returns v as bson.M when it is an embedded document
+func asM(v interface{}) (bson.M, bool) {
+	switch d := v.(type) {
+	case bson.M:
+		return d, true
+	case map[string]interface{}:
+		return d, true
+	case bson.D:
+		return d.Map(), true
+	}
+	return nil, false
+}
+
+// lookup returns every value found at the dotted path, arrays on the way are traversed
+func lookup(v interface{}, path string) []interface{} {
+	if path == "" {
+		return []interface{}{v}
+	}
+	key, rest := path, ""
+	if i := strings.IndexByte(path, '.'); i >= 0 {
+		key, rest = path[:i], path[i+1:]
+	}
+
+	if m, ok := asM(v); ok {
+		child, exist := m[key]
+		if !exist {
+			return nil
+		}
+		if rest == "" {
+			return []interface{}{child}
+		}
+		return lookup(child, rest)
+	}
+
+	if l, ok := toList(v); ok {
+		if idx, err := strconv.Atoi(key); err == nil {
+			if idx < 0 || idx >= len(l) {
+				return nil
+			}
+			return lookup(l[idx], rest)
+		}
+		var values []interface{}
+		for _, elem := range l {
+			values = append(values, lookup(elem, path)...)
+		}
+		return values
+	}
+	return nil
+}
+
+// setPath sets the value at the dotted path, missing documents are created
+func setPath(doc bson.M, path string, value interface{}) error {
+	keys := strings.Split(path, ".")
+	cur := doc
+	for _, key := range keys[:len(keys)-1] {
+		next, exist := cur[key]
+		if !exist || next == nil {
+			m := bson.M{}
+			cur[key] = m
+			cur = m
+			continue
+		}
+		m, ok := asM(next)
+		if !ok {
+			return fmt.Errorf("cannot create field %q in element of type %T", path, next)
+		}
+		cur[key] = m
+		cur = m
+	}
+	cur[keys[len(keys)-1]] = value
+	return nil
+}
+
+// unsetPath removes the value at the dotted path
+func unsetPath(doc bson.M, path string) {
+	keys := strings.Split(path, ".")
+	cur := doc
+	for _, key := range keys[:len(keys)-1] {
+		m, ok := asM(cur[key])
+		if !ok {
+			return
+		}
+		cur = m
+	}
+	delete(cur, keys[len(keys)-1])
+}
+
+// isOperatorDoc reports whether v is an operator expression like {"$gt": 1}
+func isOperatorDoc(v interface{}) (bson.M, bool) {
+	m, ok := asM(v)
+	if !ok || len(m) == 0 {
+		return nil, false
+	}
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return nil, false
+		}
+	}
+	return m, true
+}
+
+// matchFilter reports whether doc matches filter
+func matchFilter(doc, filter bson.M) (bool, error) {
+	for key, cond := range filter {
+		var ok bool
+		var err error
+		switch key {
+		case "$and", "$or", "$nor":
+			ok, err = matchLogical(doc, key, cond)
+		default:
+			if strings.HasPrefix(key, "$") {
+				return false, fmt.Errorf("unsupported query operator %s", key)
+			}
+			ok, err = matchField(lookup(doc, key), cond)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchLogical(doc bson.M, op string, cond interface{}) (bool, error) {
+	clauses, ok := toList(cond)
+	if !ok || len(clauses) == 0 {
+		return false, fmt.Errorf("%s must be a nonempty array", op)
+	}
+	for _, clause := range clauses {
+		sub, ok := asM(clause)
+		if !ok {
+			return false, fmt.Errorf("%s entries must be documents", op)
+		}
+		matched, err := matchFilter(doc, sub)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case op == "$and" && !matched:
+			return false, nil
+		case op == "$or" && matched:
+			return true, nil
+		case op == "$nor" && matched:
+			return false, nil
+		}
+	}
+	return op != "$or", nil
+}
+
+// matchField matches the values found at a path against a condition
+func matchField(values []interface{}, cond interface{}) (bool, error) {
+	ops, ok := isOperatorDoc(cond)
+	if !ok {
+		return matchEq(values, cond), nil
+	}
+	for op, arg := range ops {
+		matched, err := matchOperator(values, op, arg)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchOperator(values []interface{}, op string, arg interface{}) (bool, error) {
+	switch op {
+	case "$eq":
+		return matchEq(values, arg), nil
+	case "$ne":
+		return !matchEq(values, arg), nil
+	case "$in", "$nin":
+		list, ok := toList(arg)
+		if !ok {
+			return false, fmt.Errorf("%s needs an array", op)
+		}
+		in := false
+		for _, want := range list {
+			if matchEq(values, want) {
+				in = true
+				break
+			}
+		}
+		return in == (op == "$in"), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		for _, v := range expand(values) {
+			c, ok := compareValues(v, arg)
+			if !ok {
+				continue
+			}
+			if (op == "$gt" && c > 0) || (op == "$gte" && c >= 0) || (op == "$lt" && c < 0) || (op == "$lte" && c <= 0) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$exists":
+		return (len(values) > 0) == truthy(arg), nil
+	case "$not":
+		matched, err := matchField(values, arg)
+		return !matched, err
+	}
+	return false, fmt.Errorf("unsupported query operator %s", op)
+}
+
+// expand flattens array values one level, the way mongo matches array fields
+func expand(values []interface{}) []interface{} {
+	var out []interface{}
+	for _, v := range values {
+		out = append(out, v)
+		if l, ok := toList(v); ok {
+			out = append(out, l...)
+		}
+	}
+	return out
+}
+
+func matchEq(values []interface{}, want interface{}) bool {
+	if want == nil && len(values) == 0 {
+		return true
+	}
+	for _, v := range expand(values) {
+		if equalValues(v, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func truthy(v interface{}) bool {
+	switch b := v.(type) {
+	case bool:
+		return b
+	case nil:
+		return false
+	}
+	if f, ok := toFloat(v); ok {
+		return f != 0
+	}
+	return true
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// typeRank follows the mongo BSON comparison order
+func typeRank(v interface{}) int {
+	switch v.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return 1
+	case int, int32, int64, float32, float64, primitive.Decimal128:
+		return 2
+	case string, primitive.Symbol:
+		return 3
+	case bson.M, bson.D, map[string]interface{}:
+		return 4
+	case primitive.A, []interface{}:
+		return 5
+	case primitive.Binary, []byte:
+		return 6
+	case primitive.ObjectID:
+		return 7
+	case bool:
+		return 8
+	case primitive.DateTime, time.Time:
+		return 9
+	case primitive.Timestamp:
+		return 10
+	case primitive.Regex:
+		return 11
+	}
+	return 12
+}
+
+// compareValues compares two values of the same type bracket
+func compareValues(a, b interface{}) (int, bool) {
+	ra, rb := typeRank(a), typeRank(b)
+	if ra != rb {
+		return 0, false
+	}
+	switch ra {
+	case 1:
+		return 0, true
+	case 2:
+		fa, _ := toFloat(a)
+		fb, _ := toFloat(b)
+		switch {
+		case fa < fb:
+			return -1, true
+		case fa > fb:
+			return 1, true
+		}
+		return 0, true
+	case 3:
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b)), true
+	case 7:
+		x, y := a.(primitive.ObjectID), b.(primitive.ObjectID)
+		return bytes.Compare(x[:], y[:]), true
+	case 8:
+		x, y := a.(bool), b.(bool)
+		switch {
+		case x == y:
+			return 0, true
+		case !x:
+			return -1, true
+		}
+		return 1, true
+	case 9:
+		x, y := toTime(a), toTime(b)
+		switch {
+		case x.Before(y):
+			return -1, true
+		case x.After(y):
+			return 1, true
+		}
+		return 0, true
+	case 10:
+		x, y := a.(primitive.Timestamp), b.(primitive.Timestamp)
+		return primitive.CompareTimestamp(x, y), true
+	}
+	if reflect.DeepEqual(a, b) {
+		return 0, true
+	}
+	return 0, false
+}
+
+func toTime(v interface{}) time.Time {
+	if dt, ok := v.(primitive.DateTime); ok {
+		return dt.Time()
+	}
+	return v.(time.Time)
+}
+
+func equalValues(a, b interface{}) bool {
+	if c, ok := compareValues(a, b); ok && c == 0 {
+		return true
+	}
+	if x, ok := asM(a); ok {
+		y, ok := asM(b)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			w, exist := y[k]
+			if !exist || !equalValues(v, w) {
+				return false
+			}
+		}
+		return true
+	}
+	if x, ok := toList(a); ok {
+		y, ok := toList(b)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equalValues(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// sortDocs sorts docs in place following a sort spec like bson.D{{"age", -1}}
+func sortDocs(docs []bson.M, spec bson.D) {
+	if len(spec) == 0 {
+		return
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, e := range spec {
+			a, b := firstValue(docs[i], e.Key), firstValue(docs[j], e.Key)
+			c, ok := compareValues(a, b)
+			if !ok {
+				c = typeRank(a) - typeRank(b)
+			}
+			if c == 0 {
+				continue
+			}
+			if f, _ := toFloat(e.Value); f < 0 {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+func firstValue(doc bson.M, path string) interface{} {
+	values := lookup(doc, path)
+	if len(values) == 0 {
+		return nil
+	}
+	return values[0]
+}
+
+// project applies an inclusion or exclusion projection
+func project(doc bson.M, spec bson.D) bson.M {
+	if len(spec) == 0 {
+		return doc
+	}
+	include := false
+	for _, e := range spec {
+		if e.Key != "_id" && truthy(e.Value) {
+			include = true
+			break
+		}
+	}
+
+	if !include {
+		out := copyM(doc)
+		for _, e := range spec {
+			if !truthy(e.Value) {
+				unsetPath(out, e.Key)
+			}
+		}
+		return out
+	}
+
+	out := bson.M{}
+	if id, ok := doc["_id"]; ok {
+		out["_id"] = id
+	}
+	for _, e := range spec {
+		if e.Key == "_id" {
+			if !truthy(e.Value) {
+				delete(out, "_id")
+			}
+			continue
+		}
+		if values := lookup(doc, e.Key); len(values) > 0 {
+			_ = setPath(out, e.Key, values[0])
+		}
+	}
+	return out
+}
+
+func copyM(doc bson.M) bson.M {
+	out, _ := toM(doc)
+	return out
+}
+
+// applyUpdate applies $set/$inc/$unset or a replacement document to doc
+func applyUpdate(doc, update bson.M) (bson.M, error) {
+	if _, ok := isOperatorDoc(update); !ok {
+		out := copyM(update)
+		if id, ok := doc["_id"]; ok {
+			out["_id"] = id
+		}
+		return out, nil
+	}
+
+	out := copyM(doc)
+	for op, arg := range update {
+		fields, ok := asM(arg)
+		if !ok {
+			return nil, fmt.Errorf("modifier %s needs a document", op)
+		}
+		for path, value := range fields {
+			switch op {
+			case "$set", "$setOnInsert":
+				if op == "$setOnInsert" {
+					continue
+				}
+				if err := setPath(out, path, value); err != nil {
+					return nil, err
+				}
+			case "$unset":
+				unsetPath(out, path)
+			case "$inc":
+				sum, err := incValue(firstValue(out, path), value)
+				if err != nil {
+					return nil, err
+				}
+				if err = setPath(out, path, sum); err != nil {
+					return nil, err
+				}
+			default:
+				return nil, fmt.Errorf("unsupported update operator %s", op)
+			}
+		}
+	}
+	return out, nil
+}
+
+// incValue adds delta to cur keeping the widest numeric type
+func incValue(cur, delta interface{}) (interface{}, error) {
+	if cur == nil {
+		cur = int32(0)
+	}
+	a, okA := toFloat(cur)
+	b, okB := toFloat(delta)
+	if !okA || !okB {
+		return nil, fmt.Errorf("cannot apply $inc to a value of non-numeric type %T", cur)
+	}
+	switch {
+	case isFloat(cur) || isFloat(delta):
+		return a + b, nil
+	case isInt64(cur) || isInt64(delta):
+		return int64(a) + int64(b), nil
+	}
+	return int32(a) + int32(b), nil
+}
+
+func isFloat(v interface{}) bool {
+	switch v.(type) {
+	case float32, float64:
+		return true
+	}
+	return false
+}
+
+func isInt64(v interface{}) bool {
+	switch v.(type) {
+	case int64, int:
+		return true
+	}
+	return false
+}
+
+// upsertSeed builds the base document of an upsert from the equality fields of filter
+func upsertSeed(filter bson.M) bson.M {
+	doc := bson.M{}
+	for key, cond := range filter {
+		if key == "$and" {
+			// 与mongod一致，$and中的等值条件也写入新文档
+			conds, _ := toList(cond)
+			for _, c := range conds {
+				if m, ok := asM(c); ok {
+					for k, v := range upsertSeed(m) {
+						_ = setPath(doc, k, v)
+					}
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(key, "$") {
+			continue
+		}
+		if ops, ok := isOperatorDoc(cond); ok {
+			if eq, ok := ops["$eq"]; ok {
+				_ = setPath(doc, key, eq)
+			}
+			continue
+		}
+		_ = setPath(doc, key, cond)
+	}
+	return doc
+}
+
+// setOnInsert applies the $setOnInsert fields of update to a new document
+func setOnInsert(doc, update bson.M) error {
+	fields, ok := asM(update["$setOnInsert"])
+	if !ok {
+		return nil
+	}
+	for path, value := range fields {
+		if err := setPath(doc, path, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc:
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMemorySession(t *testing.T) {
+	type profile struct {
+		ID    int32    `bson:"_id"`
+		Name  string   `bson:"name"`
+		Age   int32    `bson:"age"`
+		Tags  []string `bson:"tags,omitempty"`
+		Score int64    `bson:"score,omitempty"`
+	}
+
+	Convey("test memory adaptor", t, func() {
+		var ms DBAdaptor = NewMemorySession()
+		err := ms.InsertAll("profile",
+			&profile{ID: 1, Name: "alice", Age: 30, Tags: []string{"vip"}},
+			&profile{ID: 2, Name: "bob", Age: 20},
+			&profile{ID: 3, Name: "carol", Age: 40, Tags: []string{"vip", "new"}},
+		)
+		So(err, ShouldBeNil)
+
+		Convey("test query operators", func() {
+			var docs []profile
+			So(ms.FindAll("profile", bson.M{"age": bson.M{"$gt": 20, "$lt": 40}}, &docs), ShouldBeNil)
+			So(len(docs), ShouldEqual, 1)
+			So(docs[0].Name, ShouldEqual, "alice")
+
+			So(ms.FindAll("profile", bson.M{"name": bson.M{"$in": bson.A{"bob", "carol"}}}, &docs), ShouldBeNil)
+			So(len(docs), ShouldEqual, 2)
+
+			So(ms.FindAll("profile", bson.M{"$or": bson.A{bson.M{"age": 20}, bson.M{"tags": "new"}}}, &docs), ShouldBeNil)
+			So(len(docs), ShouldEqual, 2)
+
+			So(ms.FindAll("profile", bson.M{"$and": bson.A{bson.M{"tags": "vip"}, bson.M{"age": bson.M{"$eq": 30}}}}, &docs), ShouldBeNil)
+			So(len(docs), ShouldEqual, 1)
+
+			c, err := ms.FindCount("profile", bson.M{"tags": bson.M{"$exists": false}})
+			So(err, ShouldBeNil)
+			So(c, ShouldEqual, 1)
+
+			var p profile
+			err, exist := ms.FindOne("profile", bson.M{"name": "nobody"}, &p)
+			So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+			So(exist, ShouldBeFalse)
+		})
+
+		Convey("test sort skip limit and projection", func() {
+			var docs []bson.M
+			err := ms.FindWithMultiple("profile", nil, bson.M{"name": 1}, bson.D{{Key: "age", Value: -1}}, &docs, 2, 1)
+			So(err, ShouldBeNil)
+			So(len(docs), ShouldEqual, 2)
+			So(docs[0]["name"], ShouldEqual, "alice")
+			So(docs[1]["name"], ShouldEqual, "bob")
+			_, hasAge := docs[0]["age"]
+			So(hasAge, ShouldBeFalse)
+		})
+
+		Convey("test update operators", func() {
+			So(ms.Update("profile", bson.M{"_id": 2}, bson.M{"name": "bobby"}, false), ShouldBeNil)
+			So(ms.UpdateRaw("profile", bson.M{"tags": "vip"}, bson.M{"$inc": bson.M{"score": int64(5)}, "$unset": bson.M{"tags": ""}}, true), ShouldBeNil)
+
+			var p profile
+			err, _ := ms.FindOne("profile", bson.M{"_id": 2}, &p)
+			So(err, ShouldBeNil)
+			So(p.Name, ShouldEqual, "bobby")
+
+			c, err := ms.FindCount("profile", bson.M{"score": int64(5), "tags": bson.M{"$exists": false}})
+			So(err, ShouldBeNil)
+			So(c, ShouldEqual, 2)
+
+			So(ms.UpdateRaw("profile", bson.M{"_id": 9}, bson.M{"$set": bson.M{"name": "dave"}}, false), ShouldBeNil)
+			err, exist := ms.FindOne("profile", bson.M{"_id": 9}, &p)
+			So(err, ShouldBeNil)
+			So(exist, ShouldBeTrue)
+			So(p.Name, ShouldEqual, "dave")
+		})
+
+		Convey("test remove and duplicate key", func() {
+			So(errors.Is(ms.Insert("profile", &profile{ID: 1}), ErrIsDuplicate), ShouldBeTrue)
+			So(ms.Remove("profile", bson.M{"tags": "vip"}, true), ShouldBeNil)
+			c, err := ms.FindCount("profile", nil)
+			So(err, ShouldBeNil)
+			So(c, ShouldEqual, 1)
+		})
+
+		Convey("test distinct and sequence", func() {
+			tags, err := ms.FindWithDistinct("profile", "tags", nil)
+			So(err, ShouldBeNil)
+			So(len(tags), ShouldEqual, 2)
+
+			seq, err := ms.GetNextSequence("profile")
+			So(err, ShouldBeNil)
+			So(seq, ShouldEqual, 1)
+			seq, err = ms.GetNextSequence("profile")
+			So(err, ShouldBeNil)
+			So(seq, ShouldEqual, 2)
+		})
+
+		Convey("test for each", func() {
+			var names []string
+			err := ms.ForEach("profile", bson.M{"age": bson.M{"$gte": 30}}, func(raw bson.Raw) error {
+				var p profile
+				if err := bson.Unmarshal(raw, &p); err != nil {
+					return err
+				}
+				names = append(names, p.Name)
+				return ErrStopIter
+			})
+			So(err, ShouldBeNil)
+			So(names, ShouldResemble, []string{"alice"})
+		})
+
+		Convey("test find and modify", func() {
+			var p profile
+			opt := FindAndModifyOptions{Sort: bson.D{{Key: "age", Value: -1}}}
+			So(ms.FindOneAndUpdate("profile", bson.M{"tags": "vip"}, bson.M{"$inc": bson.M{"age": 1}}, opt, &p), ShouldBeNil)
+			So(p.Name, ShouldEqual, "carol")
+			So(p.Age, ShouldEqual, 40)
+
+			opt.ReturnNew = true
+			So(ms.FindOneAndUpdate("profile", bson.M{"tags": "vip"}, bson.M{"$inc": bson.M{"age": 1}}, opt, &p), ShouldBeNil)
+			So(p.Age, ShouldEqual, 42)
+
+			err := ms.FindOneAndUpdate("profile", bson.M{"name": "dave"}, bson.M{"$set": bson.M{"age": 50}}, opt, &p)
+			So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+			opt.Upsert = true
+			p = profile{}
+			So(ms.FindOneAndUpdate("profile", bson.M{"_id": 4, "name": "dave"}, bson.M{"$set": bson.M{"age": 50}}, opt, &p), ShouldBeNil)
+			So(p, ShouldResemble, profile{ID: 4, Name: "dave", Age: 50})
+
+			So(ms.FindOneAndReplace("profile", bson.M{"_id": 2}, bson.M{"name": "bobby", "age": 21}, FindAndModifyOptions{ReturnNew: true}, &p), ShouldBeNil)
+			So(p, ShouldResemble, profile{ID: 2, Name: "bobby", Age: 21})
+
+			p = profile{}
+			So(ms.FindOneAndDelete("profile", nil, FindAndModifyOptions{Sort: bson.D{{Key: "age", Value: 1}}, Projection: bson.M{"name": 1}}, &p), ShouldBeNil)
+			So(p, ShouldResemble, profile{ID: 2, Name: "bobby"})
+			c, err := ms.FindCount("profile", nil)
+			So(err, ShouldBeNil)
+			So(c, ShouldEqual, 3)
+		})
+
+		Convey("test bulk write", func() {
+			b := NewBulk().Unordered().
+				Insert(&profile{ID: 1}, &profile{ID: 4, Name: "dave"}).
+				UpdateOne(bson.M{"_id": 2}, bson.M{"$inc": bson.M{"age": 1}}, false).
+				UpdateOne(bson.M{"_id": 5}, bson.M{"$set": bson.M{"name": "eve"}}, true).
+				DeleteMany(bson.M{"tags": "vip"})
+			res, err := ms.BulkWrite("profile", b)
+			So(err, ShouldHaveSameTypeAs, &BulkError{})
+			So(err.(*BulkError).Errors[0].Index, ShouldEqual, 0)
+			So(errors.Is(err, ErrIsDuplicate), ShouldBeTrue)
+			So(res.InsertedCount, ShouldEqual, 1)
+			So(res.ModifiedCount, ShouldEqual, 1)
+			So(res.UpsertedCount, ShouldEqual, 1)
+			So(res.DeletedCount, ShouldEqual, 2)
+
+			_, err = ms.BulkWrite("profile", NewBulk().Insert(&profile{ID: 2}, &profile{ID: 6}))
+			So(err, ShouldNotBeNil)
+			c, err := ms.FindCount("profile", bson.M{"_id": 6})
+			So(err, ShouldBeNil)
+			So(c, ShouldEqual, 0)
+		})
+
+		Convey("test sync indexes", func() {
+			ttl := int32(3600)
+			specs := []IndexSpec{
+				{Collection: "profile", Keys: []string{"name", "-age"}, Unique: true},
+				{Collection: "session", Keys: []string{"create_time"}, ExpireAfterSeconds: &ttl},
+			}
+			diff, err := ms.SyncIndexes(context.TODO(), specs, IndexSyncOptions{DryRun: true})
+			So(err, ShouldBeNil)
+			So(diff.Lines(), ShouldResemble, []string{"+ profile.name_1_age_-1 [name -age]", "+ session.create_time_1 [create_time]"})
+
+			_, err = ms.SyncIndexes(context.TODO(), specs, IndexSyncOptions{})
+			So(err, ShouldBeNil)
+			diff, err = ms.SyncIndexes(context.TODO(), specs[1:], IndexSyncOptions{})
+			So(err, ShouldBeNil)
+			So(diff.Empty(), ShouldBeTrue)
+
+			specs[0].Unique = false
+			diff, err = ms.SyncIndexes(context.TODO(), specs[:1], IndexSyncOptions{})
+			So(err, ShouldBeNil)
+			So(len(diff.Changed), ShouldEqual, 1)
+		})
+
+		Convey("test transaction rollback", func() {
+			err := ms.WithTransaction(context.TODO(), func(tx DBAdaptor) error {
+				if err := tx.RemoveById("profile", 1); err != nil {
+					return err
+				}
+				return errors.New("abort")
+			})
+			So(err, ShouldNotBeNil)
+			c, err := ms.FindCount("profile", nil)
+			So(err, ShouldBeNil)
+			So(c, ShouldEqual, 3)
+		})
+	})
+}
@@ -0,0 +1,313 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: 版本化数据迁移
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	// 已执行的迁移版本，与seq_counters同库
+	MigrationCollection = "schema_migrations"
+	// 迁移锁，同一时间只有一个进程执行迁移
+	MigrationLockCollection = "schema_migrations_lock"
+)
+
+var (
+	ErrDBAhead         = errors.New("database schema is newer than this binary")
+	ErrMigrationLocked = errors.New("migration lock is held by another process")
+	// 迁移过程中锁被其他进程接管
+	ErrMigrationLockLost = errors.New("migration lock was lost")
+)
+
+// Migration is one versioned change of the documents, Down may be nil if it cannot be reverted
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(ctx context.Context, db DBAdaptor) error
+	Down    func(ctx context.Context, db DBAdaptor) error
+}
+
+// AppliedMigration is a record of MigrationCollection
+type AppliedMigration struct {
+	Version   int64     `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+// MigrationStatus compares the registered migrations with the applied ones
+type MigrationStatus struct {
+	Applied []AppliedMigration
+	Pending []Migration
+	// 数据库当前版本，0表示未执行过迁移
+	Current int64
+	// 程序中注册的最新版本
+	Latest int64
+}
+
+var migrationRegistry = struct {
+	sync.Mutex
+	migrations map[int64]Migration
+}{migrations: map[int64]Migration{}}
+
+// RegisterMigration registers a migration, usually from an init function.
+// It panics if the version is registered twice.
+func RegisterMigration(m Migration) {
+	migrationRegistry.Lock()
+	defer migrationRegistry.Unlock()
+	if m.Version <= 0 || m.Up == nil {
+		panic(fmt.Sprintf("lib_mongo: invalid migration %d %s", m.Version, m.Name))
+	}
+	if _, ok := migrationRegistry.migrations[m.Version]; ok {
+		panic(fmt.Sprintf("lib_mongo: migration %d registered twice", m.Version))
+	}
+	migrationRegistry.migrations[m.Version] = m
+}
+
+// RegisteredMigrations returns the registered migrations sorted by version
+func RegisteredMigrations() []Migration {
+	migrationRegistry.Lock()
+	defer migrationRegistry.Unlock()
+	migrations := make([]Migration, 0, len(migrationRegistry.migrations))
+	for _, m := range migrationRegistry.migrations {
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations
+}
+
+// Migrator runs migrations against a DBAdaptor
+type Migrator struct {
+	db         DBAdaptor
+	migrations []Migration
+	// 锁超过该时间未续期视为持有者已退出
+	LockTTL time.Duration
+	// 等待锁的轮询间隔
+	LockPoll time.Duration
+	// 等待锁的超时时间，0表示一直等待直到ctx结束，不限制迁移本身的执行时间
+	LockTimeout time.Duration
+}
+
+// NewMigrator returns a migrator of the registered migrations
+func NewMigrator(db DBAdaptor) *Migrator {
+	return &Migrator{
+		db:         db,
+		migrations: RegisteredMigrations(),
+		LockTTL:    10 * time.Minute,
+		LockPoll:   time.Second,
+	}
+}
+
+// Status returns the applied and pending migrations
+func (m *Migrator) Status(ctx context.Context) (*MigrationStatus, error) {
+	status := &MigrationStatus{}
+	if err := m.db.FindSortByLimitAndSkipCtx(ctx, MigrationCollection, bson.M{}, bson.M{"_id": 1}, &status.Applied, 0, 0); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]bool, len(status.Applied))
+	for _, a := range status.Applied {
+		applied[a.Version] = true
+		if a.Version > status.Current {
+			status.Current = a.Version
+		}
+	}
+	for _, mig := range m.migrations {
+		if mig.Version > status.Latest {
+			status.Latest = mig.Version
+		}
+		if !applied[mig.Version] {
+			status.Pending = append(status.Pending, mig)
+		}
+	}
+	return status, nil
+}
+
+// Check returns ErrDBAhead when the database has migrations this binary does not know
+func (m *Migrator) Check(ctx context.Context) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	return status.Check()
+}
+
+// Check returns ErrDBAhead when Current is newer than Latest
+func (s *MigrationStatus) Check() error {
+	if s.Current > s.Latest {
+		return fmt.Errorf("%w: database at %d, binary at %d", ErrDBAhead, s.Current, s.Latest)
+	}
+	return nil
+}
+
+// Up applies every pending migration in version order and returns them
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	ctx, unlock, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = status.Check(); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, mig := range status.Pending {
+		if err = mig.Up(ctx, m.db); err != nil {
+			return done, fmt.Errorf("migration %d %s: %w", mig.Version, mig.Name, lockErr(ctx, err))
+		}
+		record := &AppliedMigration{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now()}
+		if err = m.db.InsertCtx(ctx, MigrationCollection, record); err != nil {
+			return done, lockErr(ctx, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// Down reverts the last steps applied migrations and returns them
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	ctx, unlock, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[int64]Migration, len(m.migrations))
+	for _, mig := range m.migrations {
+		known[mig.Version] = mig
+	}
+
+	var done []Migration
+	for i := len(status.Applied) - 1; i >= 0 && len(done) < steps; i-- {
+		applied := status.Applied[i]
+		mig, ok := known[applied.Version]
+		if !ok {
+			return done, fmt.Errorf("%w: migration %d is unknown", ErrDBAhead, applied.Version)
+		}
+		if mig.Down == nil {
+			return done, fmt.Errorf("migration %d %s cannot be reverted", mig.Version, mig.Name)
+		}
+		if err = mig.Down(ctx, m.db); err != nil {
+			return done, fmt.Errorf("revert migration %d %s: %w", mig.Version, mig.Name, lockErr(ctx, err))
+		}
+		if err = m.db.RemoveByIdCtx(ctx, MigrationCollection, mig.Version); err != nil {
+			return done, lockErr(ctx, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+type migrationLock struct {
+	ID       string    `bson:"_id"`
+	Owner    string    `bson:"owner"`
+	LockedAt time.Time `bson:"locked_at"`
+}
+
+// lock takes the migration lock, waiting at most LockTimeout. While it is held
+// locked_at is refreshed every LockTTL/3, the returned ctx is canceled with
+// ErrMigrationLockLost when another process took it over, e.g. after the refresh
+// failed for LockTTL.
+func (m *Migrator) lock(ctx context.Context) (context.Context, func(), error) {
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano())
+	if err := m.acquire(ctx, owner); err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.heartbeat(ctx, owner, stop, cancel)
+	}()
+	return ctx, func() {
+		close(stop)
+		<-done
+		cancel(nil)
+		_ = m.db.RemoveCtx(context.Background(), MigrationLockCollection, bson.M{"_id": "lock", "owner": owner}, false)
+	}, nil
+}
+
+// acquire 插入锁文档，已被持有时清理过期的锁后重试
+func (m *Migrator) acquire(ctx context.Context, owner string) error {
+	if m.LockTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.LockTimeout)
+		defer cancel()
+	}
+	for {
+		err := m.db.InsertCtx(ctx, MigrationLockCollection, &migrationLock{ID: "lock", Owner: owner, LockedAt: time.Now()})
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, ErrIsDuplicate) {
+			return err
+		}
+
+		stale := bson.M{"_id": "lock", "locked_at": bson.M{"$lt": time.Now().Add(-m.LockTTL)}}
+		if err = m.db.RemoveCtx(ctx, MigrationLockCollection, stale, false); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %v", ErrMigrationLocked, ctx.Err())
+		case <-time.After(m.LockPoll):
+		}
+	}
+}
+
+// heartbeat 定期续期locked_at直到stop关闭；锁已不属于owner时取消迁移
+func (m *Migrator) heartbeat(ctx context.Context, owner string, stop <-chan struct{}, cancel context.CancelCauseFunc) {
+	if m.LockTTL < 3 {
+		return
+	}
+	ticker := time.NewTicker(m.LockTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// 不能upsert：锁被清理后插入会与新的持有者冲突
+		b := NewBulk().UpdateOne(bson.M{"_id": "lock", "owner": owner}, bson.M{"$set": bson.M{"locked_at": time.Now()}}, false)
+		res, err := m.db.BulkWriteCtx(ctx, MigrationLockCollection, b)
+		if err == nil && res.MatchedCount == 0 {
+			cancel(ErrMigrationLockLost)
+			return
+		}
+		// 续期失败时下次重试，超过LockTTL仍失败才可能被其他进程接管
+	}
+}
+
+// lockErr 锁丢失导致的失败返回ErrMigrationLockLost
+func lockErr(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); errors.Is(cause, ErrMigrationLockLost) {
+		return cause
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc:
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMigrator(t *testing.T) {
+	Convey("test migrator", t, func() {
+		ms := NewMemorySession()
+		ctx := context.TODO()
+		step := func(field string) func(ctx context.Context, db DBAdaptor) error {
+			return func(ctx context.Context, db DBAdaptor) error {
+				return db.UpdateRawCtx(ctx, "profile", bson.M{"_id": 1}, bson.M{"$inc": bson.M{field: 1}}, false)
+			}
+		}
+		migrator := &Migrator{db: ms, LockTTL: time.Minute, LockPoll: time.Millisecond}
+		migrator.migrations = []Migration{
+			{Version: 1, Name: "one", Up: step("up"), Down: step("down")},
+			{Version: 2, Name: "two", Up: step("up"), Down: step("down")},
+		}
+
+		done, err := migrator.Up(ctx)
+		So(err, ShouldBeNil)
+		So(len(done), ShouldEqual, 2)
+
+		status, err := migrator.Status(ctx)
+		So(err, ShouldBeNil)
+		So(status.Current, ShouldEqual, 2)
+		So(len(status.Pending), ShouldEqual, 0)
+
+		Convey("test down", func() {
+			done, err := migrator.Down(ctx, 1)
+			So(err, ShouldBeNil)
+			So(done[0].Version, ShouldEqual, 2)
+			status, err := migrator.Status(ctx)
+			So(err, ShouldBeNil)
+			So(status.Current, ShouldEqual, 1)
+			So(status.Pending[0].Version, ShouldEqual, 2)
+		})
+
+		Convey("test database ahead of binary", func() {
+			migrator.migrations = migrator.migrations[:1]
+			So(errors.Is(migrator.Check(ctx), ErrDBAhead), ShouldBeTrue)
+		})
+
+		Convey("test lock is held", func() {
+			So(ms.Insert(MigrationLockCollection, &migrationLock{ID: "lock", LockedAt: time.Now()}), ShouldBeNil)
+			timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+			defer cancel()
+			_, err := migrator.Up(timeout)
+			So(errors.Is(err, ErrMigrationLocked), ShouldBeTrue)
+		})
+
+		Convey("test lock timeout only bounds waiting for the lock", func() {
+			migrator.LockTimeout = 10 * time.Millisecond
+			migrator.migrations = append(migrator.migrations, Migration{Version: 3, Name: "slow", Up: func(ctx context.Context, db DBAdaptor) error {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(30 * time.Millisecond):
+				}
+				return nil
+			}})
+			done, err := migrator.Up(ctx)
+			So(err, ShouldBeNil)
+			So(len(done), ShouldEqual, 1)
+
+			So(ms.Insert(MigrationLockCollection, &migrationLock{ID: "lock", LockedAt: time.Now()}), ShouldBeNil)
+			_, err = migrator.Up(ctx)
+			So(errors.Is(err, ErrMigrationLocked), ShouldBeTrue)
+		})
+
+		Convey("test heartbeat refreshes the lock", func() {
+			migrator.LockTTL = 30 * time.Millisecond
+			var lockedAt []time.Time
+			read := func(ctx context.Context, db DBAdaptor) error {
+				var l migrationLock
+				if err, _ := db.FindOneCtx(ctx, MigrationLockCollection, bson.M{"_id": "lock"}, &l); err != nil {
+					return err
+				}
+				lockedAt = append(lockedAt, l.LockedAt)
+				return nil
+			}
+			migrator.migrations = append(migrator.migrations, Migration{Version: 3, Name: "slow", Up: func(ctx context.Context, db DBAdaptor) error {
+				if err := read(ctx, db); err != nil {
+					return err
+				}
+				time.Sleep(50 * time.Millisecond)
+				return read(ctx, db)
+			}})
+			_, err := migrator.Up(ctx)
+			So(err, ShouldBeNil)
+			So(lockedAt[1].After(lockedAt[0]), ShouldBeTrue)
+			n, _ := ms.FindCount(MigrationLockCollection, nil)
+			So(n, ShouldEqual, 0)
+		})
+
+		Convey("test lock lost cancels the migration", func() {
+			migrator.LockTTL = 30 * time.Millisecond
+			migrator.migrations = append(migrator.migrations, Migration{Version: 3, Name: "slow", Up: func(ctx context.Context, db DBAdaptor) error {
+				// 模拟锁被其他进程接管
+				if err := db.UpdateRawCtx(ctx, MigrationLockCollection, bson.M{"_id": "lock"}, bson.M{"$set": bson.M{"owner": "other"}}, false); err != nil {
+					return err
+				}
+				<-ctx.Done()
+				return ctx.Err()
+			}})
+			_, err := migrator.Up(ctx)
+			So(errors.Is(err, ErrMigrationLockLost), ShouldBeTrue)
+			status, err := migrator.Status(ctx)
+			So(err, ShouldBeNil)
+			So(status.Current, ShouldEqual, 2)
+		})
+	})
+}
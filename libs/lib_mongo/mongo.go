@@ -5,13 +5,28 @@
 package lib_mongo
 
 import (
+	"context"
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type MongoSession struct {
 	session *Session
 	dbName  string
+	// 事务中绑定的driver session，非事务时为nil
+	txSess mongo.Session
+	// 连接时设置的命令监控
+	monitor *MonitorOptions
+	// 连接前设置的连接池大小
+	poolLimit uint64
+	// 健康检查配置及连接后启动的检查
+	healthOpt *HealthOptions
+	health    *healthMonitor
+	// 全表扫描检查
+	scanGuard *ScanGuardOptions
 }
 
 func NewMongoSession() *MongoSession {
@@ -19,149 +34,345 @@ func NewMongoSession() *MongoSession {
 }
 
 func (ms *MongoSession) Connect(uri, db string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultConnectTimeout)
+	defer cancel()
+	return ms.ConnectCtx(ctx, uri, db)
+}
+
+func (ms *MongoSession) ConnectCtx(ctx context.Context, uri, db string) error {
+	return ms.connect(ctx, New(uri), db)
+}
+
+// ConnectOptions connects with client options, e.g. ClientConfig.ClientOptions
+func (ms *MongoSession) ConnectOptions(opt *options.ClientOptions, db string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultConnectTimeout)
+	defer cancel()
+	return ms.ConnectOptionsCtx(ctx, opt, db)
+}
 
-	ms.session = New(uri)
+func (ms *MongoSession) ConnectOptionsCtx(ctx context.Context, opt *options.ClientOptions, db string) error {
+	return ms.connect(ctx, NewWithOptions(opt), db)
+}
+
+func (ms *MongoSession) connect(ctx context.Context, session *Session, db string) error {
+	ms.session = session
 	ms.dbName = db
+	if ms.poolLimit > 0 {
+		ms.session.SetPoolLimit(ms.poolLimit)
+	}
 	ms.session.SetDB(db)
+	if ms.monitor != nil {
+		ms.session.SetMonitor(*ms.monitor)
+	}
+	if ms.scanGuard != nil {
+		ms.session.SetScanGuard(*ms.scanGuard)
+	}
 
-	err := ms.session.Connect()
+	var health *healthMonitor
+	if ms.healthOpt != nil {
+		health = newHealthMonitor(*ms.healthOpt, ms.session.PingCtx)
+		ms.session.SetServerMonitor(health.serverMonitor())
+	}
+
+	err := ms.session.ConnectCtx(ctx)
 	if err != nil {
 		return err
 	}
+	if health != nil {
+		ms.health = health
+		go health.run()
+	}
 
 	return nil
 }
 
+// Database returns a session on db that shares the client and its pool,
+// Disconnect of either closes the shared client
+func (ms *MongoSession) Database(db string) *MongoSession {
+	return &MongoSession{session: ms.session, dbName: db, txSess: ms.txSess, health: ms.health}
+}
+
+// 命令监控与慢查询，需在Connect之前设置
+func (ms *MongoSession) SetMonitor(opt MonitorOptions) {
+	ms.monitor = &opt
+}
+
+// 首次执行每种查询时explain，报告全表扫描，用于开发与测试环境，需在Connect之前设置
+func (ms *MongoSession) SetScanGuard(opt ScanGuardOptions) {
+	ms.scanGuard = &opt
+}
+
+// 后台健康检查，需在Connect之前设置，Disconnect时停止
+func (ms *MongoSession) SetHealthCheck(opt HealthOptions) {
+	ms.healthOpt = &opt
+}
+
+// Health returns the last health check, HealthUnknown when the check is not enabled
+// and HealthDown while the session is marked down
+func (ms *MongoSession) Health() Health {
+	if ms.session != nil {
+		if err := ms.session.downErr(); err != nil {
+			return Health{Status: HealthDown, Err: err.Error(), CheckedAt: time.Now()}
+		}
+	}
+	if ms.health == nil {
+		return Health{Status: HealthUnknown}
+	}
+	return ms.health.get()
+}
+
+// MarkDown reports the session down with err whatever the pings say, until it is
+// called with nil, e.g. while the schema of a lazy boot is not initialized
+func (ms *MongoSession) MarkDown(err error) {
+	ms.session.markDown(err)
+}
+
+// WaitHealthy blocks until the deployment answers a ping or ctx is done
+func (ms *MongoSession) WaitHealthy(ctx context.Context) error {
+	if ms.health != nil {
+		return ms.health.wait(ctx)
+	}
+	for {
+		err := ms.session.PingCtx(ctx)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return wrapErr("WaitHealthy", "", err)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
 func (ms *MongoSession) Disconnect() {
-	ms.session.m.Lock()
+	if ms.health != nil {
+		ms.health.close()
+	}
 	ms.session.Disconnect()
-	ms.session.m.Unlock()
 }
 
+// 连接池大小，需在Connect之前设置
 func (ms *MongoSession) SetPoolLimit(limit uint64) {
-	ms.session.SetPoolLimit(limit)
+	ms.poolLimit = limit
 }
 
 // 实际操作
 func (ms *MongoSession) FindOne(name string, query, result interface{}) (err error, exist bool) {
+	return ms.FindOneCtx(context.TODO(), name, query, result)
+}
+
+func (ms *MongoSession) FindOneCtx(ctx context.Context, name string, query, result interface{}) (err error, exist bool) {
+	ctx = ms.bindCtx(ctx)
 	exist = true
-	err = ms.session.DB(ms.dbName).C(name).Find(query).One(result)
+	err = ms.session.DB(ms.dbName).C(name).Find(query).OneCtx(ctx, result)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return ErrNotFound, false
+			err = ErrNotFound
 		}
-		return err, false
+		return wrapErr("FindOne", name, err), false
 	}
 
 	return err, exist
 }
 
 func (ms *MongoSession) Find(name string, query, result interface{}, limit int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultFindTimeout)
+	defer cancel()
+	return ms.FindCtx(ctx, name, query, result, limit)
+}
+
+func (ms *MongoSession) FindCtx(ctx context.Context, name string, query, result interface{}, limit int64) error {
+	ctx = ms.bindCtx(ctx)
 	if limit <= 0 {
 		return ErrorLimit
 	}
 
-	err := ms.session.DB(ms.dbName).C(name).Find(query).Limit(limit).All(result)
-	return err
+	err := ms.session.DB(ms.dbName).C(name).Find(query).Limit(limit).AllCtx(ctx, result)
+	return wrapErr("Find", name, err)
 }
 
 func (ms *MongoSession) FindAll(name string, query, result interface{}) error {
-	return ms.session.DB(ms.dbName).C(name).Find(query).All(result)
+	ctx, cancel := context.WithTimeout(context.Background(), defaultFindTimeout)
+	defer cancel()
+	return ms.FindAllCtx(ctx, name, query, result)
+}
+
+func (ms *MongoSession) FindAllCtx(ctx context.Context, name string, query, result interface{}) error {
+	ctx = ms.bindCtx(ctx)
+	err := ms.session.DB(ms.dbName).C(name).Find(query).AllCtx(ctx, result)
+	return wrapErr("FindAll", name, err)
 }
 
 func (ms *MongoSession) FindByLimitAndSkip(name string, query, result interface{}, limit, skip int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultFindTimeout)
+	defer cancel()
+	return ms.FindByLimitAndSkipCtx(ctx, name, query, result, limit, skip)
+}
+
+func (ms *MongoSession) FindByLimitAndSkipCtx(ctx context.Context, name string, query, result interface{}, limit, skip int64) error {
+	ctx = ms.bindCtx(ctx)
 	if limit <= 0 || skip < 0 {
 		return ErrorLimit
 	}
 
-	err := ms.session.DB(ms.dbName).C(name).Find(query).Limit(limit).Skip(skip).All(result)
-	return err
+	err := ms.session.DB(ms.dbName).C(name).Find(query).Limit(limit).Skip(skip).AllCtx(ctx, result)
+	return wrapErr("FindByLimitAndSkip", name, err)
 }
 
 func (ms *MongoSession) FindCount(name string, query interface{}) (int64, error) {
-	return ms.session.DB(ms.dbName).C(name).Count(query)
+	return ms.FindCountCtx(context.TODO(), name, query)
+}
+
+func (ms *MongoSession) FindCountCtx(ctx context.Context, name string, query interface{}) (int64, error) {
+	ctx = ms.bindCtx(ctx)
+	count, err := ms.session.DB(ms.dbName).C(name).CountCtx(ctx, query)
+	return count, wrapErr("FindCount", name, err)
 }
 
 func (ms *MongoSession) FindSortByLimitAndSkip(name string, query interface{}, sorter, result interface{}, limit, skip int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultFindTimeout)
+	defer cancel()
+	return ms.FindSortByLimitAndSkipCtx(ctx, name, query, sorter, result, limit, skip)
+}
+
+func (ms *MongoSession) FindSortByLimitAndSkipCtx(ctx context.Context, name string, query interface{}, sorter, result interface{}, limit, skip int64) error {
+	ctx = ms.bindCtx(ctx)
 	if limit < 0 || skip < 0 {
 		return ErrorLimit
 	}
 
+	var err error
 	if limit == 0 {
-		return ms.session.DB(ms.dbName).C(name).Find(query).Sort(sorter).All(result)
+		err = ms.session.DB(ms.dbName).C(name).Find(query).Sort(sorter).AllCtx(ctx, result)
 	} else {
-		return ms.session.DB(ms.dbName).C(name).Find(query).Sort(sorter).Limit(limit).Skip(skip).All(result)
+		err = ms.session.DB(ms.dbName).C(name).Find(query).Sort(sorter).Limit(limit).Skip(skip).AllCtx(ctx, result)
 	}
+	return wrapErr("FindSortByLimitAndSkip", name, err)
 }
 
 func (ms *MongoSession) FindWithAggregation(name string, pipeline interface{}, result interface{}) error {
-	return ms.session.DB(ms.dbName).C(name).Find(nil).Pipe(pipeline, result)
+	ctx, cancel := context.WithTimeout(context.Background(), defaultPipeTimeout)
+	defer cancel()
+	return ms.FindWithAggregationCtx(ctx, name, pipeline, result)
+}
+
+func (ms *MongoSession) FindWithAggregationCtx(ctx context.Context, name string, pipeline interface{}, result interface{}) error {
+	ctx = ms.bindCtx(ctx)
+	err := ms.session.DB(ms.dbName).C(name).Find(nil).PipeCtx(ctx, pipeline, result)
+	return wrapErr("FindWithAggregation", name, err)
 }
 
 // 删除
 func (ms *MongoSession) Remove(name string, query interface{}, multi bool) error {
+	return ms.RemoveCtx(context.TODO(), name, query, multi)
+}
+
+func (ms *MongoSession) RemoveCtx(ctx context.Context, name string, query interface{}, multi bool) error {
+	ctx = ms.bindCtx(ctx)
+	var err error
 	if multi {
-		return ms.session.DB(ms.dbName).C(name).RemoveAll(query)
+		err = ms.session.DB(ms.dbName).C(name).RemoveAllCtx(ctx, query)
+	} else {
+		err = ms.session.DB(ms.dbName).C(name).RemoveCtx(ctx, query)
 	}
-
-	return ms.session.DB(ms.dbName).C(name).Remove(query)
+	return wrapErr("Remove", name, err)
 }
 
 // 删除by ID
 func (ms *MongoSession) RemoveById(name string, id interface{}) error {
-	return ms.session.DB(ms.dbName).C(name).RemoveID(id)
+	return ms.RemoveByIdCtx(context.TODO(), name, id)
+}
+
+func (ms *MongoSession) RemoveByIdCtx(ctx context.Context, name string, id interface{}) error {
+	ctx = ms.bindCtx(ctx)
+	err := ms.session.DB(ms.dbName).C(name).RemoveIDCtx(ctx, id)
+	return wrapErr("RemoveById", name, err)
 }
 
 // 插入
 func (ms *MongoSession) Insert(name string, doc interface{}) error {
-	err := ms.session.DB(ms.dbName).C(name).Insert(doc)
-	return err
+	return ms.InsertCtx(context.TODO(), name, doc)
+}
+
+func (ms *MongoSession) InsertCtx(ctx context.Context, name string, doc interface{}) error {
+	ctx = ms.bindCtx(ctx)
+	err := ms.session.DB(ms.dbName).C(name).InsertCtx(ctx, doc)
+	return wrapErr("Insert", name, err)
 }
 
 func (ms *MongoSession) InsertAll(name string, docs ...interface{}) error {
-	err := ms.session.DB(ms.dbName).C(name).InsertAll(docs...)
+	return ms.InsertAllCtx(context.TODO(), name, docs...)
+}
 
-	return err
+func (ms *MongoSession) InsertAllCtx(ctx context.Context, name string, docs ...interface{}) error {
+	ctx = ms.bindCtx(ctx)
+	err := ms.session.DB(ms.dbName).C(name).InsertAllCtx(ctx, docs...)
+	return wrapErr("InsertAll", name, err)
 }
 
 // 更新
 func (ms *MongoSession) Update(name string, query interface{}, update interface{}, multi bool) error {
+	return ms.UpdateCtx(context.TODO(), name, query, update, multi)
+}
+
+func (ms *MongoSession) UpdateCtx(ctx context.Context, name string, query interface{}, update interface{}, multi bool) error {
+	ctx = ms.bindCtx(ctx)
 	value := make(bson.M)
 	value["$set"] = update
+	var err error
 	if multi {
-		_, err := ms.session.DB(ms.dbName).C(name).UpdateAll(query, value)
-		return err
+		_, err = ms.session.DB(ms.dbName).C(name).UpdateAllCtx(ctx, query, value)
+	} else {
+		err = ms.session.DB(ms.dbName).C(name).UpdateCtx(ctx, query, value)
 	}
-	return ms.session.DB(ms.dbName).C(name).Update(query, value)
+	return wrapErr("Update", name, err)
 }
 
 // 更新by ID
 func (ms *MongoSession) UpdateById(name string, id interface{}, update interface{}) error {
+	return ms.UpdateByIdCtx(context.TODO(), name, id, update)
+}
+
+func (ms *MongoSession) UpdateByIdCtx(ctx context.Context, name string, id interface{}, update interface{}) error {
+	ctx = ms.bindCtx(ctx)
 	value := make(bson.M)
 	value["$set"] = update
 
-	return ms.session.DB(ms.dbName).C(name).UpdateID(id, value)
+	err := ms.session.DB(ms.dbName).C(name).UpdateIDCtx(ctx, id, value)
+	return wrapErr("UpdateById", name, err)
 }
 
 // 支持Mongodb原始update操作，$set, $inc ...
 func (ms *MongoSession) UpdateRaw(name string, query interface{}, update interface{}, multi bool) error {
+	return ms.UpdateRawCtx(context.TODO(), name, query, update, multi)
+}
+
+func (ms *MongoSession) UpdateRawCtx(ctx context.Context, name string, query interface{}, update interface{}, multi bool) error {
+	ctx = ms.bindCtx(ctx)
+	var err error
 	if multi {
-		_, err := ms.session.DB(ms.dbName).C(name).UpdateAll(query, update, true)
-		return err
+		_, err = ms.session.DB(ms.dbName).C(name).UpdateAllCtx(ctx, query, update, true)
+	} else {
+		err = ms.session.DB(ms.dbName).C(name).UpdateCtx(ctx, query, update, true)
 	}
-
-	return ms.session.DB(ms.dbName).C(name).Update(query, update, true)
+	return wrapErr("UpdateRaw", name, err)
 }
 
 // Int32型自增ID
 func (ms *MongoSession) GetNextSequence(name string) (int32, error) {
+	return ms.GetNextSequenceCtx(context.TODO(), name)
+}
+
+func (ms *MongoSession) GetNextSequenceCtx(ctx context.Context, name string) (int32, error) {
+	ctx = ms.bindCtx(ctx)
 	filter := bson.M{"_id": name}
 	//update := bson.D{{"$inc", bson.M{"seq": 1}}}
 	update := bson.M{"$inc": bson.M{"seq": 1}}
 
-	seq, err := ms.session.DB(ms.dbName).C("seq_counters").FindAndAutoInc(name, filter, update)
+	seq, err := ms.session.DB(ms.dbName).C(SequenceCollection).FindAndAutoIncCtx(ctx, name, filter, update)
 	if err != nil {
-		return -1, err
+		return -1, wrapErr("GetNextSequence", SequenceCollection, err)
 	}
 
 	return seq, nil
@@ -169,42 +380,98 @@ func (ms *MongoSession) GetNextSequence(name string) (int32, error) {
 
 // 支持Select
 func (ms *MongoSession) FindWithSelect(name string, query, selection, result interface{}, limit int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultFindTimeout)
+	defer cancel()
+	return ms.FindWithSelectCtx(ctx, name, query, selection, result, limit)
+}
+
+func (ms *MongoSession) FindWithSelectCtx(ctx context.Context, name string, query, selection, result interface{}, limit int64) error {
+	ctx = ms.bindCtx(ctx)
 	if limit <= 1 {
-		err := ms.session.DB(ms.dbName).C(name).Find(query).Select(selection).One(result)
+		err := ms.session.DB(ms.dbName).C(name).Find(query).Select(selection).OneCtx(ctx, result)
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
-				return ErrNotFound
+				err = ErrNotFound
 			}
-			return err
+			return wrapErr("FindWithSelect", name, err)
 		}
 	}
 
-	return ms.session.DB(ms.dbName).C(name).Find(query).Select(selection).Limit(limit).All(result)
+	err := ms.session.DB(ms.dbName).C(name).Find(query).Select(selection).Limit(limit).AllCtx(ctx, result)
+	return wrapErr("FindWithSelect", name, err)
 }
 
 // Select No Limit
 func (ms *MongoSession) FindSelect(name string, query, selection, result interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultFindTimeout)
+	defer cancel()
+	return ms.FindSelectCtx(ctx, name, query, selection, result)
+}
 
-	return ms.session.DB(ms.dbName).C(name).Find(query).Select(selection).All(result)
+func (ms *MongoSession) FindSelectCtx(ctx context.Context, name string, query, selection, result interface{}) error {
+	ctx = ms.bindCtx(ctx)
+	err := ms.session.DB(ms.dbName).C(name).Find(query).Select(selection).AllCtx(ctx, result)
+	return wrapErr("FindSelect", name, err)
 }
 
 // 综合查询，支持query, selection, sorter, limit, skip
 func (ms *MongoSession) FindWithMultiple(name string, query, selection, sorter, result interface{}, limit, skip int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultFindTimeout)
+	defer cancel()
+	return ms.FindWithMultipleCtx(ctx, name, query, selection, sorter, result, limit, skip)
+}
+
+func (ms *MongoSession) FindWithMultipleCtx(ctx context.Context, name string, query, selection, sorter, result interface{}, limit, skip int64) error {
+	ctx = ms.bindCtx(ctx)
 	if limit < 0 || skip < 0 {
 		return ErrorLimit
 	}
 
+	var err error
 	if limit == 1 {
-		return ms.session.DB(ms.dbName).C(name).Find(query).Select(selection).Sort(sorter).One(result)
+		err = ms.session.DB(ms.dbName).C(name).Find(query).Select(selection).Sort(sorter).OneCtx(ctx, result)
+	} else {
+		err = ms.session.DB(ms.dbName).C(name).Find(query).Select(selection).Sort(sorter).Limit(limit).Skip(skip).AllCtx(ctx, result)
 	}
-
-	return ms.session.DB(ms.dbName).C(name).Find(query).Select(selection).Sort(sorter).Limit(limit).Skip(skip).All(result)
+	return wrapErr("FindWithMultiple", name, err)
 }
 
 func (ms *MongoSession) FindWithDistinct(name, distinct string, query interface{}) ([]interface{}, error) {
-	result, err := ms.session.DB(ms.dbName).C(name).Find(query).Distinct(distinct)
+	ctx, cancel := context.WithTimeout(context.Background(), defaultPipeTimeout)
+	defer cancel()
+	return ms.FindWithDistinctCtx(ctx, name, distinct, query)
+}
+
+func (ms *MongoSession) FindWithDistinctCtx(ctx context.Context, name, distinct string, query interface{}) ([]interface{}, error) {
+	ctx = ms.bindCtx(ctx)
+	result, err := ms.session.DB(ms.dbName).C(name).Find(query).DistinctCtx(ctx, distinct)
 	if err != nil {
-		return nil, err
+		return nil, wrapErr("FindWithDistinct", name, err)
 	}
 	return result, nil
 }
+
+// 流式遍历，不受默认查询超时限制
+func (ms *MongoSession) ForEach(name string, query interface{}, fn func(raw bson.Raw) error) error {
+	return ms.ForEachCtx(context.TODO(), name, query, fn)
+}
+
+func (ms *MongoSession) ForEachCtx(ctx context.Context, name string, query interface{}, fn func(raw bson.Raw) error) error {
+	ctx = ms.bindCtx(ctx)
+	it, err := ms.session.DB(ms.dbName).C(name).Find(query).Iter(ctx)
+	if err != nil {
+		return wrapErr("ForEach", name, err)
+	}
+	return wrapErr("ForEach", name, it.forEach(fn))
+}
+
+// 批量写入，支持ordered/unordered
+func (ms *MongoSession) BulkWrite(name string, b *Bulk) (*BulkResult, error) {
+	return ms.BulkWriteCtx(context.TODO(), name, b)
+}
+
+func (ms *MongoSession) BulkWriteCtx(ctx context.Context, name string, b *Bulk) (*BulkResult, error) {
+	ctx = ms.bindCtx(ctx)
+	res, err := ms.session.DB(ms.dbName).C(name).BulkWriteCtx(ctx, b)
+	return res, wrapErr("BulkWrite", name, err)
+}
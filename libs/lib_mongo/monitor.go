@@ -0,0 +1,347 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: 命令监控，慢查询与连接池指标
+
+package lib_mongo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// CommandEvent describes one finished command
+type CommandEvent struct {
+	Database   string
+	Collection string
+	Command    string
+	Duration   time.Duration
+	// 命令失败时的错误信息
+	Err string
+	// 脱敏后的过滤条件，值均替换为"?"，只在慢命令中提供
+	Filter string
+}
+
+// MonitorOptions configures the command and pool monitors of a session
+type MonitorOptions struct {
+	// 超过该耗时的命令调用OnSlow，0表示不记录慢命令
+	SlowThreshold time.Duration
+	OnSlow        func(ev CommandEvent)
+	// 为nil时使用DefaultMetrics
+	Metrics *Metrics
+	// 连接名，多个连接共用Metrics时作为conn标签区分
+	Name string
+}
+
+// startedCommand is kept from the started event until the command finishes
+type startedCommand struct {
+	collection string
+	// filter的拷贝，started事件的Command在回调返回后失效
+	filter bson.RawValue
+}
+
+type commandKey struct {
+	conn string
+	id   int64
+}
+
+// monitor implements the driver monitors
+type monitor struct {
+	opt     MonitorOptions
+	metrics *Metrics
+	started sync.Map
+}
+
+func newMonitor(opt MonitorOptions) *monitor {
+	m := &monitor{opt: opt, metrics: opt.Metrics}
+	if m.metrics == nil {
+		m.metrics = DefaultMetrics
+	}
+	return m
+}
+
+func (m *monitor) commandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, ev *event.CommandStartedEvent) {
+			cmd := startedCommand{collection: commandCollection(ev.CommandName, ev.Command)}
+			if m.opt.SlowThreshold > 0 {
+				filter := commandFilter(ev.CommandName, ev.Command)
+				cmd.filter = bson.RawValue{Type: filter.Type, Value: append([]byte(nil), filter.Value...)}
+			}
+			m.started.Store(commandKey{ev.ConnectionID, ev.RequestID}, cmd)
+		},
+		Succeeded: func(ctx context.Context, ev *event.CommandSucceededEvent) {
+			m.finished(ev.CommandFinishedEvent, "")
+		},
+		Failed: func(ctx context.Context, ev *event.CommandFailedEvent) {
+			m.finished(ev.CommandFinishedEvent, ev.Failure)
+		},
+	}
+}
+
+func (m *monitor) finished(ev event.CommandFinishedEvent, failure string) {
+	v, _ := m.started.LoadAndDelete(commandKey{ev.ConnectionID, ev.RequestID})
+	cmd, _ := v.(startedCommand)
+	key := metricKey{conn: m.opt.Name, database: ev.DatabaseName, command: ev.CommandName, collection: cmd.collection}
+	m.metrics.observeCommand(key, ev.Duration, failure != "")
+
+	if m.opt.SlowThreshold <= 0 || ev.Duration < m.opt.SlowThreshold || m.opt.OnSlow == nil {
+		return
+	}
+	m.opt.OnSlow(CommandEvent{
+		Database:   ev.DatabaseName,
+		Collection: cmd.collection,
+		Command:    ev.CommandName,
+		Duration:   ev.Duration,
+		Err:        failure,
+		Filter:     redactFilter(cmd.filter),
+	})
+}
+
+func (m *monitor) poolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{Event: func(ev *event.PoolEvent) {
+		m.metrics.observePool(m.opt.Name, ev)
+	}}
+}
+
+// commandCollection returns the collection a command runs on
+func commandCollection(name string, cmd bson.Raw) string {
+	if name == "getMore" {
+		coll, _ := cmd.Lookup("collection").StringValueOK()
+		return coll
+	}
+	elems, err := cmd.Elements()
+	if err != nil || len(elems) == 0 {
+		return ""
+	}
+	// find/insert/update/delete/aggregate等命令的第一个字段为集合名
+	coll, _ := elems[0].Value().StringValueOK()
+	return coll
+}
+
+// commandFilter returns the filter or pipeline of a command, the zero value for other commands
+func commandFilter(name string, cmd bson.Raw) bson.RawValue {
+	switch name {
+	case "find":
+		return cmd.Lookup("filter")
+	case "count", "distinct", "findAndModify":
+		return cmd.Lookup("query")
+	case "aggregate":
+		return cmd.Lookup("pipeline")
+	case "update":
+		return cmd.Lookup("updates", "0", "q")
+	case "delete":
+		return cmd.Lookup("deletes", "0", "q")
+	}
+	return bson.RawValue{}
+}
+
+// redactFilter renders the filter as JSON with every value replaced by "?"
+func redactFilter(filter bson.RawValue) string {
+	if filter.Type != bson.TypeEmbeddedDocument && filter.Type != bson.TypeArray {
+		return ""
+	}
+	data, err := json.Marshal(redactValue(filter))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func redactValue(v bson.RawValue) interface{} {
+	switch v.Type {
+	case bson.TypeEmbeddedDocument:
+		elems, _ := v.Document().Elements()
+		doc := make(map[string]interface{}, len(elems))
+		for _, e := range elems {
+			doc[e.Key()] = redactValue(e.Value())
+		}
+		return doc
+	case bson.TypeArray:
+		values, _ := v.Array().Values()
+		arr := make([]interface{}, 0, len(values))
+		for _, e := range values {
+			arr = append(arr, redactValue(e))
+		}
+		return arr
+	}
+	return "?"
+}
+
+// 命令耗时直方图的桶上限
+var latencyBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 500 * time.Millisecond, time.Second, 5 * time.Second,
+}
+
+type metricKey struct {
+	conn       string
+	database   string
+	command    string
+	collection string
+}
+
+func (k metricKey) labels() string {
+	return fmt.Sprintf("conn=%q,database=%q,command=%q,collection=%q", k.conn, k.database, k.command, k.collection)
+}
+
+// commandStats is the histogram of one command on one collection
+type commandStats struct {
+	count   int64
+	errors  int64
+	sum     time.Duration
+	buckets []int64
+}
+
+// poolStats 一个连接的连接池计数
+type poolStats struct {
+	created        int64
+	closed         int64
+	checkedOut     int64
+	checkedIn      int64
+	checkoutFailed int64
+	poolCleared    int64
+}
+
+// Metrics collects command latencies and connection pool counters, labelled
+// with the connection name of MonitorOptions and the database
+type Metrics struct {
+	m        sync.Mutex
+	commands map[metricKey]*commandStats
+	// 连接名 -> 连接池计数
+	pools map[string]*poolStats
+}
+
+// DefaultMetrics is used by the sessions whose MonitorOptions have no Metrics
+var DefaultMetrics = NewMetrics()
+
+func NewMetrics() *Metrics {
+	return &Metrics{commands: make(map[metricKey]*commandStats), pools: make(map[string]*poolStats)}
+}
+
+func (m *Metrics) observeCommand(key metricKey, d time.Duration, failed bool) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	stats, ok := m.commands[key]
+	if !ok {
+		stats = &commandStats{buckets: make([]int64, len(latencyBuckets))}
+		m.commands[key] = stats
+	}
+	stats.count++
+	stats.sum += d
+	if failed {
+		stats.errors++
+	}
+	for i, le := range latencyBuckets {
+		if d <= le {
+			stats.buckets[i]++
+		}
+	}
+}
+
+func (m *Metrics) observePool(conn string, ev *event.PoolEvent) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	pool, ok := m.pools[conn]
+	if !ok {
+		pool = &poolStats{}
+		m.pools[conn] = pool
+	}
+	switch ev.Type {
+	case event.ConnectionCreated:
+		pool.created++
+	case event.ConnectionClosed:
+		pool.closed++
+	case event.GetSucceeded:
+		pool.checkedOut++
+	case event.ConnectionReturned:
+		pool.checkedIn++
+	case event.GetFailed:
+		pool.checkoutFailed++
+	case event.PoolCleared:
+		pool.poolCleared++
+	}
+}
+
+// CommandCount returns how many times command ran on collection and how many failed,
+// summed over the connections and databases
+func (m *Metrics) CommandCount(command, collection string) (count, errors int64) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	for key, stats := range m.commands {
+		if key.command == command && key.collection == collection {
+			count += stats.count
+			errors += stats.errors
+		}
+	}
+	return count, errors
+}
+
+// WritePrometheus writes the metrics in the Prometheus text format
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	keys := make([]metricKey, 0, len(m.commands))
+	for key := range m.commands {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].labels() < keys[j].labels()
+	})
+	conns := make([]string, 0, len(m.pools))
+	for conn := range m.pools {
+		conns = append(conns, conn)
+	}
+	sort.Strings(conns)
+
+	var err error
+	printf := func(format string, args ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+
+	printf("# HELP mongo_command_duration_seconds Duration of mongo commands.\n")
+	printf("# TYPE mongo_command_duration_seconds histogram\n")
+	for _, key := range keys {
+		stats := m.commands[key]
+		labels := key.labels()
+		for i, le := range latencyBuckets {
+			printf("mongo_command_duration_seconds_bucket{%s,le=\"%g\"} %d\n", labels, le.Seconds(), stats.buckets[i])
+		}
+		printf("mongo_command_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, stats.count)
+		printf("mongo_command_duration_seconds_sum{%s} %g\n", labels, stats.sum.Seconds())
+		printf("mongo_command_duration_seconds_count{%s} %d\n", labels, stats.count)
+	}
+
+	printf("# HELP mongo_command_errors_total Failed mongo commands.\n")
+	printf("# TYPE mongo_command_errors_total counter\n")
+	for _, key := range keys {
+		printf("mongo_command_errors_total{%s} %d\n", key.labels(), m.commands[key].errors)
+	}
+
+	pools := func(name, typ, help string, value func(p *poolStats) int64) {
+		printf("# HELP %s %s\n", name, help)
+		printf("# TYPE %s %s\n", name, typ)
+		for _, conn := range conns {
+			printf("%s{conn=%q} %d\n", name, conn, value(m.pools[conn]))
+		}
+	}
+	pools("mongo_pool_connections", "gauge", "Open connections of the pool.",
+		func(p *poolStats) int64 { return p.created - p.closed })
+	pools("mongo_pool_connections_in_use", "gauge", "Connections checked out of the pool.",
+		func(p *poolStats) int64 { return p.checkedOut - p.checkedIn })
+	pools("mongo_pool_checkout_failed_total", "counter", "Failed connection checkouts.",
+		func(p *poolStats) int64 { return p.checkoutFailed })
+	pools("mongo_pool_cleared_total", "counter", "Times the pool was cleared.",
+		func(p *poolStats) int64 { return p.poolCleared })
+	return err
+}
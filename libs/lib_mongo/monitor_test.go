@@ -0,0 +1,82 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc:
+
+package lib_mongo
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+func TestMonitor(t *testing.T) {
+	Convey("test command monitor", t, func() {
+		var slow []CommandEvent
+		metrics := NewMetrics()
+		m := newMonitor(MonitorOptions{
+			SlowThreshold: 100 * time.Millisecond,
+			OnSlow:        func(ev CommandEvent) { slow = append(slow, ev) },
+			Metrics:       metrics,
+			Name:          "default",
+		})
+		cm := m.commandMonitor()
+		ctx := context.TODO()
+
+		run := func(id int64, cmd bson.D, d time.Duration, failure string) {
+			raw, err := bson.Marshal(cmd)
+			So(err, ShouldBeNil)
+			cm.Started(ctx, &event.CommandStartedEvent{Command: raw, DatabaseName: "db", CommandName: cmd[0].Key, RequestID: id, ConnectionID: "c1"})
+			finished := event.CommandFinishedEvent{Duration: d, CommandName: cmd[0].Key, DatabaseName: "db", RequestID: id, ConnectionID: "c1"}
+			if failure == "" {
+				cm.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: finished})
+			} else {
+				cm.Failed(ctx, &event.CommandFailedEvent{CommandFinishedEvent: finished, Failure: failure})
+			}
+		}
+
+		run(1, bson.D{{Key: "find", Value: "profile"}, {Key: "filter", Value: bson.M{"phone": "13800000000", "age": bson.M{"$gt": 18}}}}, 2*time.Millisecond, "")
+		run(2, bson.D{{Key: "find", Value: "profile"}, {Key: "filter", Value: bson.M{"phone": "13800000000"}}}, 300*time.Millisecond, "")
+		run(3, bson.D{{Key: "update", Value: "orders"}, {Key: "updates", Value: bson.A{bson.M{"q": bson.M{"_id": 1}, "u": bson.M{"$set": bson.M{"paid": true}}}}}}, time.Second, "WriteConflict")
+
+		count, errs := metrics.CommandCount("find", "profile")
+		So(count, ShouldEqual, 2)
+		So(errs, ShouldEqual, 0)
+		count, errs = metrics.CommandCount("update", "orders")
+		So(count, ShouldEqual, 1)
+		So(errs, ShouldEqual, 1)
+
+		So(len(slow), ShouldEqual, 2)
+		So(slow[0].Collection, ShouldEqual, "profile")
+		So(slow[0].Filter, ShouldEqual, `{"phone":"?"}`)
+		So(slow[1].Filter, ShouldEqual, `{"_id":"?"}`)
+		So(slow[1].Err, ShouldEqual, "WriteConflict")
+
+		// 另一个连接的同名库与集合单独统计
+		analytics := newMonitor(MonitorOptions{Metrics: metrics, Name: "analytics"})
+		raw, err := bson.Marshal(bson.D{{Key: "find", Value: "profile"}})
+		So(err, ShouldBeNil)
+		analytics.commandMonitor().Started(ctx, &event.CommandStartedEvent{Command: raw, DatabaseName: "db", CommandName: "find", RequestID: 1, ConnectionID: "c1"})
+		analytics.commandMonitor().Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{
+			Duration: time.Millisecond, CommandName: "find", DatabaseName: "db", RequestID: 1, ConnectionID: "c1"}})
+		count, _ = metrics.CommandCount("find", "profile")
+		So(count, ShouldEqual, 3)
+
+		m.poolMonitor().Event(&event.PoolEvent{Type: event.ConnectionCreated})
+		m.poolMonitor().Event(&event.PoolEvent{Type: event.GetSucceeded})
+		analytics.poolMonitor().Event(&event.PoolEvent{Type: event.ConnectionCreated})
+		var buf bytes.Buffer
+		So(metrics.WritePrometheus(&buf), ShouldBeNil)
+		So(buf.String(), ShouldContainSubstring, `mongo_command_duration_seconds_bucket{conn="default",database="db",command="find",collection="profile",le="0.005"} 1`)
+		So(buf.String(), ShouldContainSubstring, `mongo_command_duration_seconds_count{conn="analytics",database="db",command="find",collection="profile"} 1`)
+		So(buf.String(), ShouldContainSubstring, `mongo_command_errors_total{conn="default",database="db",command="update",collection="orders"} 1`)
+		So(buf.String(), ShouldContainSubstring, `mongo_pool_connections_in_use{conn="default"} 1`)
+		So(buf.String(), ShouldContainSubstring, `mongo_pool_connections_in_use{conn="analytics"} 0`)
+		So(buf.String(), ShouldContainSubstring, `mongo_pool_connections{conn="analytics"} 1`)
+	})
+}
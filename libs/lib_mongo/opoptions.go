@@ -0,0 +1,372 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: 单次操作的读偏好、读写关注、排序规则、索引提示、执行时间上限与注释
+
+package lib_mongo
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// OpOptions are the options of a single operation. Set them on the builder with
+// Collection.Options/Session.Options, or on a ctx with WithOptions so that every
+// DBAdaptor call made with the ctx uses them, except Hint which is only taken from
+// the builder. MemorySession ignores them
+//
+//	// 报表查询走从节点
+//	ctx = lib_mongo.WithOptions(ctx,
+//		lib_mongo.ReadPreference(readpref.SecondaryPreferred()),
+//		lib_mongo.MaxTime(30*time.Second),
+//		lib_mongo.Comment("daily report"))
+//	err := env.MongoCli.FindAllCtx(ctx, "order", query, &orders)
+//
+//	// 关键写入等待多数节点确认
+//	ctx = lib_mongo.WithOptions(ctx, lib_mongo.WriteConcern(writeconcern.Majority()))
+//	err = env.MongoCli.InsertCtx(ctx, "payment", &payment)
+type OpOptions struct {
+	// 读偏好，事务中使用事务的读偏好
+	ReadPreference *readpref.ReadPref
+	// 读关注，事务中使用事务的读关注
+	ReadConcern *readconcern.ReadConcern
+	// 写关注，事务中使用事务的写关注
+	WriteConcern *writeconcern.WriteConcern
+	// 字符串比较规则
+	Collation *options.Collation
+	// 索引名或索引键文档，只能设置在构建器上，distinct与insert不支持
+	Hint interface{}
+	// 服务端执行时间上限，只作用于查询、计数、聚合、distinct与findAndModify
+	MaxTime time.Duration
+	// 记录在profiler与慢查询日志中，便于定位请求来源
+	Comment string
+}
+
+// OpOption sets one field of OpOptions
+type OpOption func(*OpOptions)
+
+// ReadPreference sends the reads to the given members, e.g. readpref.SecondaryPreferred()
+func ReadPreference(rp *readpref.ReadPref) OpOption {
+	return func(o *OpOptions) { o.ReadPreference = rp }
+}
+
+// ReadConcern sets the isolation of the reads, e.g. readconcern.Majority()
+func ReadConcern(rc *readconcern.ReadConcern) OpOption {
+	return func(o *OpOptions) { o.ReadConcern = rc }
+}
+
+// WriteConcern sets the acknowledgement of the writes, e.g. writeconcern.Majority()
+func WriteConcern(wc *writeconcern.WriteConcern) OpOption {
+	return func(o *OpOptions) { o.WriteConcern = wc }
+}
+
+// Collation sets the string comparison rules
+func Collation(c *options.Collation) OpOption {
+	return func(o *OpOptions) { o.Collation = c }
+}
+
+// Hint forces the index, by name or key document. It only applies to the builder
+// it is set on, WithOptions ignores it since an index belongs to one collection
+func Hint(hint interface{}) OpOption {
+	return func(o *OpOptions) { o.Hint = hint }
+}
+
+// MaxTime limits the server side execution time
+func MaxTime(d time.Duration) OpOption {
+	return func(o *OpOptions) { o.MaxTime = d }
+}
+
+// Comment tags the operation in the profiler and the server logs
+func Comment(comment string) OpOption {
+	return func(o *OpOptions) { o.Comment = comment }
+}
+
+func (o OpOptions) apply(opts []OpOption) OpOptions {
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return o
+}
+
+// merge 用other中设置的字段覆盖o
+func (o OpOptions) merge(other OpOptions) OpOptions {
+	if other.ReadPreference != nil {
+		o.ReadPreference = other.ReadPreference
+	}
+	if other.ReadConcern != nil {
+		o.ReadConcern = other.ReadConcern
+	}
+	if other.WriteConcern != nil {
+		o.WriteConcern = other.WriteConcern
+	}
+	if other.Collation != nil {
+		o.Collation = other.Collation
+	}
+	if other.Hint != nil {
+		o.Hint = other.Hint
+	}
+	if other.MaxTime > 0 {
+		o.MaxTime = other.MaxTime
+	}
+	if other.Comment != "" {
+		o.Comment = other.Comment
+	}
+	return o
+}
+
+type opOptionsKey struct{}
+
+// WithOptions returns a ctx carrying opts on top of the options already in ctx,
+// Hint is ignored. GetNextSequence and the index/migration helpers ignore them,
+// the read-modify-write helpers (Mutate, RetryOnConflict, UpdateVersioned,
+// SequenceAllocator) always read from the primary without collation
+func WithOptions(ctx context.Context, opts ...OpOption) context.Context {
+	op := OptionsFrom(ctx).apply(opts)
+	op.Hint = nil
+	return withOpOptions(ctx, op)
+}
+
+// withOpOptions 直接设置ctx上的选项，仅用于把构建器的选项(含Hint)传给单次DBAdaptor调用
+func withOpOptions(ctx context.Context, op OpOptions) context.Context {
+	return context.WithValue(ctx, opOptionsKey{}, op)
+}
+
+// primaryCtx 内部的读-改-写使用的ctx：从节点可能读到旧版本导致反复冲突，
+// 排序规则与索引提示会改变按_id的匹配与计划，只保留读写关注、执行时间上限与注释
+func primaryCtx(ctx context.Context) context.Context {
+	op, ok := ctx.Value(opOptionsKey{}).(OpOptions)
+	if !ok {
+		return ctx
+	}
+	op.ReadPreference = readpref.Primary()
+	op.Collation = nil
+	op.Hint = nil
+	return withOpOptions(ctx, op)
+}
+
+// OptionsFrom returns the options set on ctx by WithOptions
+func OptionsFrom(ctx context.Context) OpOptions {
+	if ctx == nil {
+		return OpOptions{}
+	}
+	op, _ := ctx.Value(opOptionsKey{}).(OpOptions)
+	return op
+}
+
+// resolveOptions 合并ctx与构建器上的选项(构建器优先)，设置了读偏好或读写关注时复制集合
+func resolveOptions(ctx context.Context, coll *mongo.Collection, op OpOptions) (*mongo.Collection, OpOptions) {
+	op = OptionsFrom(ctx).merge(op)
+	if op.ReadPreference == nil && op.ReadConcern == nil && op.WriteConcern == nil {
+		return coll, op
+	}
+	if clone, err := coll.Clone(op.collection()); err == nil {
+		coll = clone
+	}
+	return coll, op
+}
+
+func (o OpOptions) collection() *options.CollectionOptions {
+	opt := options.Collection()
+	if o.ReadPreference != nil {
+		opt.SetReadPreference(o.ReadPreference)
+	}
+	if o.ReadConcern != nil {
+		opt.SetReadConcern(o.ReadConcern)
+	}
+	if o.WriteConcern != nil {
+		opt.SetWriteConcern(o.WriteConcern)
+	}
+	return opt
+}
+
+// 以下按操作类型转换为driver选项，调用方自己的选项放在其后以覆盖这些默认值
+
+func (o OpOptions) find() *options.FindOptions {
+	opt := options.Find()
+	if o.Collation != nil {
+		opt.SetCollation(o.Collation)
+	}
+	if o.Hint != nil {
+		opt.SetHint(o.Hint)
+	}
+	if o.MaxTime > 0 {
+		opt.SetMaxTime(o.MaxTime)
+	}
+	if o.Comment != "" {
+		opt.SetComment(o.Comment)
+	}
+	return opt
+}
+
+func (o OpOptions) findOne() *options.FindOneOptions {
+	opt := options.FindOne()
+	if o.Collation != nil {
+		opt.SetCollation(o.Collation)
+	}
+	if o.Hint != nil {
+		opt.SetHint(o.Hint)
+	}
+	if o.MaxTime > 0 {
+		opt.SetMaxTime(o.MaxTime)
+	}
+	if o.Comment != "" {
+		opt.SetComment(o.Comment)
+	}
+	return opt
+}
+
+func (o OpOptions) aggregate() *options.AggregateOptions {
+	opt := options.Aggregate()
+	if o.Collation != nil {
+		opt.SetCollation(o.Collation)
+	}
+	if o.Hint != nil {
+		opt.SetHint(o.Hint)
+	}
+	if o.MaxTime > 0 {
+		opt.SetMaxTime(o.MaxTime)
+	}
+	if o.Comment != "" {
+		opt.SetComment(o.Comment)
+	}
+	return opt
+}
+
+func (o OpOptions) count() *options.CountOptions {
+	opt := options.Count()
+	if o.Collation != nil {
+		opt.SetCollation(o.Collation)
+	}
+	if o.Hint != nil {
+		opt.SetHint(o.Hint)
+	}
+	if o.MaxTime > 0 {
+		opt.SetMaxTime(o.MaxTime)
+	}
+	if o.Comment != "" {
+		opt.SetComment(o.Comment)
+	}
+	return opt
+}
+
+func (o OpOptions) distinct() *options.DistinctOptions {
+	opt := options.Distinct()
+	if o.Collation != nil {
+		opt.SetCollation(o.Collation)
+	}
+	if o.MaxTime > 0 {
+		opt.SetMaxTime(o.MaxTime)
+	}
+	if o.Comment != "" {
+		opt.SetComment(o.Comment)
+	}
+	return opt
+}
+
+func (o OpOptions) update() *options.UpdateOptions {
+	opt := options.Update()
+	if o.Collation != nil {
+		opt.SetCollation(o.Collation)
+	}
+	if o.Hint != nil {
+		opt.SetHint(o.Hint)
+	}
+	if o.Comment != "" {
+		opt.SetComment(o.Comment)
+	}
+	return opt
+}
+
+func (o OpOptions) delete() *options.DeleteOptions {
+	opt := options.Delete()
+	if o.Collation != nil {
+		opt.SetCollation(o.Collation)
+	}
+	if o.Hint != nil {
+		opt.SetHint(o.Hint)
+	}
+	if o.Comment != "" {
+		opt.SetComment(o.Comment)
+	}
+	return opt
+}
+
+func (o OpOptions) insertOne() *options.InsertOneOptions {
+	opt := options.InsertOne()
+	if o.Comment != "" {
+		opt.SetComment(o.Comment)
+	}
+	return opt
+}
+
+func (o OpOptions) insertMany() *options.InsertManyOptions {
+	opt := options.InsertMany()
+	if o.Comment != "" {
+		opt.SetComment(o.Comment)
+	}
+	return opt
+}
+
+func (o OpOptions) bulkWrite() *options.BulkWriteOptions {
+	opt := options.BulkWrite()
+	if o.Comment != "" {
+		opt.SetComment(o.Comment)
+	}
+	return opt
+}
+
+func (o OpOptions) findOneAndUpdate() *options.FindOneAndUpdateOptions {
+	opt := options.FindOneAndUpdate()
+	if o.Collation != nil {
+		opt.SetCollation(o.Collation)
+	}
+	if o.Hint != nil {
+		opt.SetHint(o.Hint)
+	}
+	if o.MaxTime > 0 {
+		opt.SetMaxTime(o.MaxTime)
+	}
+	if o.Comment != "" {
+		opt.SetComment(o.Comment)
+	}
+	return opt
+}
+
+func (o OpOptions) findOneAndReplace() *options.FindOneAndReplaceOptions {
+	opt := options.FindOneAndReplace()
+	if o.Collation != nil {
+		opt.SetCollation(o.Collation)
+	}
+	if o.Hint != nil {
+		opt.SetHint(o.Hint)
+	}
+	if o.MaxTime > 0 {
+		opt.SetMaxTime(o.MaxTime)
+	}
+	if o.Comment != "" {
+		opt.SetComment(o.Comment)
+	}
+	return opt
+}
+
+func (o OpOptions) findOneAndDelete() *options.FindOneAndDeleteOptions {
+	opt := options.FindOneAndDelete()
+	if o.Collation != nil {
+		opt.SetCollation(o.Collation)
+	}
+	if o.Hint != nil {
+		opt.SetHint(o.Hint)
+	}
+	if o.MaxTime > 0 {
+		opt.SetMaxTime(o.MaxTime)
+	}
+	if o.Comment != "" {
+		opt.SetComment(o.Comment)
+	}
+	return opt
+}
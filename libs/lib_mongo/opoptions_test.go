@@ -0,0 +1,104 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc:
+
+package lib_mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+func TestOpOptions(t *testing.T) {
+	Convey("test op options", t, func() {
+		ctx := WithOptions(context.Background(), MaxTime(time.Second), Comment("report"))
+		ctx = WithOptions(ctx, Comment("daily report"), WriteConcern(writeconcern.Majority()))
+		op := OptionsFrom(ctx)
+		So(op.MaxTime, ShouldEqual, time.Second)
+		So(op.Comment, ShouldEqual, "daily report")
+		So(op.WriteConcern, ShouldNotBeNil)
+		So(OptionsFrom(context.Background()), ShouldResemble, OpOptions{})
+
+		client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://127.0.0.1:27017"))
+		So(err, ShouldBeNil)
+		raw := client.Database("test").Collection("order")
+		c := &Collection{collection: raw}
+
+		Convey("builder options override the ctx", func() {
+			ctx := WithOptions(ctx, Hint("status_1"))
+			coll, op := c.Options(Hint(bson.D{{Key: "created_at", Value: 1}})).Find(nil).resolve(ctx)
+			So(coll, ShouldNotEqual, raw)
+			So(op.Hint, ShouldResemble, bson.D{{Key: "created_at", Value: 1}})
+			So(op.Comment, ShouldEqual, "daily report")
+
+			coll, op = c.resolve(context.Background())
+			So(coll, ShouldEqual, raw)
+			So(op, ShouldResemble, OpOptions{})
+
+			coll, _ = c.Find(nil).Options(ReadPreference(readpref.SecondaryPreferred())).resolve(context.Background())
+			So(coll, ShouldNotEqual, raw)
+		})
+
+		Convey("hint is only taken from the builder", func() {
+			ctx := WithOptions(ctx, Hint("status_1"), Collation(&options.Collation{Locale: "zh"}))
+			So(OptionsFrom(ctx).Hint, ShouldBeNil)
+			_, op := c.Find(nil).resolve(ctx)
+			So(op.Hint, ShouldBeNil)
+			So(op.Collation, ShouldNotBeNil)
+		})
+
+		Convey("read-modify-write helpers read from the primary", func() {
+			ctx := WithOptions(ctx, ReadPreference(readpref.SecondaryPreferred()), Collation(&options.Collation{Locale: "zh"}))
+			var seen OpOptions
+			So(RetryOnConflict(ctx, 1, func(ctx context.Context) error {
+				seen = OptionsFrom(ctx)
+				return nil
+			}), ShouldBeNil)
+			So(seen.ReadPreference.Mode(), ShouldEqual, readpref.PrimaryMode)
+			So(seen.Collation, ShouldBeNil)
+			So(seen.Comment, ShouldEqual, "daily report")
+			So(seen.WriteConcern, ShouldNotBeNil)
+			So(OptionsFrom(ctx).ReadPreference.Mode(), ShouldEqual, readpref.SecondaryPreferredMode)
+
+			So(primaryCtx(context.Background()), ShouldEqual, context.Background())
+		})
+
+		Convey("options are converted per operation", func() {
+			collation := &options.Collation{Locale: "zh", Strength: 2}
+			op := OpOptions{Collation: collation, Hint: "status_1", MaxTime: time.Second, Comment: "report"}
+
+			find := op.find()
+			So(find.Collation, ShouldEqual, collation)
+			So(find.Hint, ShouldEqual, "status_1")
+			So(*find.MaxTime, ShouldEqual, time.Second)
+			So(*find.Comment, ShouldEqual, "report")
+
+			distinct := op.distinct()
+			So(distinct.Collation, ShouldEqual, collation)
+			So(*distinct.MaxTime, ShouldEqual, time.Second)
+
+			update := op.update()
+			So(update.Hint, ShouldEqual, "status_1")
+			So(update.Comment, ShouldEqual, "report")
+
+			So(OpOptions{}.insertOne().Comment, ShouldBeNil)
+			So(OpOptions{}.aggregate().MaxTime, ShouldBeNil)
+		})
+
+		Convey("memory session ignores the options", func() {
+			db := NewMemorySession()
+			So(db.InsertCtx(ctx, "order", bson.M{"_id": 1}), ShouldBeNil)
+			var all []bson.M
+			So(db.FindAllCtx(ctx, "order", nil, &all), ShouldBeNil)
+			So(len(all), ShouldEqual, 1)
+		})
+	})
+}
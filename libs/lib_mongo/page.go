@@ -0,0 +1,204 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: 基于游标(keyset)的分页
+
+package lib_mongo
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// 单页最大条数
+const maxPageLimit = 1000
+
+// PageQuery describes one page of a keyset pagination.
+//
+// Sort keys are written as "field" or "-field". _id is appended as the last
+// key when it is missing so that the order is total. The sort keys must be
+// present in the selected documents.
+type PageQuery struct {
+	Filter    interface{}
+	Selection interface{}
+	Sort      []string
+	Limit     int64
+	// 上一页返回的next cursor，为空时返回第一页
+	Cursor string
+}
+
+// pageCursor is the decoded continuation token
+type pageCursor struct {
+	Sort   []string `bson:"s"`
+	Values bson.A   `bson:"v"`
+}
+
+// sortKeys returns the sort keys with the _id tie-breaker
+func (q *PageQuery) sortKeys() []string {
+	keys := make([]string, 0, len(q.Sort)+1)
+	desc := false
+	for _, key := range q.Sort {
+		if strings.TrimPrefix(key, "-") == "_id" {
+			return append(keys, q.Sort...)
+		}
+		keys = append(keys, key)
+		desc = strings.HasPrefix(key, "-")
+	}
+	// _id与最后一个key同向，便于复用(field, _id)复合索引
+	if desc {
+		return append(keys, "-_id")
+	}
+	return append(keys, "_id")
+}
+
+// pageSort returns keys as a sort document
+func pageSort(keys []string) bson.D {
+	sorter := make(bson.D, 0, len(keys))
+	for _, key := range keys {
+		if strings.HasPrefix(key, "-") {
+			sorter = append(sorter, bson.E{Key: key[1:], Value: -1})
+		} else {
+			sorter = append(sorter, bson.E{Key: key, Value: 1})
+		}
+	}
+	return sorter
+}
+
+// pageAfter returns the filter of the documents after values in the sort order:
+// {$or: [{k1: {$gt: v1}}, {k1: v1, k2: {$gt: v2}}, ...]}
+func pageAfter(sorter bson.D, values bson.A) bson.M {
+	or := make(bson.A, 0, len(sorter))
+	for i, e := range sorter {
+		cond := bson.M{}
+		for j := 0; j < i; j++ {
+			cond[sorter[j].Key] = values[j]
+		}
+		op := "$gt"
+		if e.Value == -1 {
+			op = "$lt"
+		}
+		cond[e.Key] = bson.M{op: values[i]}
+		or = append(or, cond)
+	}
+	return bson.M{"$or": or}
+}
+
+func encodeCursor(c *pageCursor) (string, error) {
+	data, err := bson.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(s string, keys []string) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	c := &pageCursor{}
+	if err = bson.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	// cursor必须由相同的排序生成
+	if strings.Join(c.Sort, ",") != strings.Join(keys, ",") || len(c.Values) != len(keys) {
+		return nil, fmt.Errorf("%w: sort changed", ErrInvalidCursor)
+	}
+	// cursor由客户端传回，值会放在相等条件中，不能带查询操作符
+	for _, v := range c.Values {
+		if hasOperator(v) {
+			return nil, fmt.Errorf("%w: operator in value", ErrInvalidCursor)
+		}
+	}
+	return c, nil
+}
+
+// hasOperator reports whether v is or contains a document with a $-prefixed key
+func hasOperator(v interface{}) bool {
+	switch t := v.(type) {
+	case bson.D:
+		for _, e := range t {
+			if strings.HasPrefix(e.Key, "$") || hasOperator(e.Value) {
+				return true
+			}
+		}
+	case bson.M:
+		for k, v := range t {
+			if strings.HasPrefix(k, "$") || hasOperator(v) {
+				return true
+			}
+		}
+	case bson.A:
+		for _, v := range t {
+			if hasOperator(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FindPage decodes the page after q.Cursor into result, which must be a pointer
+// to a slice, and returns the cursor of the next page, or "" on the last page.
+//
+// Unlike FindByLimitAndSkip the cost of a page does not grow with its position,
+// and documents inserted or removed meanwhile do not shift the following pages.
+func FindPage(ctx context.Context, db DBAdaptor, name string, q PageQuery, result interface{}) (string, error) {
+	if q.Limit <= 0 || q.Limit > maxPageLimit {
+		return "", ErrorLimit
+	}
+	resultv := reflect.ValueOf(result)
+	if resultv.Kind() != reflect.Ptr || resultv.Elem().Kind() != reflect.Slice {
+		return "", fmt.Errorf("%w: results argument must be a pointer to a slice", ErrorResultType)
+	}
+
+	keys := q.sortKeys()
+	sorter := pageSort(keys)
+	filter := q.Filter
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor, keys)
+		if err != nil {
+			return "", err
+		}
+		after := pageAfter(sorter, c.Values)
+		if filter == nil {
+			filter = after
+		} else {
+			filter = bson.M{"$and": bson.A{filter, after}}
+		}
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	// 多取一条判断是否还有下一页
+	if err := db.FindWithMultipleCtx(ctx, name, filter, q.Selection, sorter, result, q.Limit+1, 0); err != nil {
+		return "", err
+	}
+	slicev := resultv.Elem()
+	if int64(slicev.Len()) <= q.Limit {
+		return "", nil
+	}
+	slicev.Set(slicev.Slice(0, int(q.Limit)))
+
+	doc, err := toM(slicev.Index(int(q.Limit) - 1).Interface())
+	if err != nil {
+		return "", err
+	}
+	c := &pageCursor{Sort: keys, Values: make(bson.A, 0, len(sorter))}
+	for _, e := range sorter {
+		values := lookup(doc, e.Key)
+		if len(values) == 0 {
+			return "", fmt.Errorf("lib_mongo: sort key %s is missing from the page documents", e.Key)
+		}
+		c.Values = append(c.Values, values[0])
+	}
+	return encodeCursor(c)
+}
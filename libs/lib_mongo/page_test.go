@@ -0,0 +1,89 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc:
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestFindPage(t *testing.T) {
+	type item struct {
+		ID    int32 `bson:"_id"`
+		Score int32 `bson:"score"`
+	}
+
+	Convey("test find page", t, func() {
+		ms := NewMemorySession()
+		ctx := context.TODO()
+		for i := int32(1); i <= 7; i++ {
+			So(ms.Insert("item", &item{ID: i, Score: i % 3}), ShouldBeNil)
+		}
+		repo := NewRepository[item](ms, "item")
+
+		Convey("walk every page", func() {
+			q := PageQuery{Sort: []string{"-score"}, Limit: 3}
+			var ids []int32
+			for pages := 0; ; pages++ {
+				So(pages, ShouldBeLessThan, 3)
+				docs, next, err := repo.Page(ctx, q)
+				So(err, ShouldBeNil)
+				for _, doc := range docs {
+					ids = append(ids, doc.ID)
+				}
+				if next == "" {
+					break
+				}
+				q.Cursor = next
+
+				// 翻页期间在已读位置之前插入的数据不会使后续页重复或遗漏
+				if pages == 0 {
+					So(ms.Insert("item", &item{ID: 0, Score: 2}), ShouldBeNil)
+				}
+			}
+			So(ids, ShouldResemble, []int32{5, 2, 7, 4, 1, 6, 3})
+		})
+
+		Convey("filter and exact last page", func() {
+			q := PageQuery{Filter: bson.M{"score": bson.M{"$gt": 0}}, Sort: []string{"score"}, Limit: 5}
+			docs, next, err := repo.Page(ctx, q)
+			So(err, ShouldBeNil)
+			So(len(docs), ShouldEqual, 5)
+			So(next, ShouldEqual, "")
+		})
+
+		Convey("invalid cursor", func() {
+			_, next, err := repo.Page(ctx, PageQuery{Sort: []string{"score"}, Limit: 2})
+			So(err, ShouldBeNil)
+			_, _, err = repo.Page(ctx, PageQuery{Sort: []string{"-score"}, Limit: 2, Cursor: next})
+			So(errors.Is(err, ErrInvalidCursor), ShouldBeTrue)
+			_, _, err = repo.Page(ctx, PageQuery{Sort: []string{"score"}, Limit: 2, Cursor: "%%"})
+			So(errors.Is(err, ErrInvalidCursor), ShouldBeTrue)
+		})
+
+		Convey("tampered cursor", func() {
+			tampered := func(values bson.A) string {
+				c, err := encodeCursor(&pageCursor{Sort: []string{"score", "_id"}, Values: values})
+				So(err, ShouldBeNil)
+				return c
+			}
+			for _, values := range []bson.A{
+				{bson.M{"$ne": nil}, 1},
+				{1, bson.D{{Key: "$gt", Value: 0}}},
+				{bson.A{bson.M{"a": bson.M{"$exists": true}}}, 1},
+			} {
+				_, _, err := repo.Page(ctx, PageQuery{Sort: []string{"score"}, Limit: 2, Cursor: tampered(values)})
+				So(errors.Is(err, ErrInvalidCursor), ShouldBeTrue)
+			}
+
+			_, _, err := repo.Page(ctx, PageQuery{Sort: []string{"score"}, Limit: 2, Cursor: tampered(bson.A{bson.M{"a": 1}, 1})})
+			So(err, ShouldBeNil)
+		})
+	})
+}
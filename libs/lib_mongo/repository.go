@@ -0,0 +1,169 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: 泛型Repository
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+)
+
+// Repository is a typed view of one collection on top of a DBAdaptor
+type Repository[T any] struct {
+	db   DBAdaptor
+	name string
+}
+
+// NewRepository binds a repository of T to the named collection
+func NewRepository[T any](db DBAdaptor, name string) *Repository[T] {
+	return &Repository[T]{db: db, name: name}
+}
+
+// Name returns the collection name
+func (r *Repository[T]) Name() string {
+	return r.name
+}
+
+// WithDB returns a copy of the repository that runs on db, e.g. the tx of WithTransaction
+func (r *Repository[T]) WithDB(db DBAdaptor) *Repository[T] {
+	return &Repository[T]{db: db, name: r.name}
+}
+
+// FindOne returns the first document matching filter, or ErrNotFound
+func (r *Repository[T]) FindOne(ctx context.Context, filter interface{}) (*T, error) {
+	doc := new(T)
+	err, _ := r.db.FindOneCtx(ctx, r.name, filter, doc)
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Find starts a query, use Select/Sort/Limit/Skip to refine it
+func (r *Repository[T]) Find(filter interface{}) *Query[T] {
+	return &Query[T]{repo: r, session: &Session{filter: filter}}
+}
+
+// Page returns the page after q.Cursor and the cursor of the next page, see FindPage
+func (r *Repository[T]) Page(ctx context.Context, q PageQuery) ([]T, string, error) {
+	docs := []T{}
+	next, err := FindPage(ctx, r.db, r.name, q, &docs)
+	if err != nil {
+		return nil, "", err
+	}
+	return docs, next, nil
+}
+
+// Insert inserts docs
+func (r *Repository[T]) Insert(ctx context.Context, docs ...*T) error {
+	if len(docs) == 1 {
+		return r.db.InsertCtx(ctx, r.name, docs[0])
+	}
+	values := make([]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		values = append(values, doc)
+	}
+	return r.db.InsertAllCtx(ctx, r.name, values...)
+}
+
+// Update $set the fields of update on the documents matching filter
+func (r *Repository[T]) Update(ctx context.Context, filter, update interface{}, multi bool) error {
+	return r.db.UpdateCtx(ctx, r.name, filter, update, multi)
+}
+
+// Delete removes the documents matching filter
+func (r *Repository[T]) Delete(ctx context.Context, filter interface{}, multi bool) error {
+	return r.db.RemoveCtx(ctx, r.name, filter, multi)
+}
+
+// Count counts the documents matching filter
+func (r *Repository[T]) Count(ctx context.Context, filter interface{}) (int64, error) {
+	return r.db.FindCountCtx(ctx, r.name, filter)
+}
+
+// Query is a typed find built with the Session builder
+type Query[T any] struct {
+	repo    *Repository[T]
+	session *Session
+}
+
+// Select see Session.Select
+func (q *Query[T]) Select(projection interface{}) *Query[T] {
+	q.session.Select(projection)
+	return q
+}
+
+// Sort see Session.Sort
+func (q *Query[T]) Sort(sort interface{}) *Query[T] {
+	q.session.Sort(sort)
+	return q
+}
+
+// Limit see Session.Limit
+func (q *Query[T]) Limit(limit int64) *Query[T] {
+	q.session.Limit(limit)
+	return q
+}
+
+// Skip see Session.Skip
+func (q *Query[T]) Skip(skip int64) *Query[T] {
+	q.session.Skip(skip)
+	return q
+}
+
+// Options see Session.Options
+func (q *Query[T]) Options(opts ...OpOption) *Query[T] {
+	q.session.Options(opts...)
+	return q
+}
+
+// All returns every matching document
+func (q *Query[T]) All(ctx context.Context) ([]T, error) {
+	ctx = withOpOptions(ctx, OptionsFrom(ctx).merge(q.session.op))
+	var limit, skip int64
+	if q.session.limit != nil {
+		limit = *q.session.limit
+	}
+	if q.session.skip != nil {
+		skip = *q.session.skip
+	}
+
+	// FindWithMultiple decodes a single document when limit is 1
+	if limit == 1 {
+		doc := new(T)
+		err := q.repo.db.FindWithMultipleCtx(ctx, q.repo.name, q.session.filter, q.session.project, q.session.sort, doc, limit, skip)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return []T{}, nil
+			}
+			return nil, err
+		}
+		return []T{*doc}, nil
+	}
+
+	result := make([]T, 0)
+	err := q.repo.db.FindWithMultipleCtx(ctx, q.repo.name, q.session.filter, q.session.project, q.session.sort, &result, limit, skip)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// One returns the first matching document, or ErrNotFound. It leaves the limit of q unchanged.
+func (q *Query[T]) One(ctx context.Context) (*T, error) {
+	docs, err := q.clone().Limit(1).All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, ErrNotFound
+	}
+	return &docs[0], nil
+}
+
+// clone 复制查询条件，修改副本不影响q
+func (q *Query[T]) clone() *Query[T] {
+	s := q.session
+	return &Query[T]{repo: q.repo, session: &Session{filter: s.filter, project: s.project, sort: s.sort, skip: s.skip, limit: s.limit, op: s.op}}
+}
@@ -0,0 +1,78 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc:
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRepository(t *testing.T) {
+	type profile struct {
+		ID   int32  `bson:"_id"`
+		Name string `bson:"name"`
+		Age  int32  `bson:"age"`
+	}
+
+	Convey("test repository", t, func() {
+		ctx := context.TODO()
+		repo := NewRepository[profile](NewMemorySession(), "profile")
+		So(repo.Insert(ctx, &profile{ID: 1, Name: "alice", Age: 30}, &profile{ID: 2, Name: "bob", Age: 20},
+			&profile{ID: 3, Name: "carol", Age: 40}, &profile{ID: 4, Name: "dave", Age: 25}), ShouldBeNil)
+
+		Convey("find one", func() {
+			p, err := repo.FindOne(ctx, bson.M{"name": "bob"})
+			So(err, ShouldBeNil)
+			So(*p, ShouldResemble, profile{ID: 2, Name: "bob", Age: 20})
+
+			_, err = repo.FindOne(ctx, bson.M{"name": "eve"})
+			So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+		})
+
+		Convey("find with sort, skip and limit", func() {
+			all, err := repo.Find(bson.M{"age": bson.M{"$gte": 25}}).Sort(bson.M{"age": -1}).Limit(2).All(ctx)
+			So(err, ShouldBeNil)
+			So(len(all), ShouldEqual, 2)
+			So(all[0].Name, ShouldEqual, "carol")
+			So(all[1].Name, ShouldEqual, "alice")
+
+			all, err = repo.Find(nil).Sort(bson.M{"age": 1}).Skip(1).Limit(1).All(ctx)
+			So(err, ShouldBeNil)
+			So(len(all), ShouldEqual, 1)
+			So(all[0].Name, ShouldEqual, "dave")
+
+			all, err = repo.Find(bson.M{"age": bson.M{"$gt": 100}}).Limit(1).All(ctx)
+			So(err, ShouldBeNil)
+			So(len(all), ShouldEqual, 0)
+		})
+
+		Convey("one does not change the query", func() {
+			q := repo.Find(nil).Sort(bson.M{"age": 1})
+			p, err := q.One(ctx)
+			So(err, ShouldBeNil)
+			So(p.Name, ShouldEqual, "bob")
+
+			all, err := q.All(ctx)
+			So(err, ShouldBeNil)
+			So(len(all), ShouldEqual, 4)
+
+			_, err = repo.Find(bson.M{"name": "eve"}).One(ctx)
+			So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+		})
+
+		Convey("count", func() {
+			n, err := repo.Count(ctx, bson.M{"age": bson.M{"$lt": 30}})
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+			n, err = repo.Count(ctx, nil)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 4)
+		})
+	})
+}
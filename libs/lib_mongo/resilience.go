@@ -0,0 +1,568 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: 重试与熔断
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 熔断器打开时直接返回，不访问数据库
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// RetryPolicy is the exponential backoff of ResilientDB
+type RetryPolicy struct {
+	// 包含首次调用的最大次数，<=1表示不重试
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// backoff returns a random wait before the attempt+1-th call, at most InitialBackoff*2^(attempt-1)
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// BreakerPolicy configures a Breaker
+type BreakerPolicy struct {
+	// 连续失败(网络错误/超时)次数达到该值时打开
+	FailureThreshold int
+	// 打开后经过该时间放行一次试探请求
+	OpenTimeout   time.Duration
+	OnStateChange func(from, to BreakerState)
+}
+
+// Breaker fails fast while the cluster is unhealthy. Only ErrRetryable and
+// ErrTimeout count as failures, other errors mean the server answered.
+type Breaker struct {
+	policy BreakerPolicy
+
+	m        sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	// 半开状态下是否已有试探请求
+	probing bool
+}
+
+func NewBreaker(policy BreakerPolicy) *Breaker {
+	if policy.FailureThreshold <= 0 {
+		policy.FailureThreshold = 5
+	}
+	if policy.OpenTimeout <= 0 {
+		policy.OpenTimeout = 10 * time.Second
+	}
+	return &Breaker{policy: policy}
+}
+
+// State returns the current state
+func (b *Breaker) State() BreakerState {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.state
+}
+
+// setState must be called with b.m held
+func (b *Breaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	from := b.state
+	b.state = state
+	if b.policy.OnStateChange != nil {
+		b.policy.OnStateChange(from, state)
+	}
+}
+
+// allow returns ErrCircuitOpen when the call must fail fast
+func (b *Breaker) allow() error {
+	b.m.Lock()
+	defer b.m.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.policy.OpenTimeout {
+			return ErrCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record updates the state with the outcome of an allowed call. Failures after
+// the caller's own ctx was canceled or expired say nothing about the cluster and
+// neither count nor reset the failures.
+func (b *Breaker) record(ctx context.Context, err error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.probing = false
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+	if !errors.Is(err, ErrRetryable) && !errors.Is(err, ErrTimeout) {
+		b.failures = 0
+		b.setState(BreakerClosed)
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.policy.FailureThreshold {
+		b.openedAt = time.Now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// retryRead reports whether an idempotent read can be retried
+func retryRead(err error) bool {
+	return errors.Is(err, ErrRetryable)
+}
+
+// 服务端在执行前拒绝整个写命令的错误码：NotWritablePrimary、NotPrimaryNoSecondaryOk、NotPrimaryOrSecondary
+var writeRejectedCodes = []int{10107, 13435, 13436}
+
+// retryWrite reports whether the server rejected the whole write command without
+// applying it, e.g. when the node is no longer primary. Write concern errors (the
+// write was applied), write errors of a possibly partially applied batch, shutdown
+// interruptions and network errors are ambiguous and not retried.
+func retryWrite(err error) bool {
+	var we mongo.WriteException
+	var bwe mongo.BulkWriteException
+	if errors.As(err, &we) || errors.As(err, &bwe) {
+		return false
+	}
+	var ce mongo.CommandError
+	if !errors.As(err, &ce) || ce.HasErrorLabel("NetworkError") {
+		return false
+	}
+	for _, code := range writeRejectedCodes {
+		if ce.HasErrorCode(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResilientDB wraps a DBAdaptor with retries and a circuit breaker.
+// ForEach, Watch, SyncIndexes and WithTransaction only go through the breaker,
+// the driver retries transactions itself.
+type ResilientDB struct {
+	DBAdaptor
+	retry   RetryPolicy
+	breaker *Breaker
+}
+
+// NewResilient wraps db, breaker may be nil
+func NewResilient(db DBAdaptor, retry RetryPolicy, breaker *Breaker) *ResilientDB {
+	return &ResilientDB{DBAdaptor: db, retry: retry, breaker: breaker}
+}
+
+// Breaker returns the circuit breaker, nil when disabled
+func (r *ResilientDB) Breaker() *Breaker {
+	return r.breaker
+}
+
+// do calls fn through the breaker and retries it while retryable(err)
+func (r *ResilientDB) do(ctx context.Context, retryable func(error) bool, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		if r.breaker != nil {
+			if err := r.breaker.allow(); err != nil {
+				return err
+			}
+		}
+		err := fn()
+		if r.breaker != nil {
+			r.breaker.record(ctx, err)
+		}
+		if err == nil || retryable == nil || !retryable(err) || attempt >= r.retry.MaxAttempts {
+			return err
+		}
+
+		timer := time.NewTimer(r.retry.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (r *ResilientDB) FindOne(name string, query, result interface{}) (err error, exist bool) {
+	err = r.do(context.TODO(), retryRead, func() error {
+		err, exist = r.DBAdaptor.FindOne(name, query, result)
+		return err
+	})
+	return err, exist
+}
+
+func (r *ResilientDB) FindOneCtx(ctx context.Context, name string, query, result interface{}) (err error, exist bool) {
+	err = r.do(ctx, retryRead, func() error {
+		err, exist = r.DBAdaptor.FindOneCtx(ctx, name, query, result)
+		return err
+	})
+	return err, exist
+}
+
+func (r *ResilientDB) Find(name string, query, result interface{}, limit int64) error {
+	return r.do(context.TODO(), retryRead, func() error {
+		return r.DBAdaptor.Find(name, query, result, limit)
+	})
+}
+
+func (r *ResilientDB) FindCtx(ctx context.Context, name string, query, result interface{}, limit int64) error {
+	return r.do(ctx, retryRead, func() error {
+		return r.DBAdaptor.FindCtx(ctx, name, query, result, limit)
+	})
+}
+
+func (r *ResilientDB) FindAll(name string, query, result interface{}) error {
+	return r.do(context.TODO(), retryRead, func() error {
+		return r.DBAdaptor.FindAll(name, query, result)
+	})
+}
+
+func (r *ResilientDB) FindAllCtx(ctx context.Context, name string, query, result interface{}) error {
+	return r.do(ctx, retryRead, func() error {
+		return r.DBAdaptor.FindAllCtx(ctx, name, query, result)
+	})
+}
+
+func (r *ResilientDB) FindByLimitAndSkip(name string, query, result interface{}, limit, skip int64) error {
+	return r.do(context.TODO(), retryRead, func() error {
+		return r.DBAdaptor.FindByLimitAndSkip(name, query, result, limit, skip)
+	})
+}
+
+func (r *ResilientDB) FindByLimitAndSkipCtx(ctx context.Context, name string, query, result interface{}, limit, skip int64) error {
+	return r.do(ctx, retryRead, func() error {
+		return r.DBAdaptor.FindByLimitAndSkipCtx(ctx, name, query, result, limit, skip)
+	})
+}
+
+func (r *ResilientDB) FindWithSelect(name string, query, selection, result interface{}, limit int64) error {
+	return r.do(context.TODO(), retryRead, func() error {
+		return r.DBAdaptor.FindWithSelect(name, query, selection, result, limit)
+	})
+}
+
+func (r *ResilientDB) FindWithSelectCtx(ctx context.Context, name string, query, selection, result interface{}, limit int64) error {
+	return r.do(ctx, retryRead, func() error {
+		return r.DBAdaptor.FindWithSelectCtx(ctx, name, query, selection, result, limit)
+	})
+}
+
+func (r *ResilientDB) FindSelect(name string, query, selection, result interface{}) error {
+	return r.do(context.TODO(), retryRead, func() error {
+		return r.DBAdaptor.FindSelect(name, query, selection, result)
+	})
+}
+
+func (r *ResilientDB) FindSelectCtx(ctx context.Context, name string, query, selection, result interface{}) error {
+	return r.do(ctx, retryRead, func() error {
+		return r.DBAdaptor.FindSelectCtx(ctx, name, query, selection, result)
+	})
+}
+
+func (r *ResilientDB) FindWithMultiple(name string, query, selection, sorter, result interface{}, limit, skip int64) error {
+	return r.do(context.TODO(), retryRead, func() error {
+		return r.DBAdaptor.FindWithMultiple(name, query, selection, sorter, result, limit, skip)
+	})
+}
+
+func (r *ResilientDB) FindWithMultipleCtx(ctx context.Context, name string, query, selection, sorter, result interface{}, limit, skip int64) error {
+	return r.do(ctx, retryRead, func() error {
+		return r.DBAdaptor.FindWithMultipleCtx(ctx, name, query, selection, sorter, result, limit, skip)
+	})
+}
+
+func (r *ResilientDB) FindCount(name string, query interface{}) (c int64, err error) {
+	err = r.do(context.TODO(), retryRead, func() error {
+		c, err = r.DBAdaptor.FindCount(name, query)
+		return err
+	})
+	return c, err
+}
+
+func (r *ResilientDB) FindCountCtx(ctx context.Context, name string, query interface{}) (c int64, err error) {
+	err = r.do(ctx, retryRead, func() error {
+		c, err = r.DBAdaptor.FindCountCtx(ctx, name, query)
+		return err
+	})
+	return c, err
+}
+
+func (r *ResilientDB) FindSortByLimitAndSkip(name string, query, sorter, result interface{}, limit, skip int64) error {
+	return r.do(context.TODO(), retryRead, func() error {
+		return r.DBAdaptor.FindSortByLimitAndSkip(name, query, sorter, result, limit, skip)
+	})
+}
+
+func (r *ResilientDB) FindSortByLimitAndSkipCtx(ctx context.Context, name string, query, sorter, result interface{}, limit, skip int64) error {
+	return r.do(ctx, retryRead, func() error {
+		return r.DBAdaptor.FindSortByLimitAndSkipCtx(ctx, name, query, sorter, result, limit, skip)
+	})
+}
+
+func (r *ResilientDB) FindWithAggregation(name string, pipeline, result interface{}) error {
+	return r.do(context.TODO(), retryRead, func() error {
+		return r.DBAdaptor.FindWithAggregation(name, pipeline, result)
+	})
+}
+
+func (r *ResilientDB) FindWithAggregationCtx(ctx context.Context, name string, pipeline, result interface{}) error {
+	return r.do(ctx, retryRead, func() error {
+		return r.DBAdaptor.FindWithAggregationCtx(ctx, name, pipeline, result)
+	})
+}
+
+func (r *ResilientDB) FindWithDistinct(name, distinct string, query interface{}) (values []interface{}, err error) {
+	err = r.do(context.TODO(), retryRead, func() error {
+		values, err = r.DBAdaptor.FindWithDistinct(name, distinct, query)
+		return err
+	})
+	return values, err
+}
+
+func (r *ResilientDB) FindWithDistinctCtx(ctx context.Context, name, distinct string, query interface{}) (values []interface{}, err error) {
+	err = r.do(ctx, retryRead, func() error {
+		values, err = r.DBAdaptor.FindWithDistinctCtx(ctx, name, distinct, query)
+		return err
+	})
+	return values, err
+}
+
+// Aggregate retries opening the cursor, not the iteration
+func (r *ResilientDB) Aggregate(ctx context.Context, name string, p *Pipeline) (it *Iter, err error) {
+	err = r.do(ctx, retryRead, func() error {
+		it, err = r.DBAdaptor.Aggregate(ctx, name, p)
+		return err
+	})
+	return it, err
+}
+
+func (r *ResilientDB) AggregateAll(ctx context.Context, name string, p *Pipeline, result interface{}) error {
+	return r.do(ctx, retryRead, func() error {
+		return r.DBAdaptor.AggregateAll(ctx, name, p, result)
+	})
+}
+
+// ForEach is not retried, fn may already have seen some documents
+func (r *ResilientDB) ForEach(name string, query interface{}, fn func(raw bson.Raw) error) error {
+	return r.do(context.TODO(), nil, func() error {
+		return r.DBAdaptor.ForEach(name, query, fn)
+	})
+}
+
+func (r *ResilientDB) ForEachCtx(ctx context.Context, name string, query interface{}, fn func(raw bson.Raw) error) error {
+	return r.do(ctx, nil, func() error {
+		return r.DBAdaptor.ForEachCtx(ctx, name, query, fn)
+	})
+}
+
+func (r *ResilientDB) Insert(name string, doc interface{}) error {
+	return r.do(context.TODO(), retryWrite, func() error {
+		return r.DBAdaptor.Insert(name, doc)
+	})
+}
+
+func (r *ResilientDB) InsertCtx(ctx context.Context, name string, doc interface{}) error {
+	return r.do(ctx, retryWrite, func() error {
+		return r.DBAdaptor.InsertCtx(ctx, name, doc)
+	})
+}
+
+func (r *ResilientDB) InsertAll(name string, docs ...interface{}) error {
+	return r.do(context.TODO(), retryWrite, func() error {
+		return r.DBAdaptor.InsertAll(name, docs...)
+	})
+}
+
+func (r *ResilientDB) InsertAllCtx(ctx context.Context, name string, docs ...interface{}) error {
+	return r.do(ctx, retryWrite, func() error {
+		return r.DBAdaptor.InsertAllCtx(ctx, name, docs...)
+	})
+}
+
+func (r *ResilientDB) Update(name string, query, update interface{}, multi bool) error {
+	return r.do(context.TODO(), retryWrite, func() error {
+		return r.DBAdaptor.Update(name, query, update, multi)
+	})
+}
+
+func (r *ResilientDB) UpdateCtx(ctx context.Context, name string, query, update interface{}, multi bool) error {
+	return r.do(ctx, retryWrite, func() error {
+		return r.DBAdaptor.UpdateCtx(ctx, name, query, update, multi)
+	})
+}
+
+func (r *ResilientDB) UpdateById(name string, id, update interface{}) error {
+	return r.do(context.TODO(), retryWrite, func() error {
+		return r.DBAdaptor.UpdateById(name, id, update)
+	})
+}
+
+func (r *ResilientDB) UpdateByIdCtx(ctx context.Context, name string, id, update interface{}) error {
+	return r.do(ctx, retryWrite, func() error {
+		return r.DBAdaptor.UpdateByIdCtx(ctx, name, id, update)
+	})
+}
+
+// UpdateRaw is not retried, $inc and other operators are not idempotent
+func (r *ResilientDB) UpdateRaw(name string, query, update interface{}, multi bool) error {
+	return r.do(context.TODO(), nil, func() error {
+		return r.DBAdaptor.UpdateRaw(name, query, update, multi)
+	})
+}
+
+func (r *ResilientDB) UpdateRawCtx(ctx context.Context, name string, query, update interface{}, multi bool) error {
+	return r.do(ctx, nil, func() error {
+		return r.DBAdaptor.UpdateRawCtx(ctx, name, query, update, multi)
+	})
+}
+
+func (r *ResilientDB) Remove(name string, query interface{}, multi bool) error {
+	return r.do(context.TODO(), retryWrite, func() error {
+		return r.DBAdaptor.Remove(name, query, multi)
+	})
+}
+
+func (r *ResilientDB) RemoveCtx(ctx context.Context, name string, query interface{}, multi bool) error {
+	return r.do(ctx, retryWrite, func() error {
+		return r.DBAdaptor.RemoveCtx(ctx, name, query, multi)
+	})
+}
+
+func (r *ResilientDB) RemoveById(name string, id interface{}) error {
+	return r.do(context.TODO(), retryWrite, func() error {
+		return r.DBAdaptor.RemoveById(name, id)
+	})
+}
+
+func (r *ResilientDB) RemoveByIdCtx(ctx context.Context, name string, id interface{}) error {
+	return r.do(ctx, retryWrite, func() error {
+		return r.DBAdaptor.RemoveByIdCtx(ctx, name, id)
+	})
+}
+
+// GetNextSequence is not retried, a retry could skip a sequence number
+func (r *ResilientDB) GetNextSequence(name string) (seq int32, err error) {
+	err = r.do(context.TODO(), nil, func() error {
+		seq, err = r.DBAdaptor.GetNextSequence(name)
+		return err
+	})
+	return seq, err
+}
+
+func (r *ResilientDB) GetNextSequenceCtx(ctx context.Context, name string) (seq int32, err error) {
+	err = r.do(ctx, nil, func() error {
+		seq, err = r.DBAdaptor.GetNextSequenceCtx(ctx, name)
+		return err
+	})
+	return seq, err
+}
+
+func (r *ResilientDB) FindOneAndUpdate(name string, filter, update interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return r.FindOneAndUpdateCtx(context.TODO(), name, filter, update, opt, result)
+}
+
+func (r *ResilientDB) FindOneAndUpdateCtx(ctx context.Context, name string, filter, update interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return r.do(ctx, retryWrite, func() error {
+		return r.DBAdaptor.FindOneAndUpdateCtx(ctx, name, filter, update, opt, result)
+	})
+}
+
+func (r *ResilientDB) FindOneAndReplace(name string, filter, replacement interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return r.FindOneAndReplaceCtx(context.TODO(), name, filter, replacement, opt, result)
+}
+
+func (r *ResilientDB) FindOneAndReplaceCtx(ctx context.Context, name string, filter, replacement interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return r.do(ctx, retryWrite, func() error {
+		return r.DBAdaptor.FindOneAndReplaceCtx(ctx, name, filter, replacement, opt, result)
+	})
+}
+
+func (r *ResilientDB) FindOneAndDelete(name string, filter interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return r.FindOneAndDeleteCtx(context.TODO(), name, filter, opt, result)
+}
+
+func (r *ResilientDB) FindOneAndDeleteCtx(ctx context.Context, name string, filter interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return r.do(ctx, retryWrite, func() error {
+		return r.DBAdaptor.FindOneAndDeleteCtx(ctx, name, filter, opt, result)
+	})
+}
+
+func (r *ResilientDB) BulkWrite(name string, b *Bulk) (*BulkResult, error) {
+	return r.BulkWriteCtx(context.TODO(), name, b)
+}
+
+func (r *ResilientDB) BulkWriteCtx(ctx context.Context, name string, b *Bulk) (res *BulkResult, err error) {
+	err = r.do(ctx, retryWrite, func() error {
+		res, err = r.DBAdaptor.BulkWriteCtx(ctx, name, b)
+		return err
+	})
+	return res, err
+}
+
+func (r *ResilientDB) Watch(ctx context.Context, name string, pipeline interface{}, opt WatchOptions) (cs *ChangeStream, err error) {
+	err = r.do(ctx, nil, func() error {
+		cs, err = r.DBAdaptor.Watch(ctx, name, pipeline, opt)
+		return err
+	})
+	return cs, err
+}
+
+func (r *ResilientDB) SyncIndexes(ctx context.Context, specs []IndexSpec, opt IndexSyncOptions) (diff *IndexDiff, err error) {
+	err = r.do(ctx, nil, func() error {
+		diff, err = r.DBAdaptor.SyncIndexes(ctx, specs, opt)
+		return err
+	})
+	return diff, err
+}
+
+func (r *ResilientDB) WithTransaction(ctx context.Context, fn func(tx DBAdaptor) error, opts ...*options.TransactionOptions) error {
+	return r.do(ctx, nil, func() error {
+		return r.DBAdaptor.WithTransaction(ctx, fn, opts...)
+	})
+}
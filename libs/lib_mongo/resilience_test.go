@@ -0,0 +1,182 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc:
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// flakyDB fails the next calls with errs
+type flakyDB struct {
+	*MemorySession
+	errs  []error
+	calls int
+}
+
+func (f *flakyDB) fail(op, name string) error {
+	f.calls++
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return wrapErr(op, name, err)
+}
+
+func (f *flakyDB) FindAllCtx(ctx context.Context, name string, query, result interface{}) error {
+	if err := f.fail("FindAll", name); err != nil {
+		return err
+	}
+	return f.MemorySession.FindAllCtx(ctx, name, query, result)
+}
+
+func (f *flakyDB) InsertCtx(ctx context.Context, name string, doc interface{}) error {
+	if err := f.fail("Insert", name); err != nil {
+		return err
+	}
+	return f.MemorySession.InsertCtx(ctx, name, doc)
+}
+
+func (f *flakyDB) UpdateRawCtx(ctx context.Context, name string, query, update interface{}, multi bool) error {
+	if err := f.fail("UpdateRaw", name); err != nil {
+		return err
+	}
+	return f.MemorySession.UpdateRawCtx(ctx, name, query, update, multi)
+}
+
+func TestResilience(t *testing.T) {
+	ctx := context.Background()
+	notPrimary := mongo.CommandError{Code: 10107, Name: "NotWritablePrimary"}
+	network := mongo.CommandError{Labels: []string{"NetworkError"}}
+	retry := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+	Convey("test retry", t, func() {
+		fake := &flakyDB{MemorySession: NewMemorySession()}
+		db := NewResilient(fake, retry, nil)
+		So(fake.MemorySession.Insert("profile", bson.M{"_id": 1}), ShouldBeNil)
+
+		Convey("reads are retried on retryable errors", func() {
+			fake.errs = []error{network, notPrimary}
+			var docs []bson.M
+			So(db.FindAllCtx(ctx, "profile", bson.M{}, &docs), ShouldBeNil)
+			So(fake.calls, ShouldEqual, 3)
+			So(len(docs), ShouldEqual, 1)
+		})
+
+		Convey("reads give up after MaxAttempts", func() {
+			fake.errs = []error{network, network, network, network}
+			var docs []bson.M
+			err := db.FindAllCtx(ctx, "profile", bson.M{}, &docs)
+			So(errors.Is(err, ErrRetryable), ShouldBeTrue)
+			So(fake.calls, ShouldEqual, 3)
+		})
+
+		Convey("other errors are not retried", func() {
+			fake.errs = []error{ErrNotFound}
+			var docs []bson.M
+			So(errors.Is(db.FindAllCtx(ctx, "profile", bson.M{}, &docs), ErrNotFound), ShouldBeTrue)
+			So(fake.calls, ShouldEqual, 1)
+		})
+
+		Convey("writes are retried only when not applied", func() {
+			fake.errs = []error{notPrimary}
+			So(db.InsertCtx(ctx, "profile", bson.M{"_id": 2}), ShouldBeNil)
+			So(fake.calls, ShouldEqual, 2)
+
+			fake.calls = 0
+			fake.errs = []error{network}
+			So(errors.Is(db.InsertCtx(ctx, "profile", bson.M{"_id": 3}), ErrRetryable), ShouldBeTrue)
+			So(fake.calls, ShouldEqual, 1)
+
+			// 写关注错误时写入已在主节点生效
+			fake.calls = 0
+			fake.errs = []error{mongo.WriteException{WriteConcernError: &mongo.WriteConcernError{Code: 91}}}
+			So(db.InsertCtx(ctx, "profile", bson.M{"_id": 4}), ShouldNotBeNil)
+			So(fake.calls, ShouldEqual, 1)
+			So(retryWrite(mongo.BulkWriteException{WriteConcernError: &mongo.WriteConcernError{Code: 11602}}), ShouldBeFalse)
+			So(retryWrite(mongo.CommandError{Code: 11602, Name: "InterruptedDueToReplStateChange"}), ShouldBeFalse)
+			So(retryWrite(mongo.CommandError{Code: 6, Name: "HostUnreachable"}), ShouldBeFalse)
+		})
+
+		Convey("non idempotent writes are never retried", func() {
+			fake.errs = []error{notPrimary}
+			So(db.UpdateRawCtx(ctx, "profile", bson.M{"_id": 1}, bson.M{"$inc": bson.M{"n": 1}}, false), ShouldNotBeNil)
+			So(fake.calls, ShouldEqual, 1)
+		})
+
+		Convey("canceled context stops retrying", func() {
+			cctx, cancel := context.WithCancel(ctx)
+			cancel()
+			fake.errs = []error{network, network}
+			var docs []bson.M
+			So(db.FindAllCtx(cctx, "profile", bson.M{}, &docs), ShouldNotBeNil)
+			So(fake.calls, ShouldEqual, 1)
+		})
+	})
+
+	Convey("test breaker", t, func() {
+		var changes []string
+		breaker := NewBreaker(BreakerPolicy{
+			FailureThreshold: 2,
+			OpenTimeout:      20 * time.Millisecond,
+			OnStateChange: func(from, to BreakerState) {
+				changes = append(changes, from.String()+"->"+to.String())
+			},
+		})
+		fake := &flakyDB{MemorySession: NewMemorySession()}
+		db := NewResilient(fake, RetryPolicy{}, breaker)
+		var docs []bson.M
+
+		fake.errs = []error{network, ErrNotFound, network, network}
+		So(db.FindAllCtx(ctx, "profile", bson.M{}, &docs), ShouldNotBeNil)
+		So(db.FindAllCtx(ctx, "profile", bson.M{}, &docs), ShouldNotBeNil)
+		So(breaker.State(), ShouldEqual, BreakerClosed)
+		So(db.FindAllCtx(ctx, "profile", bson.M{}, &docs), ShouldNotBeNil)
+		So(db.FindAllCtx(ctx, "profile", bson.M{}, &docs), ShouldNotBeNil)
+		So(breaker.State(), ShouldEqual, BreakerOpen)
+
+		So(db.FindAllCtx(ctx, "profile", bson.M{}, &docs), ShouldEqual, ErrCircuitOpen)
+		So(fake.calls, ShouldEqual, 4)
+
+		time.Sleep(25 * time.Millisecond)
+		fake.errs = []error{network}
+		So(errors.Is(db.FindAllCtx(ctx, "profile", bson.M{}, &docs), ErrRetryable), ShouldBeTrue)
+		So(breaker.State(), ShouldEqual, BreakerOpen)
+
+		time.Sleep(25 * time.Millisecond)
+		So(db.FindAllCtx(ctx, "profile", bson.M{}, &docs), ShouldBeNil)
+		So(breaker.State(), ShouldEqual, BreakerClosed)
+		So(changes, ShouldResemble, []string{
+			"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed",
+		})
+	})
+
+	Convey("caller cancellations do not count as failures", t, func() {
+		breaker := NewBreaker(BreakerPolicy{FailureThreshold: 2, OpenTimeout: time.Minute})
+		fake := &flakyDB{MemorySession: NewMemorySession()}
+		db := NewResilient(fake, RetryPolicy{}, breaker)
+		var docs []bson.M
+
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		fake.errs = []error{network, context.Canceled, context.DeadlineExceeded}
+		So(errors.Is(db.FindAllCtx(ctx, "profile", bson.M{}, &docs), ErrRetryable), ShouldBeTrue)
+		So(db.FindAllCtx(cctx, "profile", bson.M{}, &docs), ShouldNotBeNil)
+		So(errors.Is(db.FindAllCtx(cctx, "profile", bson.M{}, &docs), ErrTimeout), ShouldBeTrue)
+		So(breaker.State(), ShouldEqual, BreakerClosed)
+
+		// 调用方取消既不计数也不清零
+		fake.errs = []error{network}
+		So(db.FindAllCtx(ctx, "profile", bson.M{}, &docs), ShouldNotBeNil)
+		So(breaker.State(), ShouldEqual, BreakerOpen)
+	})
+}
@@ -0,0 +1,90 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: int64自增ID分配器，按块预留
+
+package lib_mongo
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// 与GetNextSequence共用的计数集合
+const SequenceCollection = "seq_counters"
+
+const defaultSequenceBlock = 1000
+
+// SequenceAllocator hands out int64 IDs from blocks reserved with one $inc each.
+//
+// It shares the seq_counters documents with GetNextSequence, so both can be used
+// on the same sequence. IDs of a block not handed out before the process exits
+// are lost, the IDs are unique and increasing per process but not gapless.
+//
+//	ids := lib_mongo.NewSequenceAllocator(env.MongoCli, 1000)
+//	id, err := ids.Next(ctx, "event")
+type SequenceAllocator struct {
+	db    DBAdaptor
+	block int64
+
+	m    sync.Mutex
+	seqs map[string]*seqBlock
+}
+
+// seqBlock is the reserved range (next, max] of one sequence
+type seqBlock struct {
+	m    sync.Mutex
+	next int64
+	max  int64
+}
+
+// NewSequenceAllocator returns an allocator reserving block IDs per round trip,
+// db should not be the tx of a transaction, a rollback would hand out IDs twice
+func NewSequenceAllocator(db DBAdaptor, block int64) *SequenceAllocator {
+	if block <= 0 {
+		block = defaultSequenceBlock
+	}
+	return &SequenceAllocator{db: db, block: block, seqs: make(map[string]*seqBlock)}
+}
+
+func (a *SequenceAllocator) sequence(name string) *seqBlock {
+	a.m.Lock()
+	defer a.m.Unlock()
+	seq, ok := a.seqs[name]
+	if !ok {
+		seq = &seqBlock{}
+		a.seqs[name] = seq
+	}
+	return seq
+}
+
+// Next returns the next ID of the named sequence
+func (a *SequenceAllocator) Next(ctx context.Context, name string) (int64, error) {
+	seq := a.sequence(name)
+	seq.m.Lock()
+	defer seq.m.Unlock()
+
+	if seq.next >= seq.max {
+		max, err := a.reserve(ctx, name)
+		if err != nil {
+			return -1, err
+		}
+		seq.next, seq.max = max-a.block, max
+	}
+	seq.next++
+	return seq.next, nil
+}
+
+// reserve increments the counter by a block and returns its new value
+func (a *SequenceAllocator) reserve(ctx context.Context, name string) (int64, error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := a.db.FindOneAndUpdateCtx(primaryCtx(ctx), SequenceCollection, bson.M{"_id": name},
+		bson.M{"$inc": bson.M{"seq": a.block}}, FindAndModifyOptions{Upsert: true, ReturnNew: true}, &counter)
+	if err != nil {
+		return 0, err
+	}
+	return counter.Seq, nil
+}
@@ -0,0 +1,67 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc:
+
+package lib_mongo
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSequenceAllocator(t *testing.T) {
+	Convey("test sequence allocator", t, func() {
+		ms := NewMemorySession()
+		ctx := context.TODO()
+
+		Convey("shares seq_counters with GetNextSequence", func() {
+			seq, err := ms.GetNextSequence("order")
+			So(err, ShouldBeNil)
+			So(seq, ShouldEqual, 1)
+
+			ids := NewSequenceAllocator(ms, 10)
+			id, err := ids.Next(ctx, "order")
+			So(err, ShouldBeNil)
+			So(id, ShouldEqual, 2)
+
+			// 已预留到11
+			seq, err = ms.GetNextSequence("order")
+			So(err, ShouldBeNil)
+			So(seq, ShouldEqual, 12)
+
+			id, err = ids.Next(ctx, "other")
+			So(err, ShouldBeNil)
+			So(id, ShouldEqual, 1)
+		})
+
+		Convey("unique under concurrency", func() {
+			a, b := NewSequenceAllocator(ms, 7), NewSequenceAllocator(ms, 5)
+			var m sync.Mutex
+			seen := map[int64]bool{}
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				alloc := a
+				if i%2 == 1 {
+					alloc = b
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 50; j++ {
+						id, err := alloc.Next(ctx, "event")
+						m.Lock()
+						if err == nil {
+							seen[id] = true
+						}
+						m.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			So(len(seen), ShouldEqual, 400)
+		})
+	})
+}
@@ -12,11 +12,21 @@ import (
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
+const (
+	// 未传入ctx的查询默认超时时间
+	defaultFindTimeout = 10 * time.Second
+	// 未传入ctx的聚合/distinct默认超时时间
+	defaultPipeTimeout = 20 * time.Second
+	// 未传入ctx的连接默认超时时间
+	defaultConnectTimeout = 20 * time.Second
+)
+
 // Session lib_mongo session
 type Session struct {
 	client      *mongo.Client
@@ -31,6 +41,18 @@ type Session struct {
 	skip        *int64
 	sort        interface{}
 	distinct    interface{}
+	batchSize   *int32
+	monitor     *monitor
+	// 拓扑变化监听，用于健康检查
+	serverMonitor *event.ServerMonitor
+	// 由ClientConfig等构建的连接选项，为nil时使用uri
+	opts *options.ClientOptions
+	// 读偏好、读写关注、collation等单次操作选项
+	op OpOptions
+	// 全表扫描检查，为nil时不检查
+	guard *scanGuard
+	// MarkDown设置的不可用原因，不为nil时健康状态为down
+	down error
 }
 
 // New session
@@ -44,6 +66,11 @@ func New(uri string) *Session {
 	return session
 }
 
+// NewWithOptions creates a session from client options, e.g. ClientConfig.ClientOptions
+func NewWithOptions(opt *options.ClientOptions) *Session {
+	return &Session{uri: opt.GetURI(), opts: opt}
+}
+
 // SetDB set db
 func (s *Session) SetDB(db string) {
 	s.m.Lock()
@@ -56,8 +83,7 @@ func (s *Session) C(collection string) *Collection {
 	if len(s.db) == 0 {
 		s.db = "test"
 	}
-	d := &Database{database: s.client.Database(s.db)}
-	return &Collection{collection: d.database.Collection(collection)}
+	return s.DB(s.db).C(collection)
 }
 
 // Collection returns collection
@@ -65,8 +91,7 @@ func (s *Session) Collection(collection string) *Collection {
 	if len(s.db) == 0 {
 		s.db = "test"
 	}
-	d := &Database{database: s.client.Database(s.db)}
-	return &Collection{collection: d.database.Collection(collection)}
+	return s.DB(s.db).C(collection)
 }
 
 // SetPoolLimit specifies the max size of a server's connection pool.
@@ -76,12 +101,51 @@ func (s *Session) SetPoolLimit(limit uint64) {
 	s.m.Unlock()
 }
 
+// SetMonitor reports the commands and pool events of the client, call it before Connect
+func (s *Session) SetMonitor(opt MonitorOptions) {
+	s.m.Lock()
+	s.monitor = newMonitor(opt)
+	s.m.Unlock()
+}
+
+// SetServerMonitor reports the topology changes of the client, call it before Connect
+func (s *Session) SetServerMonitor(sm *event.ServerMonitor) {
+	s.m.Lock()
+	s.serverMonitor = sm
+	s.m.Unlock()
+}
+
+// SetScanGuard explains the queries on first use and reports collection scans, see ScanGuardOptions
+func (s *Session) SetScanGuard(opt ScanGuardOptions) {
+	s.m.Lock()
+	s.guard = newScanGuard(opt)
+	s.m.Unlock()
+}
+
 // Connect lib_mongo client
 func (s *Session) Connect() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), defaultConnectTimeout)
 	defer cancel()
-	opt := options.Client().ApplyURI(s.uri)
-	opt.SetMaxPoolSize(s.maxPoolSize)
+	return s.ConnectCtx(ctx)
+}
+
+// ConnectCtx connects lib_mongo client, the ctx bounds the initial connection
+func (s *Session) ConnectCtx(ctx context.Context) error {
+	opt := s.opts
+	if opt == nil {
+		opt = options.Client().ApplyURI(s.uri)
+	}
+	// 未设置时保留连接串中的maxPoolSize
+	if s.maxPoolSize > 0 {
+		opt.SetMaxPoolSize(s.maxPoolSize)
+	}
+	if s.monitor != nil {
+		opt.SetMonitor(s.monitor.commandMonitor())
+		opt.SetPoolMonitor(s.monitor.poolMonitor())
+	}
+	if s.serverMonitor != nil {
+		opt.SetServerMonitor(s.serverMonitor)
+	}
 
 	client, err := mongo.NewClient(opt)
 	if err != nil {
@@ -95,17 +159,40 @@ func (s *Session) Connect() error {
 	return nil
 }
 
+// markDown sets the reason the client must be reported down, nil clears it
+func (s *Session) markDown(err error) {
+	s.m.Lock()
+	s.down = err
+	s.m.Unlock()
+}
+
+func (s *Session) downErr() error {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.down
+}
+
 func (s *Session) Disconnect() {
 	s.m.Lock()
-	s.client.Disconnect(context.Background())
+	if s.client != nil {
+		s.client.Disconnect(context.Background())
+	}
 	s.m.Unlock()
 }
 
-// Ping verifies that the client can connect to the topology.
-// If readPreference is nil then will use the client's default read
-// preference.
+// Ping verifies that the client can connect to the primary.
 func (s *Session) Ping() error {
-	return s.client.Ping(context.TODO(), readpref.Primary())
+	return s.PingCtx(context.TODO())
+}
+
+// PingCtx is Ping with a caller supplied context, the read preference set on
+// ctx with WithOptions selects the member to ping instead of the primary
+func (s *Session) PingCtx(ctx context.Context) error {
+	rp := OptionsFrom(ctx).ReadPreference
+	if rp == nil {
+		rp = readpref.Primary()
+	}
+	return s.client.Ping(ctx, rp)
 }
 
 // Client return lib_mongo Client
@@ -115,7 +202,7 @@ func (s *Session) Client() *mongo.Client {
 
 // DB returns a value representing the named database.
 func (s *Session) DB(db string) *Database {
-	return &Database{database: s.client.Database(db)}
+	return &Database{database: s.client.Database(db), guard: s.guard}
 }
 
 // Limit specifies a limit on the number of results.
@@ -138,6 +225,24 @@ func (s *Session) Sort(sort interface{}) *Session {
 	return s
 }
 
+// BatchSize specifies the number of documents to return in every batch of the cursor.
+func (s *Session) BatchSize(size int32) *Session {
+	s.batchSize = &size
+	return s
+}
+
+// Options sets the read preference, read/write concern, collation, hint, maxTime and comment
+// of the query, they take precedence over the options set on the ctx with WithOptions
+func (s *Session) Options(opts ...OpOption) *Session {
+	s.op = s.op.apply(opts)
+	return s
+}
+
+// resolve returns the driver collection and the options of a query made with ctx
+func (s *Session) resolve(ctx context.Context) (*mongo.Collection, OpOptions) {
+	return resolveOptions(ctx, s.collection, s.op)
+}
+
 // Select is used to determine which fields are displayed or not displayed in the returned results
 // Format: bson.M{"age": 1} means that only the age field is displayed
 func (s *Session) Select(projection interface{}) *Session {
@@ -147,6 +252,14 @@ func (s *Session) Select(projection interface{}) *Session {
 
 // One returns one document
 func (s *Session) One(result interface{}) error {
+	return s.OneCtx(context.TODO(), result)
+}
+
+// OneCtx returns one document, the ctx is passed through to the driver
+func (s *Session) OneCtx(ctx context.Context, result interface{}) error {
+	if err := s.guard.check(ctx, s); err != nil {
+		return err
+	}
 	opt := options.FindOne()
 
 	if s.sort != nil {
@@ -158,10 +271,11 @@ func (s *Session) One(result interface{}) error {
 	}
 
 	if s.skip != nil {
-		opt.SetProjection(*s.skip)
+		opt.SetSkip(*s.skip)
 	}
 
-	data, err := s.collection.FindOne(context.TODO(), s.filter, opt).DecodeBytes()
+	coll, op := s.resolve(ctx)
+	data, err := coll.FindOne(ctx, s.filter, op.findOne(), opt).DecodeBytes()
 	if err != nil {
 		return err
 	}
@@ -171,9 +285,16 @@ func (s *Session) One(result interface{}) error {
 
 // All find all
 func (s *Session) All(result interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultFindTimeout)
+	defer cancel()
+	return s.AllCtx(ctx, result)
+}
+
+// AllCtx find all, the ctx is passed through to the driver
+func (s *Session) AllCtx(ctx context.Context, result interface{}) error {
 	resultv := reflect.ValueOf(result)
 	if resultv.Kind() != reflect.Ptr {
-		return fmt.Errorf("results argument must be a pointer to a slice, but was a %s", resultv.Kind())
+		return fmt.Errorf("%w: results argument must be a pointer to a slice, but was a %s", ErrorResultType, resultv.Kind())
 	}
 	slicev := resultv.Elem()
 
@@ -181,15 +302,26 @@ func (s *Session) All(result interface{}) error {
 		slicev = slicev.Elem()
 	}
 	if slicev.Kind() != reflect.Slice {
-		return fmt.Errorf("results argument must be a pointer to a slice, but was a pointer to %s", slicev.Kind())
+		return fmt.Errorf("%w: results argument must be a pointer to a slice, but was a pointer to %s", ErrorResultType, slicev.Kind())
 	}
 
 	slicev = slicev.Slice(0, slicev.Cap())
-	elemt := slicev.Type().Elem()
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
 	var err error
 
+	if err = s.guard.check(ctx, s); err != nil {
+		return err
+	}
+	coll, op := s.resolve(ctx)
+	cur, err := coll.Find(ctx, s.filter, op.find(), s.findOptions())
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	return readAll(ctx, cur, resultv, slicev)
+}
+
+// findOptions builds the find options from the builder
+func (s *Session) findOptions() *options.FindOptions {
 	opt := options.Find()
 
 	if s.sort != nil {
@@ -208,32 +340,25 @@ func (s *Session) All(result interface{}) error {
 		opt.SetSkip(*s.skip)
 	}
 
-	cur, err := s.collection.Find(ctx, s.filter, opt)
-	defer cur.Close(ctx)
-	if err != nil {
-		return err
-	}
-	if err = cur.Err(); err != nil {
-		return err
+	if s.batchSize != nil {
+		opt.SetBatchSize(*s.batchSize)
 	}
-	i := 0
-	for cur.Next(ctx) {
-		elemp := reflect.New(elemt)
-		if err = bson.Unmarshal(cur.Current, elemp.Interface()); err != nil {
-			return err
-		}
-		slicev = reflect.Append(slicev, elemp.Elem())
-		i++
-	}
-	resultv.Elem().Set(slicev.Slice(0, i))
-	return nil
+
+	return opt
 }
 
 // Pipe find all
 func (s *Session) Pipe(pipeline, result interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultPipeTimeout)
+	defer cancel()
+	return s.PipeCtx(ctx, pipeline, result)
+}
+
+// PipeCtx find all, the ctx is passed through to the driver
+func (s *Session) PipeCtx(ctx context.Context, pipeline, result interface{}) error {
 	resultv := reflect.ValueOf(result)
 	if resultv.Kind() != reflect.Ptr {
-		panic("result argument must be a slice address")
+		return fmt.Errorf("%w: results argument must be a pointer to a slice, but was a %s", ErrorResultType, resultv.Kind())
 	}
 	slicev := resultv.Elem()
 
@@ -241,47 +366,62 @@ func (s *Session) Pipe(pipeline, result interface{}) error {
 		slicev = slicev.Elem()
 	}
 	if slicev.Kind() != reflect.Slice {
-		panic("result argument must be a slice address")
+		return fmt.Errorf("%w: results argument must be a pointer to a slice, but was a pointer to %s", ErrorResultType, slicev.Kind())
 	}
 
 	slicev = slicev.Slice(0, slicev.Cap())
-	elemt := slicev.Type().Elem()
-
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-	defer cancel()
 
 	opts := options.Aggregate()
 	opts.SetAllowDiskUse(true)
 	opts.SetBatchSize(5)
 
-	cur, err := s.collection.Aggregate(ctx, pipeline, opts)
+	coll, op := s.resolve(ctx)
+	cur, err := coll.Aggregate(ctx, pipeline, op.aggregate(), opts)
 	if err != nil {
 		return err
 	}
 	defer cur.Close(ctx)
+	return readAll(ctx, cur, resultv, slicev)
+}
 
-	if err = cur.Err(); err != nil {
-		return err
-	}
+// resultCursor is the part of *mongo.Cursor read by readAll
+type resultCursor interface {
+	Next(ctx context.Context) bool
+	Decode(val interface{}) error
+	Err() error
+}
+
+// readAll appends every document of cur to slicev and sets it into resultv.
+// The error that ended the iteration, e.g. a canceled ctx or a failed getMore,
+// is returned instead of a truncated result.
+func readAll(ctx context.Context, cur resultCursor, resultv, slicev reflect.Value) error {
+	elemt := slicev.Type().Elem()
 	i := 0
 	for cur.Next(ctx) {
 		elemp := reflect.New(elemt)
-		if err = bson.Unmarshal(cur.Current, elemp.Interface()); err != nil {
+		if err := cur.Decode(elemp.Interface()); err != nil {
 			return err
 		}
 		slicev = reflect.Append(slicev, elemp.Elem())
 		i++
 	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
 	resultv.Elem().Set(slicev.Slice(0, i))
 	return nil
 }
 
 func (s *Session) Distinct(distinct string) ([]interface{}, error) {
-
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), defaultPipeTimeout)
 	defer cancel()
+	return s.DistinctCtx(ctx, distinct)
+}
 
-	result, err := s.collection.Distinct(ctx, distinct, s.filter)
+// DistinctCtx returns the distinct values of a field, the ctx is passed through to the driver
+func (s *Session) DistinctCtx(ctx context.Context, distinct string) ([]interface{}, error) {
+	coll, op := s.resolve(ctx)
+	result, err := coll.Distinct(ctx, distinct, s.filter, op.distinct())
 	if err != nil {
 		return nil, err
 	}
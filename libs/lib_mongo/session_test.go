@@ -0,0 +1,83 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc:
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// cancelCursor 返回docs，ctx取消后停止迭代并在Err中返回ctx的错误
+type cancelCursor struct {
+	docs []interface{}
+	cur  interface{}
+	err  error
+}
+
+func (c *cancelCursor) Next(ctx context.Context) bool {
+	if c.err = ctx.Err(); c.err != nil || len(c.docs) == 0 {
+		return false
+	}
+	c.cur, c.docs = c.docs[0], c.docs[1:]
+	return true
+}
+
+func (c *cancelCursor) Decode(val interface{}) error {
+	data, err := bson.Marshal(c.cur)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, val)
+}
+
+func (c *cancelCursor) Err() error {
+	return c.err
+}
+
+func TestReadAll(t *testing.T) {
+	type profile struct {
+		ID   int32  `bson:"_id"`
+		Name string `bson:"name"`
+	}
+	decode := func(ctx context.Context, cur resultCursor, result *[]profile) error {
+		resultv := reflect.ValueOf(result)
+		return readAll(ctx, cur, resultv, resultv.Elem())
+	}
+	docs := []interface{}{bson.M{"_id": 1, "name": "alice"}, bson.M{"_id": 2, "name": "bob"}}
+
+	Convey("test read all", t, func() {
+		Convey("every document is decoded", func() {
+			cur, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+			So(err, ShouldBeNil)
+			var result []profile
+			So(decode(context.TODO(), cur, &result), ShouldBeNil)
+			So(result, ShouldResemble, []profile{{ID: 1, Name: "alice"}, {ID: 2, Name: "bob"}})
+		})
+
+		Convey("a canceled ctx fails instead of truncating the result", func() {
+			ctx, cancel := context.WithCancel(context.TODO())
+			cur := &cancelCursor{docs: docs}
+			So(cur.Next(ctx), ShouldBeTrue)
+			cancel()
+
+			result := []profile{{ID: 9}}
+			err := decode(ctx, cur, &result)
+			So(errors.Is(err, context.Canceled), ShouldBeTrue)
+			So(result, ShouldResemble, []profile{{ID: 9}})
+		})
+
+		Convey("decode errors stop the iteration", func() {
+			cur := &cancelCursor{docs: []interface{}{bson.M{"_id": "x"}}}
+			var result []profile
+			So(decode(context.TODO(), cur, &result), ShouldNotBeNil)
+		})
+	})
+}
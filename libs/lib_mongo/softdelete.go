@@ -0,0 +1,311 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: 软删除，删除时设置deleted_at，查询时过滤已删除文档
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 软删除时间字段
+const DeletedAtField = "deleted_at"
+
+type withDeletedKey struct{}
+
+// WithDeleted returns a ctx whose Find*Ctx calls on a SoftDeleteDB include the deleted documents
+func WithDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withDeletedKey{}, true)
+}
+
+func includeDeleted(ctx context.Context) bool {
+	v, _ := ctx.Value(withDeletedKey{}).(bool)
+	return v
+}
+
+var notDeleted = bson.M{DeletedAtField: bson.M{"$exists": false}}
+
+// ErrNotSoftDeleted is returned by Restore and Purge on collections without soft delete
+var ErrNotSoftDeleted = errors.New("soft delete is not enabled")
+
+// SoftDeleter restores and purges soft deleted documents. SoftDeleteDB implements
+// it, HookDB and TenantDB forward it to the SoftDeleteDB they wrap, TenantDB only
+// for the documents of the ctx tenant.
+//
+//	if sd, ok := env.MongoCli.(lib_mongo.SoftDeleter); ok && sd.SoftDeleted("profile") {
+//		err = sd.Restore(ctx, "profile", bson.M{"_id": id}, false)
+//	}
+type SoftDeleter interface {
+	SoftDeleted(name string) bool
+	Restore(ctx context.Context, name string, query interface{}, multi bool) error
+	Purge(ctx context.Context, name string, olderThan time.Duration) error
+	// purge 只清理query匹配的文档，TenantDB用于限定租户
+	purge(ctx context.Context, name string, query interface{}, olderThan time.Duration) error
+}
+
+// SoftDeleteDB wraps a DBAdaptor so that the listed collections are soft deleted:
+// Remove* and FindOneAndDelete set deleted_at instead of deleting, and the Find*
+// methods, ForEach and the aggregations skip deleted documents unless the ctx
+// comes from WithDeleted. Update* and BulkWrite are passed through unchanged.
+//
+//	env.MongoCli = lib_mongo.NewSoftDelete(mongoCli, "profile", "orders")
+type SoftDeleteDB struct {
+	DBAdaptor
+	collections map[string]bool
+}
+
+// NewSoftDelete enables soft delete on the collections of db
+func NewSoftDelete(db DBAdaptor, collections ...string) *SoftDeleteDB {
+	s := &SoftDeleteDB{DBAdaptor: db, collections: make(map[string]bool, len(collections))}
+	for _, name := range collections {
+		s.collections[name] = true
+	}
+	return s
+}
+
+// Unscoped returns the wrapped DBAdaptor, which sees and hard deletes every document
+func (s *SoftDeleteDB) Unscoped() DBAdaptor {
+	return s.DBAdaptor
+}
+
+// SoftDeleted reports whether the collection is soft deleted
+func (s *SoftDeleteDB) SoftDeleted(name string) bool {
+	return s.collections[name]
+}
+
+// scope adds the not deleted condition to query
+func (s *SoftDeleteDB) scope(ctx context.Context, name string, query interface{}) interface{} {
+	if !s.collections[name] || includeDeleted(ctx) {
+		return query
+	}
+	if query == nil {
+		return notDeleted
+	}
+	return bson.M{"$and": bson.A{query, notDeleted}}
+}
+
+// scopePipeline prepends a $match of the not deleted documents
+func (s *SoftDeleteDB) scopePipeline(ctx context.Context, name string, pipeline interface{}) interface{} {
+	if !s.collections[name] || includeDeleted(ctx) {
+		return pipeline
+	}
+	stages, ok := toList(pipeline)
+	if !ok {
+		return pipeline
+	}
+	return append(bson.A{bson.M{"$match": notDeleted}}, stages...)
+}
+
+func (s *SoftDeleteDB) FindOne(name string, query, result interface{}) (err error, exist bool) {
+	return s.DBAdaptor.FindOne(name, s.scope(context.TODO(), name, query), result)
+}
+
+func (s *SoftDeleteDB) FindOneCtx(ctx context.Context, name string, query, result interface{}) (err error, exist bool) {
+	return s.DBAdaptor.FindOneCtx(ctx, name, s.scope(ctx, name, query), result)
+}
+
+func (s *SoftDeleteDB) Find(name string, query, result interface{}, limit int64) error {
+	return s.DBAdaptor.Find(name, s.scope(context.TODO(), name, query), result, limit)
+}
+
+func (s *SoftDeleteDB) FindCtx(ctx context.Context, name string, query, result interface{}, limit int64) error {
+	return s.DBAdaptor.FindCtx(ctx, name, s.scope(ctx, name, query), result, limit)
+}
+
+func (s *SoftDeleteDB) FindAll(name string, query, result interface{}) error {
+	return s.DBAdaptor.FindAll(name, s.scope(context.TODO(), name, query), result)
+}
+
+func (s *SoftDeleteDB) FindAllCtx(ctx context.Context, name string, query, result interface{}) error {
+	return s.DBAdaptor.FindAllCtx(ctx, name, s.scope(ctx, name, query), result)
+}
+
+func (s *SoftDeleteDB) FindByLimitAndSkip(name string, query, result interface{}, limit, skip int64) error {
+	return s.DBAdaptor.FindByLimitAndSkip(name, s.scope(context.TODO(), name, query), result, limit, skip)
+}
+
+func (s *SoftDeleteDB) FindByLimitAndSkipCtx(ctx context.Context, name string, query, result interface{}, limit, skip int64) error {
+	return s.DBAdaptor.FindByLimitAndSkipCtx(ctx, name, s.scope(ctx, name, query), result, limit, skip)
+}
+
+func (s *SoftDeleteDB) FindWithSelect(name string, query, selection, result interface{}, limit int64) error {
+	return s.DBAdaptor.FindWithSelect(name, s.scope(context.TODO(), name, query), selection, result, limit)
+}
+
+func (s *SoftDeleteDB) FindWithSelectCtx(ctx context.Context, name string, query, selection, result interface{}, limit int64) error {
+	return s.DBAdaptor.FindWithSelectCtx(ctx, name, s.scope(ctx, name, query), selection, result, limit)
+}
+
+func (s *SoftDeleteDB) FindSelect(name string, query, selection, result interface{}) error {
+	return s.DBAdaptor.FindSelect(name, s.scope(context.TODO(), name, query), selection, result)
+}
+
+func (s *SoftDeleteDB) FindSelectCtx(ctx context.Context, name string, query, selection, result interface{}) error {
+	return s.DBAdaptor.FindSelectCtx(ctx, name, s.scope(ctx, name, query), selection, result)
+}
+
+func (s *SoftDeleteDB) FindWithMultiple(name string, query, selection, sorter, result interface{}, limit, skip int64) error {
+	return s.DBAdaptor.FindWithMultiple(name, s.scope(context.TODO(), name, query), selection, sorter, result, limit, skip)
+}
+
+func (s *SoftDeleteDB) FindWithMultipleCtx(ctx context.Context, name string, query, selection, sorter, result interface{}, limit, skip int64) error {
+	return s.DBAdaptor.FindWithMultipleCtx(ctx, name, s.scope(ctx, name, query), selection, sorter, result, limit, skip)
+}
+
+func (s *SoftDeleteDB) FindCount(name string, query interface{}) (int64, error) {
+	return s.DBAdaptor.FindCount(name, s.scope(context.TODO(), name, query))
+}
+
+func (s *SoftDeleteDB) FindCountCtx(ctx context.Context, name string, query interface{}) (int64, error) {
+	return s.DBAdaptor.FindCountCtx(ctx, name, s.scope(ctx, name, query))
+}
+
+func (s *SoftDeleteDB) FindSortByLimitAndSkip(name string, query, sorter, result interface{}, limit, skip int64) error {
+	return s.DBAdaptor.FindSortByLimitAndSkip(name, s.scope(context.TODO(), name, query), sorter, result, limit, skip)
+}
+
+func (s *SoftDeleteDB) FindSortByLimitAndSkipCtx(ctx context.Context, name string, query, sorter, result interface{}, limit, skip int64) error {
+	return s.DBAdaptor.FindSortByLimitAndSkipCtx(ctx, name, s.scope(ctx, name, query), sorter, result, limit, skip)
+}
+
+func (s *SoftDeleteDB) FindWithAggregation(name string, pipeline, result interface{}) error {
+	return s.DBAdaptor.FindWithAggregation(name, s.scopePipeline(context.TODO(), name, pipeline), result)
+}
+
+func (s *SoftDeleteDB) FindWithAggregationCtx(ctx context.Context, name string, pipeline, result interface{}) error {
+	return s.DBAdaptor.FindWithAggregationCtx(ctx, name, s.scopePipeline(ctx, name, pipeline), result)
+}
+
+func (s *SoftDeleteDB) FindWithDistinct(name, distinct string, query interface{}) ([]interface{}, error) {
+	return s.DBAdaptor.FindWithDistinct(name, distinct, s.scope(context.TODO(), name, query))
+}
+
+func (s *SoftDeleteDB) FindWithDistinctCtx(ctx context.Context, name, distinct string, query interface{}) ([]interface{}, error) {
+	return s.DBAdaptor.FindWithDistinctCtx(ctx, name, distinct, s.scope(ctx, name, query))
+}
+
+func (s *SoftDeleteDB) ForEach(name string, query interface{}, fn func(raw bson.Raw) error) error {
+	return s.DBAdaptor.ForEach(name, s.scope(context.TODO(), name, query), fn)
+}
+
+func (s *SoftDeleteDB) ForEachCtx(ctx context.Context, name string, query interface{}, fn func(raw bson.Raw) error) error {
+	return s.DBAdaptor.ForEachCtx(ctx, name, s.scope(ctx, name, query), fn)
+}
+
+func (s *SoftDeleteDB) scopedPipeline(ctx context.Context, name string, p *Pipeline) *Pipeline {
+	if !s.collections[name] || includeDeleted(ctx) {
+		return p
+	}
+	stages := append(mongo.Pipeline{{{Key: "$match", Value: notDeleted}}}, p.stages...)
+	return &Pipeline{stages: stages, opts: p.opts}
+}
+
+func (s *SoftDeleteDB) Aggregate(ctx context.Context, name string, p *Pipeline) (*Iter, error) {
+	return s.DBAdaptor.Aggregate(ctx, name, s.scopedPipeline(ctx, name, p))
+}
+
+func (s *SoftDeleteDB) AggregateAll(ctx context.Context, name string, p *Pipeline, result interface{}) error {
+	return s.DBAdaptor.AggregateAll(ctx, name, s.scopedPipeline(ctx, name, p), result)
+}
+
+func (s *SoftDeleteDB) FindOneAndUpdate(name string, filter, update interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return s.FindOneAndUpdateCtx(context.TODO(), name, filter, update, opt, result)
+}
+
+func (s *SoftDeleteDB) FindOneAndUpdateCtx(ctx context.Context, name string, filter, update interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return s.DBAdaptor.FindOneAndUpdateCtx(ctx, name, s.scope(ctx, name, filter), update, opt, result)
+}
+
+func (s *SoftDeleteDB) FindOneAndReplace(name string, filter, replacement interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return s.FindOneAndReplaceCtx(context.TODO(), name, filter, replacement, opt, result)
+}
+
+func (s *SoftDeleteDB) FindOneAndReplaceCtx(ctx context.Context, name string, filter, replacement interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return s.DBAdaptor.FindOneAndReplaceCtx(ctx, name, s.scope(ctx, name, filter), replacement, opt, result)
+}
+
+func (s *SoftDeleteDB) FindOneAndDelete(name string, filter interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return s.FindOneAndDeleteCtx(context.TODO(), name, filter, opt, result)
+}
+
+// FindOneAndDeleteCtx sets deleted_at and returns the document before
+func (s *SoftDeleteDB) FindOneAndDeleteCtx(ctx context.Context, name string, filter interface{}, opt FindAndModifyOptions, result interface{}) error {
+	if !s.collections[name] {
+		return s.DBAdaptor.FindOneAndDeleteCtx(ctx, name, filter, opt, result)
+	}
+	opt.Upsert, opt.ReturnNew = false, false
+	update := bson.M{"$set": bson.M{DeletedAtField: time.Now()}}
+	return s.DBAdaptor.FindOneAndUpdateCtx(ctx, name, bson.M{"$and": bson.A{filterOrAll(filter), notDeleted}}, update, opt, result)
+}
+
+func (s *SoftDeleteDB) Remove(name string, query interface{}, multi bool) error {
+	return s.RemoveCtx(context.TODO(), name, query, multi)
+}
+
+// RemoveCtx sets deleted_at on the matching documents that are not deleted yet
+func (s *SoftDeleteDB) RemoveCtx(ctx context.Context, name string, query interface{}, multi bool) error {
+	if !s.collections[name] {
+		return s.DBAdaptor.RemoveCtx(ctx, name, query, multi)
+	}
+	update := bson.M{"$set": bson.M{DeletedAtField: time.Now()}}
+	return s.update(ctx, name, bson.M{"$and": bson.A{filterOrAll(query), notDeleted}}, update, multi)
+}
+
+func (s *SoftDeleteDB) RemoveById(name string, id interface{}) error {
+	return s.RemoveByIdCtx(context.TODO(), name, id)
+}
+
+func (s *SoftDeleteDB) RemoveByIdCtx(ctx context.Context, name string, id interface{}) error {
+	return s.RemoveCtx(ctx, name, bson.M{"_id": id}, false)
+}
+
+// Restore clears deleted_at of the matching deleted documents
+func (s *SoftDeleteDB) Restore(ctx context.Context, name string, query interface{}, multi bool) error {
+	if !s.collections[name] {
+		return fmt.Errorf("%w: %s", ErrNotSoftDeleted, name)
+	}
+	filter := bson.M{"$and": bson.A{filterOrAll(query), bson.M{DeletedAtField: bson.M{"$exists": true}}}}
+	return s.update(ctx, name, filter, bson.M{"$unset": bson.M{DeletedAtField: ""}}, multi)
+}
+
+// update 不upsert的原始更新，UpdateRaw总是upsert，会为不存在或已删除的文档插入新文档
+func (s *SoftDeleteDB) update(ctx context.Context, name string, filter, update interface{}, multi bool) error {
+	b := NewBulk()
+	if multi {
+		b.UpdateMany(filter, update, false)
+	} else {
+		b.UpdateOne(filter, update, false)
+	}
+	_, err := s.DBAdaptor.BulkWriteCtx(ctx, name, b)
+	return err
+}
+
+// Purge hard deletes the documents deleted more than olderThan ago
+func (s *SoftDeleteDB) Purge(ctx context.Context, name string, olderThan time.Duration) error {
+	return s.purge(ctx, name, nil, olderThan)
+}
+
+func (s *SoftDeleteDB) purge(ctx context.Context, name string, query interface{}, olderThan time.Duration) error {
+	if !s.collections[name] {
+		return fmt.Errorf("%w: %s", ErrNotSoftDeleted, name)
+	}
+	filter := bson.M{DeletedAtField: bson.M{"$lt": time.Now().Add(-olderThan)}}
+	if query != nil {
+		filter = bson.M{"$and": bson.A{query, filter}}
+	}
+	return s.DBAdaptor.RemoveCtx(ctx, name, filter, true)
+}
+
+// WithTransaction runs fn with a tx that is soft deleted as well
+func (s *SoftDeleteDB) WithTransaction(ctx context.Context, fn func(tx DBAdaptor) error, opts ...*options.TransactionOptions) error {
+	return s.DBAdaptor.WithTransaction(ctx, func(tx DBAdaptor) error {
+		return fn(&SoftDeleteDB{DBAdaptor: tx, collections: s.collections})
+	}, opts...)
+}
@@ -0,0 +1,163 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc:
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSoftDelete(t *testing.T) {
+	type profile struct {
+		ID        int32      `bson:"_id"`
+		Name      string     `bson:"name"`
+		DeletedAt *time.Time `bson:"deleted_at,omitempty"`
+	}
+
+	Convey("test soft delete", t, func() {
+		mem := NewMemorySession()
+		db := NewSoftDelete(mem, "profile")
+		ctx := context.TODO()
+		So(db.InsertAll("profile", &profile{ID: 1, Name: "alice"}, &profile{ID: 2, Name: "bob"}, &profile{ID: 3, Name: "carol"}), ShouldBeNil)
+		So(db.InsertAll("log", bson.M{"_id": 1}, bson.M{"_id": 2}), ShouldBeNil)
+
+		So(db.RemoveById("profile", 1), ShouldBeNil)
+		So(db.Remove("log", bson.M{"_id": 1}, false), ShouldBeNil)
+
+		Convey("find skips deleted documents", func() {
+			c, err := db.FindCount("profile", nil)
+			So(err, ShouldBeNil)
+			So(c, ShouldEqual, 2)
+			var p profile
+			err, _ = db.FindOne("profile", bson.M{"_id": 1}, &p)
+			So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+
+			var docs []profile
+			So(db.FindAllCtx(WithDeleted(ctx), "profile", nil, &docs), ShouldBeNil)
+			So(len(docs), ShouldEqual, 3)
+			So(docs[0].DeletedAt, ShouldNotBeNil)
+
+			var counts []bson.M
+			So(db.AggregateAll(ctx, "profile", NewPipeline().Count("n"), &counts), ShouldBeNil)
+			So(counts[0]["n"], ShouldEqual, 2)
+			So(db.FindWithAggregation("profile", bson.A{bson.M{"$count": "n"}}, &counts), ShouldBeNil)
+			So(counts[0]["n"], ShouldEqual, 2)
+
+			// 未启用软删除的集合直接删除
+			c, err = mem.FindCount("log", nil)
+			So(err, ShouldBeNil)
+			So(c, ShouldEqual, 1)
+		})
+
+		Convey("find one and delete", func() {
+			var p profile
+			So(db.FindOneAndDelete("profile", nil, FindAndModifyOptions{Sort: bson.M{"_id": 1}}, &p), ShouldBeNil)
+			So(p.Name, ShouldEqual, "bob")
+			c, err := mem.FindCount("profile", nil)
+			So(err, ShouldBeNil)
+			So(c, ShouldEqual, 3)
+		})
+
+		Convey("restore and purge", func() {
+			So(db.Restore(ctx, "profile", bson.M{"_id": 1}, false), ShouldBeNil)
+			c, err := db.FindCount("profile", nil)
+			So(err, ShouldBeNil)
+			So(c, ShouldEqual, 3)
+
+			So(db.Remove("profile", bson.M{"name": bson.M{"$in": bson.A{"alice", "bob"}}}, true), ShouldBeNil)
+			So(db.Purge(ctx, "profile", time.Hour), ShouldBeNil)
+			c, err = mem.FindCount("profile", nil)
+			So(err, ShouldBeNil)
+			So(c, ShouldEqual, 3)
+			So(db.Purge(ctx, "profile", -time.Second), ShouldBeNil)
+			c, err = mem.FindCount("profile", nil)
+			So(err, ShouldBeNil)
+			So(c, ShouldEqual, 1)
+		})
+
+		Convey("remove and restore never insert", func() {
+			So(db.RemoveById("profile", 9), ShouldBeNil)
+			So(db.RemoveById("profile", 1), ShouldBeNil)
+			So(db.Restore(ctx, "profile", bson.M{"_id": 2}, false), ShouldBeNil)
+			So(db.Restore(ctx, "profile", bson.M{"name": "dave"}, true), ShouldBeNil)
+			c, err := mem.FindCount("profile", nil)
+			So(err, ShouldBeNil)
+			So(c, ShouldEqual, 3)
+
+			var p profile
+			err, _ = mem.FindOne("profile", bson.M{"_id": 2}, &p)
+			So(err, ShouldBeNil)
+			So(p.DeletedAt, ShouldBeNil)
+		})
+
+		Convey("restore and purge need soft delete", func() {
+			So(errors.Is(db.Purge(ctx, "log", 0), ErrNotSoftDeleted), ShouldBeTrue)
+			So(errors.Is(db.Restore(ctx, "log", nil, true), ErrNotSoftDeleted), ShouldBeTrue)
+			c, err := mem.FindCount("log", nil)
+			So(err, ShouldBeNil)
+			So(c, ShouldEqual, 1)
+		})
+
+		Convey("transaction keeps soft delete", func() {
+			err := db.WithTransaction(ctx, func(tx DBAdaptor) error {
+				return tx.RemoveById("profile", 2)
+			})
+			So(err, ShouldBeNil)
+			c, err := mem.FindCount("profile", nil)
+			So(err, ShouldBeNil)
+			So(c, ShouldEqual, 3)
+		})
+	})
+
+	Convey("test soft delete through hooks and tenants", t, func() {
+		type doc struct {
+			ID       int32      `bson:"_id"`
+			TenantID string     `bson:"tenant_id,omitempty"`
+			Deleted  *time.Time `bson:"deleted_at,omitempty"`
+		}
+		mem := NewMemorySession()
+		hooks := NewHookDB(NewSoftDelete(mem, "profile"))
+		var db DBAdaptor = NewTenantDB(hooks, TenantOptions{})
+		acme := WithTenant(context.Background(), "acme")
+		globex := WithTenant(context.Background(), "globex")
+		So(db.InsertCtx(acme, "profile", &doc{ID: 1}), ShouldBeNil)
+		So(db.InsertCtx(globex, "profile", &doc{ID: 2}), ShouldBeNil)
+		So(db.RemoveCtx(acme, "profile", nil, true), ShouldBeNil)
+		So(db.RemoveCtx(globex, "profile", nil, true), ShouldBeNil)
+
+		sd, ok := db.(SoftDeleter)
+		So(ok, ShouldBeTrue)
+		So(sd.SoftDeleted("profile"), ShouldBeTrue)
+		So(sd.SoftDeleted("log"), ShouldBeFalse)
+		So(errors.Is(sd.Restore(context.Background(), "profile", nil, true), ErrNoTenant), ShouldBeTrue)
+
+		// 只恢复与清理当前租户的文档
+		So(sd.Restore(acme, "profile", nil, true), ShouldBeNil)
+		n, err := db.FindCountCtx(acme, "profile", nil)
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 1)
+		n, err = db.FindCountCtx(globex, "profile", nil)
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 0)
+
+		So(sd.Purge(acme, "profile", -time.Second), ShouldBeNil)
+		n, _ = mem.FindCount("profile", nil)
+		So(n, ShouldEqual, 2)
+		So(sd.Purge(globex, "profile", -time.Second), ShouldBeNil)
+		n, _ = mem.FindCount("profile", nil)
+		So(n, ShouldEqual, 1)
+
+		// 硬删除
+		So(hooks.Unscoped().RemoveById("profile", 1), ShouldBeNil)
+		n, _ = mem.FindCount("profile", nil)
+		So(n, ShouldEqual, 0)
+		So(errors.Is(NewHookDB(mem).Purge(acme, "profile", 0), ErrNotSoftDeleted), ShouldBeTrue)
+	})
+}
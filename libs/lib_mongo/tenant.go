@@ -0,0 +1,850 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: 多租户路由，按租户字段或按库隔离
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 默认租户字段
+const TenantField = "tenant_id"
+
+var (
+	// ctx中没有租户或租户不合法
+	ErrNoTenant = errors.New("no tenant")
+	// 操作会读写其他租户的数据
+	ErrCrossTenant = errors.New("cross tenant access")
+)
+
+// 租户同时用作库名后缀，只允许字母数字、下划线和中划线
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,48}$`)
+
+type tenantKey struct{}
+
+// WithTenant returns a ctx whose operations on a TenantDB go to tenant
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFrom returns the tenant of ctx
+func TenantFrom(ctx context.Context) (string, bool) {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant, tenant != ""
+}
+
+// ValidTenant reports whether tenant can be used as a tenant id
+func ValidTenant(tenant string) bool {
+	return tenantPattern.MatchString(tenant)
+}
+
+// TenantOptions configures a TenantDB
+type TenantOptions struct {
+	// 按字段隔离时的租户字段，默认tenant_id
+	Field string
+	// 不区分租户的集合，如租户列表
+	Shared []string
+	// 按库隔离时返回租户的DBAdaptor，每个租户只调用一次，ctx的超时为InitTimeout；为nil时按字段隔离
+	Database func(ctx context.Context, tenant string) (DBAdaptor, error)
+	// 按库隔离时必须设置，只为返回true的租户创建库，防止任意租户创建库
+	Known func(ctx context.Context, tenant string) (bool, error)
+	// Database的超时时间，默认30秒
+	InitTimeout time.Duration
+}
+
+// 按库隔离时创建租户库的默认超时时间
+const defaultTenantInitTimeout = 30 * time.Second
+
+// TenantDB routes every operation to the tenant of its ctx. Without Database the
+// tenant field is added to every filter and written document, otherwise each
+// tenant has its own database, created on first use for the tenants Known accepts.
+// The operations of a ctx without a tenant, or with an unknown one, and so every
+// method without ctx, fail with ErrNoTenant except on the Shared collections.
+//
+// With the tenant field, updates of the field, $lookup/$graphLookup/$unionWith
+// from and $merge/$out into collections that are not shared fail with
+// ErrCrossTenant, the sequences of GetNextSequence are per tenant, and Watch only
+// sees the changes whose full document or pre-image belongs to the tenant.
+type TenantDB struct {
+	DBAdaptor
+	field       string
+	shared      map[string]bool
+	database    func(ctx context.Context, tenant string) (DBAdaptor, error)
+	known       func(ctx context.Context, tenant string) (bool, error)
+	initTimeout time.Duration
+
+	m   sync.Mutex
+	dbs map[string]DBAdaptor
+	// 正在创建的租户库，同一租户的并发请求等待同一次创建
+	creating map[string]*tenantInit
+}
+
+type tenantInit struct {
+	done chan struct{}
+	db   DBAdaptor
+	err  error
+}
+
+// NewTenantDB wraps db
+func NewTenantDB(db DBAdaptor, opt TenantOptions) *TenantDB {
+	t := &TenantDB{
+		DBAdaptor:   db,
+		field:       opt.Field,
+		shared:      map[string]bool{SequenceCollection: true},
+		database:    opt.Database,
+		known:       opt.Known,
+		initTimeout: opt.InitTimeout,
+		dbs:         map[string]DBAdaptor{},
+		creating:    map[string]*tenantInit{},
+	}
+	if t.field == "" {
+		t.field = TenantField
+	}
+	if t.initTimeout <= 0 {
+		t.initTimeout = defaultTenantInitTimeout
+	}
+	for _, name := range opt.Shared {
+		t.shared[name] = true
+	}
+	return t
+}
+
+// Unscoped returns the wrapped DBAdaptor, which sees every tenant
+func (t *TenantDB) Unscoped() DBAdaptor {
+	return t.DBAdaptor
+}
+
+// softDeleter 租户所在的SoftDeleter
+func (t *TenantDB) softDeleter(ctx context.Context, name string) (SoftDeleter, tenantScope, error) {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return nil, s, err
+	}
+	sd, ok := s.db.(SoftDeleter)
+	if !ok {
+		return nil, s, fmt.Errorf("%w: %s", ErrNotSoftDeleted, name)
+	}
+	return sd, s, nil
+}
+
+// SoftDeleted see SoftDeleteDB.SoftDeleted
+func (t *TenantDB) SoftDeleted(name string) bool {
+	sd, ok := t.DBAdaptor.(SoftDeleter)
+	return ok && sd.SoftDeleted(name)
+}
+
+// Restore restores the matching deleted documents of the ctx tenant, see SoftDeleteDB.Restore
+func (t *TenantDB) Restore(ctx context.Context, name string, query interface{}, multi bool) error {
+	sd, s, err := t.softDeleter(ctx, name)
+	if err != nil {
+		return err
+	}
+	return sd.Restore(ctx, name, s.filter(query), multi)
+}
+
+// Purge purges the deleted documents of the ctx tenant, see SoftDeleteDB.Purge
+func (t *TenantDB) Purge(ctx context.Context, name string, olderThan time.Duration) error {
+	return t.purge(ctx, name, nil, olderThan)
+}
+
+func (t *TenantDB) purge(ctx context.Context, name string, query interface{}, olderThan time.Duration) error {
+	sd, s, err := t.softDeleter(ctx, name)
+	if err != nil {
+		return err
+	}
+	return sd.purge(ctx, name, s.filter(query), olderThan)
+}
+
+// tenantDB returns the database of tenant, creating it once if Known accepts tenant.
+// The creation runs outside the lock, so other tenants are not blocked by it.
+func (t *TenantDB) tenantDB(ctx context.Context, tenant string) (DBAdaptor, error) {
+	t.m.Lock()
+	if db, ok := t.dbs[tenant]; ok {
+		t.m.Unlock()
+		return db, nil
+	}
+	t.m.Unlock()
+
+	if t.known == nil {
+		return nil, fmt.Errorf("%w: unknown tenant %q", ErrNoTenant, tenant)
+	}
+	known, err := t.known(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	if !known {
+		return nil, fmt.Errorf("%w: unknown tenant %q", ErrNoTenant, tenant)
+	}
+
+	t.m.Lock()
+	if db, ok := t.dbs[tenant]; ok {
+		t.m.Unlock()
+		return db, nil
+	}
+	p, ok := t.creating[tenant]
+	if !ok {
+		p = &tenantInit{done: make(chan struct{})}
+		t.creating[tenant] = p
+		// 不使用调用方的ctx：创建由等待的请求共享
+		go t.create(tenant, p)
+	}
+	t.m.Unlock()
+
+	select {
+	case <-p.done:
+		return p.db, p.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// create 创建租户库，失败时不缓存，下次请求重试
+func (t *TenantDB) create(tenant string, p *tenantInit) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.initTimeout)
+	defer cancel()
+	p.db, p.err = t.database(ctx, tenant)
+
+	t.m.Lock()
+	delete(t.creating, tenant)
+	if p.err == nil {
+		t.dbs[tenant] = p.db
+	}
+	t.m.Unlock()
+	close(p.done)
+}
+
+// tenantScope is where an operation of a tenant goes
+type tenantScope struct {
+	db     DBAdaptor
+	tenant string
+	// 需要注入的租户字段，按库隔离或共享集合时为空
+	field  string
+	shared map[string]bool
+}
+
+// scope resolves the tenant of ctx for collection name
+func (t *TenantDB) scope(ctx context.Context, name string) (tenantScope, error) {
+	if name != "" && t.shared[name] {
+		return tenantScope{db: t.DBAdaptor}, nil
+	}
+	tenant, ok := TenantFrom(ctx)
+	if !ok {
+		return tenantScope{}, fmt.Errorf("%w: %s", ErrNoTenant, name)
+	}
+	if !ValidTenant(tenant) {
+		return tenantScope{}, fmt.Errorf("%w: invalid tenant %q", ErrNoTenant, tenant)
+	}
+	if t.database != nil {
+		db, err := t.tenantDB(ctx, tenant)
+		return tenantScope{db: db, tenant: tenant}, err
+	}
+	return tenantScope{db: t.DBAdaptor, tenant: tenant, field: t.field, shared: t.shared}, nil
+}
+
+// filter adds the tenant condition to query
+func (s tenantScope) filter(query interface{}) interface{} {
+	if s.field == "" {
+		return query
+	}
+	cond := bson.M{s.field: s.tenant}
+	if query == nil {
+		return cond
+	}
+	return bson.M{"$and": bson.A{query, cond}}
+}
+
+// doc sets the tenant field of a document to write
+func (s tenantScope) doc(v interface{}) (interface{}, error) {
+	if s.field == "" {
+		return v, nil
+	}
+	doc, err := toM(v)
+	if err != nil {
+		return nil, err
+	}
+	if tenant, ok := doc[s.field]; ok && tenant != s.tenant {
+		return nil, ErrCrossTenant
+	}
+	doc[s.field] = s.tenant
+	return doc, nil
+}
+
+// checkUpdate rejects updates that change the tenant field, its sub paths,
+// or $rename another field onto it
+func (s tenantScope) checkUpdate(update interface{}) error {
+	if s.field == "" {
+		return nil
+	}
+	doc, err := toM(update)
+	if err != nil {
+		return err
+	}
+	for key, value := range doc {
+		if !strings.HasPrefix(key, "$") {
+			if s.tenantPath(key) && (key != s.field || value != s.tenant) {
+				return ErrCrossTenant
+			}
+			continue
+		}
+		fields, ok := asM(value)
+		if !ok {
+			continue
+		}
+		for path, arg := range fields {
+			if s.tenantPath(path) {
+				return ErrCrossTenant
+			}
+			if to, _ := arg.(string); key == "$rename" && s.tenantPath(to) {
+				return ErrCrossTenant
+			}
+		}
+	}
+	return nil
+}
+
+// tenantPath 是否为租户字段或其子路径
+func (s tenantScope) tenantPath(path string) bool {
+	return path == s.field || strings.HasPrefix(path, s.field+".")
+}
+
+// checkStages rejects the stages reading or writing collections of every tenant,
+// including those in the sub-pipelines of $lookup, $unionWith and $facet
+func (s tenantScope) checkStages(stages []interface{}) error {
+	if s.field == "" {
+		return nil
+	}
+	for _, stage := range stages {
+		doc, err := toM(stage)
+		if err != nil {
+			return err
+		}
+		for key, value := range doc {
+			var from string
+			switch key {
+			case "$lookup", "$graphLookup":
+				spec, _ := asM(value)
+				from, _ = spec["from"].(string)
+				if err = s.checkSubPipeline(spec); err != nil {
+					return err
+				}
+			case "$unionWith":
+				if from, _ = value.(string); from == "" {
+					spec, _ := asM(value)
+					from, _ = spec["coll"].(string)
+					if err = s.checkSubPipeline(spec); err != nil {
+						return err
+					}
+				}
+			case "$merge", "$out":
+				// 写入其他集合会覆盖其他租户_id相同的文档，只允许写入本库的共享集合
+				from = outputCollection(key, value)
+			case "$facet":
+				spec, _ := asM(value)
+				for _, sub := range spec {
+					subStages, _ := toList(sub)
+					if err = s.checkStages(subStages); err != nil {
+						return err
+					}
+				}
+				continue
+			default:
+				continue
+			}
+			if !s.shared[from] {
+				return fmt.Errorf("%w: %s %s", ErrCrossTenant, key, from)
+			}
+		}
+	}
+	return nil
+}
+
+// checkSubPipeline 检查$lookup/$unionWith中的pipeline
+func (s tenantScope) checkSubPipeline(spec bson.M) error {
+	if spec["pipeline"] == nil {
+		return nil
+	}
+	stages, ok := toList(spec["pipeline"])
+	if !ok {
+		return fmt.Errorf("%w: pipeline must be a list of stages", ErrorResultType)
+	}
+	return s.checkStages(stages)
+}
+
+// outputCollection $merge/$out写入的集合，指定了db时返回空使其被拒绝
+func outputCollection(stage string, value interface{}) string {
+	if coll, ok := value.(string); ok {
+		return coll
+	}
+	spec, _ := asM(value)
+	if stage == "$merge" {
+		if into, ok := spec["into"].(string); ok {
+			return into
+		}
+		spec, _ = asM(spec["into"])
+	}
+	if spec["db"] != nil {
+		return ""
+	}
+	coll, _ := spec["coll"].(string)
+	return coll
+}
+
+// pipeline prepends the tenant $match to a pipeline of FindWithAggregation
+func (s tenantScope) pipeline(pipeline interface{}) (interface{}, error) {
+	if s.field == "" {
+		return pipeline, nil
+	}
+	stages, ok := toList(pipeline)
+	if !ok {
+		return nil, fmt.Errorf("%w: pipeline must be a list of stages", ErrorResultType)
+	}
+	if err := s.checkStages(stages); err != nil {
+		return nil, err
+	}
+	return append(bson.A{bson.M{"$match": bson.M{s.field: s.tenant}}}, stages...), nil
+}
+
+// builtPipeline prepends the tenant $match to p
+func (s tenantScope) builtPipeline(p *Pipeline) (*Pipeline, error) {
+	if s.field == "" {
+		return p, nil
+	}
+	stages := make([]interface{}, 0, len(p.stages))
+	for _, stage := range p.stages {
+		stages = append(stages, stage)
+	}
+	if err := s.checkStages(stages); err != nil {
+		return nil, err
+	}
+	scoped := append(mongo.Pipeline{{{Key: "$match", Value: bson.M{s.field: s.tenant}}}}, p.stages...)
+	return &Pipeline{stages: scoped, opts: p.opts}, nil
+}
+
+// bulk scopes every operation of b
+func (s tenantScope) bulk(b *Bulk) (*Bulk, error) {
+	if s.field == "" {
+		return b, nil
+	}
+	scoped := &Bulk{ops: make([]bulkOp, 0, len(b.ops)), ordered: b.ordered}
+	for _, op := range b.ops {
+		var err error
+		switch op.kind {
+		case bulkInsert, bulkReplaceOne:
+			op.doc, err = s.doc(op.doc)
+		case bulkUpdateOne, bulkUpdateMany:
+			err = s.checkUpdate(op.doc)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if op.kind != bulkInsert {
+			op.filter = s.filter(op.filter)
+		}
+		scoped.ops = append(scoped.ops, op)
+	}
+	return scoped, nil
+}
+
+func (t *TenantDB) FindOne(name string, query, result interface{}) (err error, exist bool) {
+	return t.FindOneCtx(context.TODO(), name, query, result)
+}
+
+func (t *TenantDB) FindOneCtx(ctx context.Context, name string, query, result interface{}) (err error, exist bool) {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return err, false
+	}
+	return s.db.FindOneCtx(ctx, name, s.filter(query), result)
+}
+
+func (t *TenantDB) Find(name string, query, result interface{}, limit int64) error {
+	return t.FindCtx(context.TODO(), name, query, result, limit)
+}
+
+func (t *TenantDB) FindCtx(ctx context.Context, name string, query, result interface{}, limit int64) error {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return err
+	}
+	return s.db.FindCtx(ctx, name, s.filter(query), result, limit)
+}
+
+func (t *TenantDB) FindAll(name string, query, result interface{}) error {
+	return t.FindAllCtx(context.TODO(), name, query, result)
+}
+
+func (t *TenantDB) FindAllCtx(ctx context.Context, name string, query, result interface{}) error {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return err
+	}
+	return s.db.FindAllCtx(ctx, name, s.filter(query), result)
+}
+
+func (t *TenantDB) FindByLimitAndSkip(name string, query, result interface{}, limit, skip int64) error {
+	return t.FindByLimitAndSkipCtx(context.TODO(), name, query, result, limit, skip)
+}
+
+func (t *TenantDB) FindByLimitAndSkipCtx(ctx context.Context, name string, query, result interface{}, limit, skip int64) error {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return err
+	}
+	return s.db.FindByLimitAndSkipCtx(ctx, name, s.filter(query), result, limit, skip)
+}
+
+func (t *TenantDB) FindWithSelect(name string, query, selection, result interface{}, limit int64) error {
+	return t.FindWithSelectCtx(context.TODO(), name, query, selection, result, limit)
+}
+
+func (t *TenantDB) FindWithSelectCtx(ctx context.Context, name string, query, selection, result interface{}, limit int64) error {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return err
+	}
+	return s.db.FindWithSelectCtx(ctx, name, s.filter(query), selection, result, limit)
+}
+
+func (t *TenantDB) FindSelect(name string, query, selection, result interface{}) error {
+	return t.FindSelectCtx(context.TODO(), name, query, selection, result)
+}
+
+func (t *TenantDB) FindSelectCtx(ctx context.Context, name string, query, selection, result interface{}) error {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return err
+	}
+	return s.db.FindSelectCtx(ctx, name, s.filter(query), selection, result)
+}
+
+func (t *TenantDB) FindWithMultiple(name string, query, selection, sorter, result interface{}, limit, skip int64) error {
+	return t.FindWithMultipleCtx(context.TODO(), name, query, selection, sorter, result, limit, skip)
+}
+
+func (t *TenantDB) FindWithMultipleCtx(ctx context.Context, name string, query, selection, sorter, result interface{}, limit, skip int64) error {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return err
+	}
+	return s.db.FindWithMultipleCtx(ctx, name, s.filter(query), selection, sorter, result, limit, skip)
+}
+
+func (t *TenantDB) FindCount(name string, query interface{}) (int64, error) {
+	return t.FindCountCtx(context.TODO(), name, query)
+}
+
+func (t *TenantDB) FindCountCtx(ctx context.Context, name string, query interface{}) (int64, error) {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	return s.db.FindCountCtx(ctx, name, s.filter(query))
+}
+
+func (t *TenantDB) FindSortByLimitAndSkip(name string, query, sorter, result interface{}, limit, skip int64) error {
+	return t.FindSortByLimitAndSkipCtx(context.TODO(), name, query, sorter, result, limit, skip)
+}
+
+func (t *TenantDB) FindSortByLimitAndSkipCtx(ctx context.Context, name string, query, sorter, result interface{}, limit, skip int64) error {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return err
+	}
+	return s.db.FindSortByLimitAndSkipCtx(ctx, name, s.filter(query), sorter, result, limit, skip)
+}
+
+func (t *TenantDB) FindWithAggregation(name string, pipeline, result interface{}) error {
+	return t.FindWithAggregationCtx(context.TODO(), name, pipeline, result)
+}
+
+func (t *TenantDB) FindWithAggregationCtx(ctx context.Context, name string, pipeline, result interface{}) error {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return err
+	}
+	if pipeline, err = s.pipeline(pipeline); err != nil {
+		return err
+	}
+	return s.db.FindWithAggregationCtx(ctx, name, pipeline, result)
+}
+
+func (t *TenantDB) FindWithDistinct(name, distinct string, query interface{}) ([]interface{}, error) {
+	return t.FindWithDistinctCtx(context.TODO(), name, distinct, query)
+}
+
+func (t *TenantDB) FindWithDistinctCtx(ctx context.Context, name, distinct string, query interface{}) ([]interface{}, error) {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.db.FindWithDistinctCtx(ctx, name, distinct, s.filter(query))
+}
+
+func (t *TenantDB) ForEach(name string, query interface{}, fn func(raw bson.Raw) error) error {
+	return t.ForEachCtx(context.TODO(), name, query, fn)
+}
+
+func (t *TenantDB) ForEachCtx(ctx context.Context, name string, query interface{}, fn func(raw bson.Raw) error) error {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return err
+	}
+	return s.db.ForEachCtx(ctx, name, s.filter(query), fn)
+}
+
+func (t *TenantDB) Aggregate(ctx context.Context, name string, p *Pipeline) (*Iter, error) {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if p, err = s.builtPipeline(p); err != nil {
+		return nil, err
+	}
+	return s.db.Aggregate(ctx, name, p)
+}
+
+func (t *TenantDB) AggregateAll(ctx context.Context, name string, p *Pipeline, result interface{}) error {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return err
+	}
+	if p, err = s.builtPipeline(p); err != nil {
+		return err
+	}
+	return s.db.AggregateAll(ctx, name, p, result)
+}
+
+func (t *TenantDB) Insert(name string, doc interface{}) error {
+	return t.InsertCtx(context.TODO(), name, doc)
+}
+
+func (t *TenantDB) InsertCtx(ctx context.Context, name string, doc interface{}) error {
+	return t.InsertAllCtx(ctx, name, doc)
+}
+
+func (t *TenantDB) InsertAll(name string, docs ...interface{}) error {
+	return t.InsertAllCtx(context.TODO(), name, docs...)
+}
+
+func (t *TenantDB) InsertAllCtx(ctx context.Context, name string, docs ...interface{}) error {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return err
+	}
+	scoped := make([]interface{}, 0, len(docs))
+	for _, v := range docs {
+		doc, err := s.doc(v)
+		if err != nil {
+			return err
+		}
+		scoped = append(scoped, doc)
+	}
+	return s.db.InsertAllCtx(ctx, name, scoped...)
+}
+
+func (t *TenantDB) Update(name string, query, update interface{}, multi bool) error {
+	return t.UpdateCtx(context.TODO(), name, query, update, multi)
+}
+
+func (t *TenantDB) UpdateCtx(ctx context.Context, name string, query, update interface{}, multi bool) error {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err = s.checkUpdate(update); err != nil {
+		return err
+	}
+	return s.db.UpdateCtx(ctx, name, s.filter(query), update, multi)
+}
+
+func (t *TenantDB) UpdateById(name string, id, update interface{}) error {
+	return t.UpdateByIdCtx(context.TODO(), name, id, update)
+}
+
+func (t *TenantDB) UpdateByIdCtx(ctx context.Context, name string, id, update interface{}) error {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return err
+	}
+	if s.field == "" {
+		return s.db.UpdateByIdCtx(ctx, name, id, update)
+	}
+	if err = s.checkUpdate(update); err != nil {
+		return err
+	}
+	return s.db.UpdateCtx(ctx, name, s.filter(bson.M{"_id": id}), update, false)
+}
+
+func (t *TenantDB) UpdateRaw(name string, query, update interface{}, multi bool) error {
+	return t.UpdateRawCtx(context.TODO(), name, query, update, multi)
+}
+
+// UpdateRawCtx upserts with the tenant field, which comes from the filter
+func (t *TenantDB) UpdateRawCtx(ctx context.Context, name string, query, update interface{}, multi bool) error {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err = s.checkUpdate(update); err != nil {
+		return err
+	}
+	return s.db.UpdateRawCtx(ctx, name, s.filter(query), update, multi)
+}
+
+func (t *TenantDB) Remove(name string, query interface{}, multi bool) error {
+	return t.RemoveCtx(context.TODO(), name, query, multi)
+}
+
+func (t *TenantDB) RemoveCtx(ctx context.Context, name string, query interface{}, multi bool) error {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return err
+	}
+	return s.db.RemoveCtx(ctx, name, s.filter(query), multi)
+}
+
+func (t *TenantDB) RemoveById(name string, id interface{}) error {
+	return t.RemoveByIdCtx(context.TODO(), name, id)
+}
+
+func (t *TenantDB) RemoveByIdCtx(ctx context.Context, name string, id interface{}) error {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return err
+	}
+	if s.field == "" {
+		return s.db.RemoveByIdCtx(ctx, name, id)
+	}
+	return s.db.RemoveCtx(ctx, name, s.filter(bson.M{"_id": id}), false)
+}
+
+func (t *TenantDB) GetNextSequence(name string) (int32, error) {
+	return t.GetNextSequenceCtx(context.TODO(), name)
+}
+
+// GetNextSequenceCtx uses a sequence per tenant
+func (t *TenantDB) GetNextSequenceCtx(ctx context.Context, name string) (int32, error) {
+	s, err := t.scope(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	if s.field != "" {
+		name = s.tenant + ":" + name
+	}
+	return s.db.GetNextSequenceCtx(ctx, name)
+}
+
+func (t *TenantDB) FindOneAndUpdate(name string, filter, update interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return t.FindOneAndUpdateCtx(context.TODO(), name, filter, update, opt, result)
+}
+
+func (t *TenantDB) FindOneAndUpdateCtx(ctx context.Context, name string, filter, update interface{}, opt FindAndModifyOptions, result interface{}) error {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err = s.checkUpdate(update); err != nil {
+		return err
+	}
+	return s.db.FindOneAndUpdateCtx(ctx, name, s.filter(filter), update, opt, result)
+}
+
+func (t *TenantDB) FindOneAndReplace(name string, filter, replacement interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return t.FindOneAndReplaceCtx(context.TODO(), name, filter, replacement, opt, result)
+}
+
+func (t *TenantDB) FindOneAndReplaceCtx(ctx context.Context, name string, filter, replacement interface{}, opt FindAndModifyOptions, result interface{}) error {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return err
+	}
+	if replacement, err = s.doc(replacement); err != nil {
+		return err
+	}
+	return s.db.FindOneAndReplaceCtx(ctx, name, s.filter(filter), replacement, opt, result)
+}
+
+func (t *TenantDB) FindOneAndDelete(name string, filter interface{}, opt FindAndModifyOptions, result interface{}) error {
+	return t.FindOneAndDeleteCtx(context.TODO(), name, filter, opt, result)
+}
+
+func (t *TenantDB) FindOneAndDeleteCtx(ctx context.Context, name string, filter interface{}, opt FindAndModifyOptions, result interface{}) error {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return err
+	}
+	return s.db.FindOneAndDeleteCtx(ctx, name, s.filter(filter), opt, result)
+}
+
+func (t *TenantDB) BulkWrite(name string, b *Bulk) (*BulkResult, error) {
+	return t.BulkWriteCtx(context.TODO(), name, b)
+}
+
+func (t *TenantDB) BulkWriteCtx(ctx context.Context, name string, b *Bulk) (*BulkResult, error) {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if b, err = s.bulk(b); err != nil {
+		return nil, err
+	}
+	return s.db.BulkWriteCtx(ctx, name, b)
+}
+
+// Watch with the tenant field matches the full document or the pre-image, so
+// deletes are only seen on collections with pre-images enabled
+func (t *TenantDB) Watch(ctx context.Context, name string, pipeline interface{}, opt WatchOptions) (*ChangeStream, error) {
+	s, err := t.scope(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if s.field != "" {
+		stages, _ := toList(pipeline)
+		if err = s.checkStages(stages); err != nil {
+			return nil, err
+		}
+		match := bson.M{"$match": bson.M{"$or": bson.A{
+			bson.M{"fullDocument." + s.field: s.tenant},
+			bson.M{"fullDocumentBeforeChange." + s.field: s.tenant},
+		}}}
+		pipeline = append(bson.A{match}, stages...)
+	}
+	return s.db.Watch(ctx, name, pipeline, opt)
+}
+
+// SyncIndexes syncs the database of the ctx tenant, or the wrapped database without tenant
+func (t *TenantDB) SyncIndexes(ctx context.Context, specs []IndexSpec, opt IndexSyncOptions) (*IndexDiff, error) {
+	if _, ok := TenantFrom(ctx); !ok || t.database == nil {
+		return t.DBAdaptor.SyncIndexes(ctx, specs, opt)
+	}
+	s, err := t.scope(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	return s.db.SyncIndexes(ctx, specs, opt)
+}
+
+// WithTransaction runs fn in a transaction of the ctx tenant, tx is scoped to the tenant as well
+func (t *TenantDB) WithTransaction(ctx context.Context, fn func(tx DBAdaptor) error, opts ...*options.TransactionOptions) error {
+	s, err := t.scope(ctx, "")
+	if err != nil {
+		return err
+	}
+	if s.field == "" {
+		return s.db.WithTransaction(ctx, fn, opts...)
+	}
+	return s.db.WithTransaction(ctx, func(tx DBAdaptor) error {
+		return fn(&TenantDB{DBAdaptor: tx, field: t.field, shared: t.shared, dbs: map[string]DBAdaptor{}})
+	}, opts...)
+}
@@ -0,0 +1,241 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc:
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestTenant(t *testing.T) {
+	type profile struct {
+		ID       int32  `bson:"_id"`
+		TenantID string `bson:"tenant_id,omitempty"`
+		Name     string `bson:"name"`
+	}
+	acme := WithTenant(context.Background(), "acme")
+	globex := WithTenant(context.Background(), "globex")
+
+	Convey("test tenant field", t, func() {
+		mem := NewMemorySession()
+		db := NewTenantDB(mem, TenantOptions{Shared: []string{"tenant"}})
+
+		So(db.InsertCtx(acme, "profile", &profile{ID: 1, Name: "alice"}), ShouldBeNil)
+		So(db.InsertCtx(globex, "profile", &profile{ID: 2, Name: "bob"}), ShouldBeNil)
+
+		var p profile
+		err, _ := mem.FindOne("profile", bson.M{"_id": 1}, &p)
+		So(err, ShouldBeNil)
+		So(p.TenantID, ShouldEqual, "acme")
+
+		Convey("reads only see the ctx tenant", func() {
+			var all []profile
+			So(db.FindAllCtx(acme, "profile", nil, &all), ShouldBeNil)
+			So(len(all), ShouldEqual, 1)
+			So(all[0].Name, ShouldEqual, "alice")
+
+			err, exist := db.FindOneCtx(acme, "profile", bson.M{"_id": 2}, &p)
+			So(exist, ShouldBeFalse)
+			So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+
+			n, err := db.FindCountCtx(globex, "profile", bson.M{})
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+
+			var names []bson.M
+			So(db.AggregateAll(acme, "profile", NewPipeline().Project(bson.M{"name": 1}), &names), ShouldBeNil)
+			So(len(names), ShouldEqual, 1)
+		})
+
+		Convey("writes only touch the ctx tenant", func() {
+			So(db.UpdateByIdCtx(acme, "profile", 2, bson.M{"name": "hacked"}), ShouldBeNil)
+			So(db.RemoveCtx(acme, "profile", bson.M{"_id": 2}, true), ShouldBeNil)
+			err, _ := mem.FindOne("profile", bson.M{"_id": 2}, &p)
+			So(err, ShouldBeNil)
+			So(p.Name, ShouldEqual, "bob")
+
+			So(db.UpdateRawCtx(acme, "profile", bson.M{"_id": 3}, bson.M{"$set": bson.M{"name": "carol"}}, false), ShouldBeNil)
+			err, _ = mem.FindOne("profile", bson.M{"_id": 3}, &p)
+			So(err, ShouldBeNil)
+			So(p.TenantID, ShouldEqual, "acme")
+
+			_, err = db.BulkWriteCtx(globex, "profile", NewBulk().Insert(&profile{ID: 4}).DeleteMany(nil))
+			So(err, ShouldBeNil)
+			n, _ := mem.FindCount("profile", bson.M{"tenant_id": "acme"})
+			So(n, ShouldEqual, 2)
+		})
+
+		Convey("cross tenant access is rejected", func() {
+			var all []profile
+			So(errors.Is(db.FindAll("profile", nil, &all), ErrNoTenant), ShouldBeTrue)
+			So(errors.Is(db.FindAllCtx(WithTenant(acme, "../admin"), "profile", nil, &all), ErrNoTenant), ShouldBeTrue)
+			So(errors.Is(db.InsertCtx(acme, "profile", &profile{ID: 5, TenantID: "globex"}), ErrCrossTenant), ShouldBeTrue)
+			So(errors.Is(db.UpdateCtx(acme, "profile", nil, bson.M{"tenant_id": "globex"}, true), ErrCrossTenant), ShouldBeTrue)
+			So(errors.Is(db.UpdateRawCtx(acme, "profile", nil, bson.M{"$unset": bson.M{"tenant_id": ""}}, true), ErrCrossTenant), ShouldBeTrue)
+			So(errors.Is(db.UpdateRawCtx(acme, "profile", nil, bson.M{"$rename": bson.M{"other": "tenant_id"}}, true), ErrCrossTenant), ShouldBeTrue)
+			So(errors.Is(db.UpdateRawCtx(acme, "profile", nil, bson.M{"$set": bson.M{"tenant_id.x": 1}}, true), ErrCrossTenant), ShouldBeTrue)
+			So(errors.Is(db.UpdateCtx(acme, "profile", nil, bson.M{"tenant_id.x": 1}, true), ErrCrossTenant), ShouldBeTrue)
+			// 内存版不支持$rename，只检查租户校验放行
+			err := db.UpdateRawCtx(acme, "profile", bson.M{"_id": 1}, bson.M{"$rename": bson.M{"name": "nick"}}, false)
+			So(errors.Is(err, ErrCrossTenant), ShouldBeFalse)
+
+			lookup := NewPipeline().Lookup("orders", "_id", "profile_id", "orders")
+			So(errors.Is(db.AggregateAll(acme, "profile", lookup, &all), ErrCrossTenant), ShouldBeTrue)
+			facet := NewPipeline().Facet(map[string]*Pipeline{"o": NewPipeline().Lookup("orders", "_id", "profile_id", "orders")})
+			So(errors.Is(db.AggregateAll(acme, "profile", facet, &all), ErrCrossTenant), ShouldBeTrue)
+			merge := NewPipeline().Stage(bson.D{{Key: "$merge", Value: bson.M{"into": "profile", "on": "_id"}}})
+			So(errors.Is(db.AggregateAll(acme, "profile", merge, &all), ErrCrossTenant), ShouldBeTrue)
+			for _, stage := range []bson.M{
+				{"$out": "profile_copy"},
+				{"$out": bson.M{"db": "other", "coll": "tenant"}},
+				{"$merge": bson.M{"into": bson.M{"db": "other", "coll": "tenant"}}},
+				{"$merge": "profile"},
+				// 共享集合的子pipeline中$lookup非共享集合
+				{"$lookup": bson.M{"from": "tenant", "as": "t", "pipeline": bson.A{
+					bson.M{"$lookup": bson.M{"from": "orders", "localField": "_id", "foreignField": "tenant_id", "as": "o"}},
+				}}},
+				{"$unionWith": bson.M{"coll": "tenant", "pipeline": bson.A{
+					bson.M{"$unionWith": "orders"},
+				}}},
+			} {
+				err := db.FindWithAggregationCtx(acme, "profile", bson.A{stage}, &all)
+				So(errors.Is(err, ErrCrossTenant), ShouldBeTrue)
+			}
+			// 写入共享集合与不含其他集合的子pipeline放行，内存版不支持这些阶段
+			for _, stage := range []bson.M{
+				{"$out": "tenant"},
+				{"$merge": bson.M{"into": bson.M{"coll": "tenant"}}},
+				{"$unionWith": bson.M{"coll": "tenant", "pipeline": bson.A{bson.M{"$match": bson.M{"a": 1}}}}},
+			} {
+				err := db.FindWithAggregationCtx(acme, "profile", bson.A{stage}, &all)
+				So(errors.Is(err, ErrCrossTenant), ShouldBeFalse)
+			}
+			// 共享集合可以$lookup，内存版不支持$lookup
+			err = db.AggregateAll(acme, "profile", NewPipeline().Lookup("tenant", "tenant_id", "_id", "t"), &[]bson.M{})
+			So(errors.Is(err, ErrCrossTenant), ShouldBeFalse)
+		})
+
+		Convey("shared collections and sequences", func() {
+			So(db.Insert("tenant", bson.M{"_id": "acme"}), ShouldBeNil)
+			n, err := db.FindCount("tenant", nil)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+
+			a, err := db.GetNextSequenceCtx(acme, "order")
+			So(err, ShouldBeNil)
+			g, err := db.GetNextSequenceCtx(globex, "order")
+			So(err, ShouldBeNil)
+			So(a, ShouldEqual, g)
+		})
+
+		Convey("transactions stay in the tenant", func() {
+			err := db.WithTransaction(acme, func(tx DBAdaptor) error {
+				var all []profile
+				if err := tx.FindAllCtx(acme, "profile", nil, &all); err != nil {
+					return err
+				}
+				So(len(all), ShouldEqual, 1)
+				return tx.InsertCtx(acme, "profile", &profile{ID: 6})
+			})
+			So(err, ShouldBeNil)
+			err, _ = mem.FindOne("profile", bson.M{"_id": 6}, &p)
+			So(err, ShouldBeNil)
+			So(p.TenantID, ShouldEqual, "acme")
+		})
+	})
+
+	Convey("test tenant database", t, func() {
+		var m sync.Mutex
+		dbs := map[string]*MemorySession{}
+		block := make(chan struct{})
+		db := NewTenantDB(NewMemorySession(), TenantOptions{
+			Known: func(ctx context.Context, tenant string) (bool, error) {
+				return tenant != "initech", nil
+			},
+			Database: func(ctx context.Context, tenant string) (DBAdaptor, error) {
+				switch tenant {
+				case "slow":
+					select {
+					case <-block:
+					case <-ctx.Done():
+						return nil, ctx.Err()
+					}
+				case "broken":
+					return nil, errors.New("index sync failed")
+				}
+				m.Lock()
+				defer m.Unlock()
+				dbs[tenant] = NewMemorySession()
+				return dbs[tenant], nil
+			},
+			InitTimeout: time.Second,
+		})
+
+		So(db.InsertCtx(acme, "profile", &profile{ID: 1, Name: "alice"}), ShouldBeNil)
+		So(db.InsertCtx(globex, "profile", &profile{ID: 1, Name: "bob"}), ShouldBeNil)
+		So(db.InsertCtx(acme, "profile", &profile{ID: 2, Name: "carol"}), ShouldBeNil)
+		So(len(dbs), ShouldEqual, 2)
+
+		n, err := dbs["acme"].FindCount("profile", nil)
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 2)
+
+		var p profile
+		err, _ = db.FindOneCtx(globex, "profile", bson.M{"_id": 1}, &p)
+		So(err, ShouldBeNil)
+		So(p.Name, ShouldEqual, "bob")
+		So(p.TenantID, ShouldBeEmpty)
+
+		So(errors.Is(db.Insert("profile", &profile{ID: 3}), ErrNoTenant), ShouldBeTrue)
+
+		Convey("unknown tenants get no database", func() {
+			err := db.InsertCtx(WithTenant(context.Background(), "initech"), "profile", &profile{ID: 1})
+			So(errors.Is(err, ErrNoTenant), ShouldBeTrue)
+			So(len(dbs), ShouldEqual, 2)
+
+			closed := NewTenantDB(NewMemorySession(), TenantOptions{
+				Database: func(ctx context.Context, tenant string) (DBAdaptor, error) { return NewMemorySession(), nil },
+			})
+			So(errors.Is(closed.InsertCtx(acme, "profile", &profile{ID: 1}), ErrNoTenant), ShouldBeTrue)
+		})
+
+		Convey("a slow tenant does not block the others", func() {
+			slow := WithTenant(context.Background(), "slow")
+			timeout, cancel := context.WithTimeout(slow, 10*time.Millisecond)
+			defer cancel()
+			So(errors.Is(db.InsertCtx(timeout, "profile", &profile{ID: 1}), context.DeadlineExceeded), ShouldBeTrue)
+			So(db.InsertCtx(acme, "profile", &profile{ID: 3}), ShouldBeNil)
+
+			// 并发请求只创建一次
+			var wg sync.WaitGroup
+			for i := 0; i < 3; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, _ = db.FindCountCtx(slow, "profile", nil)
+				}()
+			}
+			close(block)
+			wg.Wait()
+			So(db.InsertCtx(slow, "profile", &profile{ID: 1}), ShouldBeNil)
+			n, err := dbs["slow"].FindCount("profile", nil)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+		})
+
+		Convey("failed creations are retried", func() {
+			broken := WithTenant(context.Background(), "broken")
+			So(db.InsertCtx(broken, "profile", &profile{ID: 1}), ShouldNotBeNil)
+			So(db.InsertCtx(broken, "profile", &profile{ID: 1}), ShouldNotBeNil)
+			So(len(db.dbs), ShouldEqual, 2)
+		})
+	})
+}
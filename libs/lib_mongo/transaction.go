@@ -0,0 +1,47 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: 多文档事务
+
+package lib_mongo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// WithTransaction runs fn inside a multi-document transaction.
+//
+// Every operation issued through tx joins the transaction. The transaction is
+// aborted if fn returns an error, and the whole callback is retried on
+// TransientTransactionError / UnknownTransactionCommitResult, so fn must be
+// safe to run more than once. Calling WithTransaction on tx joins the
+// outer transaction instead of starting a new one.
+//
+// Transactions need a replica set or sharded cluster.
+func (ms *MongoSession) WithTransaction(ctx context.Context, fn func(tx DBAdaptor) error, opts ...*options.TransactionOptions) error {
+	if ms.txSess != nil {
+		return fn(ms)
+	}
+
+	sess, err := ms.session.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(context.Background())
+
+	tx := &MongoSession{session: ms.session, dbName: ms.dbName, txSess: sess, health: ms.health}
+	_, err = sess.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(tx)
+	}, opts...)
+	return err
+}
+
+// bindCtx 事务中将ctx与driver session关联，使操作加入事务
+func (ms *MongoSession) bindCtx(ctx context.Context) context.Context {
+	if ms.txSess == nil {
+		return ctx
+	}
+	return mongo.NewSessionContext(ctx, ms.txSess)
+}
@@ -0,0 +1,72 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc:
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// 事务中未发出任何命令时，提交与回滚都在driver本地完成，不需要服务端
+func TestWithTransaction(t *testing.T) {
+	Convey("test with transaction", t, func() {
+		ctx := context.TODO()
+		ms := NewMongoSession()
+		So(ms.ConnectCtx(ctx, "mongodb://127.0.0.1:1/?serverSelectionTimeoutMS=100", "db_test"), ShouldBeNil)
+		defer ms.Disconnect()
+
+		Convey("operations of tx are bound to the driver session", func() {
+			So(mongo.SessionFromContext(ms.bindCtx(ctx)), ShouldBeNil)
+			So(ms.WithTransaction(ctx, func(tx DBAdaptor) error {
+				sess := tx.(*MongoSession).txSess
+				So(sess, ShouldNotBeNil)
+				So(mongo.SessionFromContext(tx.(*MongoSession).bindCtx(ctx)), ShouldEqual, sess)
+				So(tx.(*MongoSession).Database("other").txSess, ShouldEqual, sess)
+				return nil
+			}), ShouldBeNil)
+		})
+
+		Convey("nested calls join the outer transaction", func() {
+			calls := 0
+			So(ms.WithTransaction(ctx, func(tx DBAdaptor) error {
+				return tx.WithTransaction(ctx, func(inner DBAdaptor) error {
+					calls++
+					So(inner, ShouldEqual, tx)
+					return nil
+				})
+			}), ShouldBeNil)
+			So(calls, ShouldEqual, 1)
+		})
+
+		Convey("errors of fn abort and are returned as is", func() {
+			boom := errors.New("boom")
+			calls := 0
+			err := ms.WithTransaction(ctx, func(tx DBAdaptor) error {
+				calls++
+				return boom
+			})
+			So(err, ShouldEqual, boom)
+			So(calls, ShouldEqual, 1)
+		})
+
+		Convey("transient transaction errors retry the callback", func() {
+			transient := mongo.CommandError{Code: 112, Name: "WriteConflict", Labels: []string{"TransientTransactionError"}}
+			calls := 0
+			err := ms.WithTransaction(ctx, func(tx DBAdaptor) error {
+				calls++
+				if calls < 3 {
+					return transient
+				}
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(calls, ShouldEqual, 3)
+		})
+	})
+}
@@ -5,7 +5,11 @@
 package lib_mongo
 
 import (
+	"context"
 	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
@@ -14,6 +18,10 @@ var (
 	ErrorLimit      = errors.New("find limit is invalid,must be -1 or > 0")
 	ErrIsDuplicate  = errors.New("error duplicate key")
 	ErrUnknownType  = errors.New("error unknown type")
+	// ForEach回调返回ErrStopIter时提前结束遍历，ForEach返回nil
+	ErrStopIter = errors.New("stop iteration")
+	// 当前DBAdaptor实现不支持该操作
+	ErrNotSupported = errors.New("operation not supported")
 )
 
 // mongodb数据库操作接口封装
@@ -21,6 +29,8 @@ type DBAdaptor interface {
 	Connect(uri, db string) error
 	Disconnect()
 	SetPoolLimit(limit uint64)
+	// 最近一次健康检查结果
+	Health() Health
 
 	// 常用操作接口
 	FindOne(name string, query, result interface{}) (err error, exist bool)
@@ -50,4 +60,64 @@ type DBAdaptor interface {
 	GetNextSequence(name string) (int32, error)
 
 	FindWithDistinct(name, distinct string, query interface{}) ([]interface{}, error)
+
+	// 携带context的操作接口，ctx的超时与取消会传递到driver
+	ConnectCtx(ctx context.Context, uri, db string) error
+
+	FindOneCtx(ctx context.Context, name string, query, result interface{}) (err error, exist bool)
+	FindCtx(ctx context.Context, name string, query, result interface{}, limit int64) error
+	FindAllCtx(ctx context.Context, name string, query, result interface{}) error
+	FindByLimitAndSkipCtx(ctx context.Context, name string, query, result interface{}, limit, skip int64) error
+
+	FindWithSelectCtx(ctx context.Context, name string, query, selection, result interface{}, limit int64) error
+	FindSelectCtx(ctx context.Context, name string, query, selection, result interface{}) error
+	FindWithMultipleCtx(ctx context.Context, name string, query, selection, sorter, result interface{}, limit, skip int64) error
+
+	FindCountCtx(ctx context.Context, name string, query interface{}) (c int64, err error)
+	FindSortByLimitAndSkipCtx(ctx context.Context, name string, query, sorter, result interface{}, limit, skip int64) error
+
+	FindWithAggregationCtx(ctx context.Context, name string, pipeline, result interface{}) error
+
+	RemoveCtx(ctx context.Context, name string, query interface{}, multi bool) error
+	RemoveByIdCtx(ctx context.Context, name string, id interface{}) error
+
+	InsertCtx(ctx context.Context, name string, doc interface{}) error
+	InsertAllCtx(ctx context.Context, name string, docs ...interface{}) error
+
+	UpdateCtx(ctx context.Context, name string, query, update interface{}, multi bool) error
+	UpdateByIdCtx(ctx context.Context, name string, id, update interface{}) error
+	UpdateRawCtx(ctx context.Context, name string, query, update interface{}, multi bool) error
+
+	GetNextSequenceCtx(ctx context.Context, name string) (int32, error)
+
+	FindWithDistinctCtx(ctx context.Context, name, distinct string, query interface{}) ([]interface{}, error)
+
+	// 流式遍历，逐条回调raw文档，raw仅在回调内有效
+	ForEach(name string, query interface{}, fn func(raw bson.Raw) error) error
+	ForEachCtx(ctx context.Context, name string, query interface{}, fn func(raw bson.Raw) error) error
+
+	// 批量写入，一次往返执行多个insert/update/replace/delete
+	BulkWrite(name string, b *Bulk) (*BulkResult, error)
+	BulkWriteCtx(ctx context.Context, name string, b *Bulk) (*BulkResult, error)
+
+	// 按声明同步索引，返回声明与现有索引的差异
+	SyncIndexes(ctx context.Context, specs []IndexSpec, opt IndexSyncOptions) (*IndexDiff, error)
+
+	// 原子的查找并修改，没有返回文档时返回ErrNotFound
+	FindOneAndUpdate(name string, filter, update interface{}, opt FindAndModifyOptions, result interface{}) error
+	FindOneAndUpdateCtx(ctx context.Context, name string, filter, update interface{}, opt FindAndModifyOptions, result interface{}) error
+	FindOneAndReplace(name string, filter, replacement interface{}, opt FindAndModifyOptions, result interface{}) error
+	FindOneAndReplaceCtx(ctx context.Context, name string, filter, replacement interface{}, opt FindAndModifyOptions, result interface{}) error
+	FindOneAndDelete(name string, filter interface{}, opt FindAndModifyOptions, result interface{}) error
+	FindOneAndDeleteCtx(ctx context.Context, name string, filter interface{}, opt FindAndModifyOptions, result interface{}) error
+
+	// 执行Pipeline构建的聚合，Aggregate返回游标迭代器
+	Aggregate(ctx context.Context, name string, p *Pipeline) (*Iter, error)
+	AggregateAll(ctx context.Context, name string, p *Pipeline, result interface{}) error
+
+	// 订阅change stream，name为空时订阅整个库
+	Watch(ctx context.Context, name string, pipeline interface{}, opt WatchOptions) (*ChangeStream, error)
+
+	// 事务，fn中通过tx执行的操作在同一事务中提交或回滚
+	WithTransaction(ctx context.Context, fn func(tx DBAdaptor) error, opts ...*options.TransactionOptions) error
 }
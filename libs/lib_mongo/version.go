@@ -0,0 +1,154 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: 基于版本号的乐观锁
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// 版本号字段，不存在时视为0
+const VersionField = "version"
+
+// 文档已被其他请求修改
+var ErrVersionConflict = errors.New("version conflict")
+
+// 默认重试次数
+const defaultConflictRetries = 3
+
+// versionFilter matches the document id at version
+func versionFilter(id interface{}, version int64) bson.M {
+	if version == 0 {
+		return bson.M{"_id": id, "$or": bson.A{
+			bson.M{VersionField: 0},
+			bson.M{VersionField: bson.M{"$exists": false}},
+		}}
+	}
+	return bson.M{"_id": id, VersionField: version}
+}
+
+// conflictOrNotFound tells a stale version from a missing document
+func conflictOrNotFound(ctx context.Context, db DBAdaptor, op, name string, id interface{}) error {
+	n, err := db.FindCountCtx(ctx, name, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return wrapErr(op, name, ErrVersionConflict)
+	}
+	return wrapErr(op, name, ErrNotFound)
+}
+
+// UpdateVersioned $set update on the document id only if it is still at version,
+// and increments the version. VersionField in update is ignored, e.g. when update
+// is the whole document. It returns ErrVersionConflict when the document was
+// modified meanwhile and ErrNotFound when it does not exist.
+func UpdateVersioned(ctx context.Context, db DBAdaptor, name string, id interface{}, version int64, update interface{}) error {
+	ctx = primaryCtx(ctx)
+	set, err := toM(update)
+	if err != nil {
+		return err
+	}
+	// 与$inc同一字段冲突，版本号只能递增
+	delete(set, VersionField)
+	change := bson.M{"$inc": bson.M{VersionField: 1}}
+	if len(set) > 0 {
+		change["$set"] = set
+	}
+
+	var updated bson.M
+	err = db.FindOneAndUpdateCtx(ctx, name, versionFilter(id, version), change,
+		FindAndModifyOptions{Projection: bson.M{"_id": 1}}, &updated)
+	if errors.Is(err, ErrNotFound) {
+		return conflictOrNotFound(ctx, db, "UpdateVersioned", name, id)
+	}
+	return err
+}
+
+// ReplaceVersioned replaces the document id with doc, whose version is set to version+1,
+// only if it is still at version
+func ReplaceVersioned(ctx context.Context, db DBAdaptor, name string, id interface{}, version int64, doc interface{}, result interface{}) error {
+	ctx = primaryCtx(ctx)
+	replacement, err := toM(doc)
+	if err != nil {
+		return err
+	}
+	replacement[VersionField] = version + 1
+	err = db.FindOneAndReplaceCtx(ctx, name, versionFilter(id, version), replacement,
+		FindAndModifyOptions{ReturnNew: true}, result)
+	if errors.Is(err, ErrNotFound) {
+		return conflictOrNotFound(ctx, db, "ReplaceVersioned", name, id)
+	}
+	return err
+}
+
+// RetryOnConflict calls fn until it does not return ErrVersionConflict, at most attempts times.
+// The ctx passed to fn reads from the primary whatever the read preference set with WithOptions.
+func RetryOnConflict(ctx context.Context, attempts int, fn func(ctx context.Context) error) error {
+	ctx = primaryCtx(ctx)
+	if attempts <= 0 {
+		attempts = defaultConflictRetries
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = fn(ctx); !errors.Is(err, ErrVersionConflict) {
+			return err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+	}
+	return err
+}
+
+// documentVersion returns the version field of doc
+func documentVersion(doc interface{}) (int64, error) {
+	m, err := toM(doc)
+	if err != nil {
+		return 0, err
+	}
+	version, _ := toFloat(m[VersionField])
+	return int64(version), nil
+}
+
+// UpdateVersioned see UpdateVersioned
+func (r *Repository[T]) UpdateVersioned(ctx context.Context, id interface{}, version int64, update interface{}) error {
+	return UpdateVersioned(ctx, r.db, r.name, id, version, update)
+}
+
+// Mutate loads the document id, applies fn and saves it if nobody modified it
+// meanwhile, otherwise it reloads and tries again, at most attempts times.
+//
+//	p, err := profiles.Mutate(ctx, id, 3, func(p *Profile) error {
+//		p.Balance -= amount
+//		if p.Balance < 0 {
+//			return ErrInsufficientBalance
+//		}
+//		return nil
+//	})
+func (r *Repository[T]) Mutate(ctx context.Context, id interface{}, attempts int, fn func(doc *T) error) (*T, error) {
+	var saved *T
+	err := RetryOnConflict(ctx, attempts, func(ctx context.Context) error {
+		doc, err := r.FindOne(ctx, bson.M{"_id": id})
+		if err != nil {
+			return err
+		}
+		version, err := documentVersion(doc)
+		if err != nil {
+			return err
+		}
+		if err = fn(doc); err != nil {
+			return err
+		}
+		saved = new(T)
+		return ReplaceVersioned(ctx, r.db, r.name, id, version, doc, saved)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
@@ -0,0 +1,81 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc:
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestVersion(t *testing.T) {
+	type account struct {
+		ID      int32 `bson:"_id"`
+		Balance int64 `bson:"balance"`
+		Version int64 `bson:"version"`
+	}
+
+	Convey("test optimistic locking", t, func() {
+		ms := NewMemorySession()
+		ctx := context.TODO()
+		So(ms.Insert("account", bson.M{"_id": 1, "balance": 100}), ShouldBeNil)
+		repo := NewRepository[account](ms, "account")
+
+		Convey("update checks the version", func() {
+			So(repo.UpdateVersioned(ctx, 1, 0, bson.M{"balance": 90}), ShouldBeNil)
+			err := repo.UpdateVersioned(ctx, 1, 0, bson.M{"balance": 80})
+			So(errors.Is(err, ErrVersionConflict), ShouldBeTrue)
+			err = repo.UpdateVersioned(ctx, 2, 0, bson.M{"balance": 80})
+			So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+
+			a, err := repo.FindOne(ctx, bson.M{"_id": 1})
+			So(err, ShouldBeNil)
+			So(*a, ShouldResemble, account{ID: 1, Balance: 90, Version: 1})
+		})
+
+		Convey("update ignores the version field", func() {
+			So(repo.UpdateVersioned(ctx, 1, 0, bson.M{"balance": 90, VersionField: 7}), ShouldBeNil)
+			So(repo.UpdateVersioned(ctx, 1, 1, &account{ID: 1, Balance: 80, Version: 1}), ShouldBeNil)
+			So(repo.UpdateVersioned(ctx, 1, 2, bson.M{VersionField: 0}), ShouldBeNil)
+
+			a, err := repo.FindOne(ctx, bson.M{"_id": 1})
+			So(err, ShouldBeNil)
+			So(*a, ShouldResemble, account{ID: 1, Balance: 80, Version: 3})
+		})
+
+		Convey("mutate retries on conflict", func() {
+			calls := 0
+			a, err := repo.Mutate(ctx, 1, 3, func(a *account) error {
+				calls++
+				// 第一次执行期间被并发修改
+				if calls == 1 {
+					So(UpdateVersioned(ctx, ms, "account", 1, a.Version, bson.M{"balance": 50}), ShouldBeNil)
+				}
+				a.Balance -= 10
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(calls, ShouldEqual, 2)
+			So(*a, ShouldResemble, account{ID: 1, Balance: 40, Version: 2})
+
+			stop := errors.New("stop")
+			_, err = repo.Mutate(ctx, 1, 3, func(a *account) error { return stop })
+			So(err, ShouldEqual, stop)
+		})
+
+		Convey("retry gives up", func() {
+			calls := 0
+			err := RetryOnConflict(ctx, 2, func(ctx context.Context) error {
+				calls++
+				return wrapErr("Update", "account", ErrVersionConflict)
+			})
+			So(errors.Is(err, ErrVersionConflict), ShouldBeTrue)
+			So(calls, ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,198 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc: change stream订阅，resume token持久化
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// resume token持久化集合
+const ChangeStreamTokenCollection = "change_stream_tokens"
+
+// WatchOptions configures Watch
+type WatchOptions struct {
+	// 不为空时按该名称持久化resume token，重启后从上次处理的位置继续
+	ResumeName string
+	// update事件返回完整文档
+	FullDocument bool
+	BatchSize    int32
+	// 每次getMore等待新事件的最长时间
+	MaxAwaitTime time.Duration
+}
+
+// ChangeNamespace is the database and collection of a change
+type ChangeNamespace struct {
+	DB   string `bson:"db"`
+	Coll string `bson:"coll"`
+}
+
+// ChangeUpdate describes the fields changed by an update event
+type ChangeUpdate struct {
+	UpdatedFields bson.M   `bson:"updatedFields"`
+	RemovedFields []string `bson:"removedFields"`
+}
+
+// ChangeEvent is one change stream event
+type ChangeEvent struct {
+	// resume token
+	ID                bson.Raw            `bson:"_id"`
+	OperationType     string              `bson:"operationType"`
+	Ns                ChangeNamespace     `bson:"ns"`
+	DocumentKey       bson.M              `bson:"documentKey"`
+	FullDocument      bson.Raw            `bson:"fullDocument"`
+	UpdateDescription *ChangeUpdate       `bson:"updateDescription"`
+	ClusterTime       primitive.Timestamp `bson:"clusterTime"`
+}
+
+// Decode decodes the full document of the event into result
+func (e *ChangeEvent) Decode(result interface{}) error {
+	if len(e.FullDocument) == 0 {
+		return ErrNotFound
+	}
+	return bson.Unmarshal(e.FullDocument, result)
+}
+
+type resumeToken struct {
+	Name      string    `bson:"_id"`
+	Token     bson.Raw  `bson:"token"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+// ChangeStream iterates over change events
+//
+//	cs, err := env.MongoCli.Watch(ctx, "profile", nil, lib_mongo.WatchOptions{ResumeName: "profile-cache"})
+//	if err != nil {
+//		return err
+//	}
+//	defer cs.Close()
+//	var ev lib_mongo.ChangeEvent
+//	for cs.Next(ctx, &ev) {
+//		invalidate(ev.DocumentKey)
+//	}
+//	return cs.Err()
+//
+// With a ResumeName, Next saves the token of the previous event before it waits
+// for the next one, so an event is only skipped after restart once it was handled.
+type ChangeStream struct {
+	stream changeCursor
+	db     DBAdaptor
+	name   string
+	// 已处理但未保存的token
+	pending bson.Raw
+	err     error
+}
+
+// changeCursor *mongo.ChangeStream中ChangeStream用到的方法
+type changeCursor interface {
+	Next(ctx context.Context) bool
+	Decode(val interface{}) error
+	ResumeToken() bson.Raw
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// Next decodes the next event into ev, it blocks until an event arrives or ctx is done
+func (cs *ChangeStream) Next(ctx context.Context, ev *ChangeEvent) bool {
+	if cs.err != nil {
+		return false
+	}
+	if cs.err = cs.Save(ctx); cs.err != nil {
+		return false
+	}
+	if !cs.stream.Next(ctx) {
+		return false
+	}
+	*ev = ChangeEvent{}
+	if cs.err = cs.stream.Decode(ev); cs.err != nil {
+		return false
+	}
+	if cs.name != "" {
+		cs.pending = cs.stream.ResumeToken()
+	}
+	return true
+}
+
+// Save persists the token of the last event returned by Next
+func (cs *ChangeStream) Save(ctx context.Context) error {
+	if cs.name == "" || cs.pending == nil {
+		return nil
+	}
+	err := cs.db.UpdateRawCtx(ctx, ChangeStreamTokenCollection, bson.M{"_id": cs.name},
+		bson.M{"$set": bson.M{"token": cs.pending, "updated_at": time.Now()}}, false)
+	if err != nil {
+		return err
+	}
+	cs.pending = nil
+	return nil
+}
+
+// Err returns the error that stopped the iteration
+func (cs *ChangeStream) Err() error {
+	if cs.err != nil {
+		return cs.err
+	}
+	return cs.stream.Err()
+}
+
+// Close closes the stream, the token of the last event is not saved, call Save first if it was handled
+func (cs *ChangeStream) Close() error {
+	return cs.stream.Close(context.Background())
+}
+
+// Watch opens a change stream on the collection, or on the whole database when name is empty
+func (ms *MongoSession) Watch(ctx context.Context, name string, pipeline interface{}, opt WatchOptions) (*ChangeStream, error) {
+	ctx = ms.bindCtx(ctx)
+	if pipeline == nil {
+		pipeline = mongo.Pipeline{}
+	}
+	opts, err := watchOptions(ctx, ms, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	var stream *mongo.ChangeStream
+	db := ms.session.DB(ms.dbName)
+	if name == "" {
+		stream, err = db.database.Watch(ctx, pipeline, opts)
+	} else {
+		stream, err = db.C(name).collection.Watch(ctx, pipeline, opts)
+	}
+	if err != nil {
+		return nil, wrapErr("Watch", name, err)
+	}
+	return &ChangeStream{stream: stream, db: ms, name: opt.ResumeName}, nil
+}
+
+// watchOptions 转换WatchOptions，并从db中读取ResumeName保存的resume token
+func watchOptions(ctx context.Context, db DBAdaptor, opt WatchOptions) (*options.ChangeStreamOptions, error) {
+	opts := options.ChangeStream()
+	if opt.FullDocument {
+		opts.SetFullDocument(options.UpdateLookup)
+	}
+	if opt.BatchSize > 0 {
+		opts.SetBatchSize(opt.BatchSize)
+	}
+	if opt.MaxAwaitTime > 0 {
+		opts.SetMaxAwaitTime(opt.MaxAwaitTime)
+	}
+	if opt.ResumeName != "" {
+		var saved resumeToken
+		err, exist := db.FindOneCtx(ctx, ChangeStreamTokenCollection, bson.M{"_id": opt.ResumeName}, &saved)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		if exist && len(saved.Token) > 0 {
+			opts.SetResumeAfter(saved.Token)
+		}
+	}
+	return opts, nil
+}
@@ -0,0 +1,146 @@
+// author: s0nnet
+// time: 2026-10-18
+// desc:
+
+package lib_mongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// fakeCursor 按顺序返回events，每个事件的_id即resume token
+type fakeCursor struct {
+	events []bson.Raw
+	cur    bson.Raw
+	err    error
+	closed bool
+}
+
+func (c *fakeCursor) Next(ctx context.Context) bool {
+	if c.err != nil || len(c.events) == 0 {
+		return false
+	}
+	c.cur, c.events = c.events[0], c.events[1:]
+	return true
+}
+
+func (c *fakeCursor) Decode(val interface{}) error {
+	return bson.Unmarshal(c.cur, val)
+}
+
+func (c *fakeCursor) ResumeToken() bson.Raw {
+	return c.cur.Lookup("_id").Document()
+}
+
+func (c *fakeCursor) Err() error {
+	return c.err
+}
+
+func (c *fakeCursor) Close(ctx context.Context) error {
+	c.closed = true
+	return nil
+}
+
+func TestChangeStream(t *testing.T) {
+	event := func(token string, ev bson.M) bson.Raw {
+		ev["_id"] = bson.M{"_data": token}
+		raw, err := bson.Marshal(ev)
+		So(err, ShouldBeNil)
+		return raw
+	}
+	saved := func(db DBAdaptor, name string) string {
+		opts, err := watchOptions(context.TODO(), db, WatchOptions{ResumeName: name})
+		So(err, ShouldBeNil)
+		if opts.ResumeAfter == nil {
+			return ""
+		}
+		return opts.ResumeAfter.(bson.Raw).Lookup("_data").StringValue()
+	}
+
+	Convey("test change stream", t, func() {
+		ctx := context.TODO()
+		mem := NewMemorySession()
+		cursor := &fakeCursor{events: []bson.Raw{
+			event("t1", bson.M{"operationType": "insert", "documentKey": bson.M{"_id": 1}, "fullDocument": bson.M{"_id": 1, "name": "alice"}}),
+			event("t2", bson.M{"operationType": "update", "documentKey": bson.M{"_id": 1},
+				"updateDescription": bson.M{"updatedFields": bson.M{"name": "bob"}, "removedFields": bson.A{"age"}}}),
+		}}
+		cs := &ChangeStream{stream: cursor, db: mem, name: "profile-cache"}
+
+		Convey("tokens are saved once the event is handled and loaded on watch", func() {
+			So(saved(mem, "profile-cache"), ShouldBeEmpty)
+
+			var ev ChangeEvent
+			So(cs.Next(ctx, &ev), ShouldBeTrue)
+			So(ev.OperationType, ShouldEqual, "insert")
+			So(saved(mem, "profile-cache"), ShouldBeEmpty)
+
+			So(cs.Next(ctx, &ev), ShouldBeTrue)
+			So(saved(mem, "profile-cache"), ShouldEqual, "t1")
+			So(ev.UpdateDescription.UpdatedFields["name"], ShouldEqual, "bob")
+			So(ev.UpdateDescription.RemovedFields, ShouldResemble, []string{"age"})
+			So(ev.FullDocument, ShouldBeNil)
+
+			So(cs.Next(ctx, &ev), ShouldBeFalse)
+			So(cs.Err(), ShouldBeNil)
+			So(saved(mem, "profile-cache"), ShouldEqual, "t2")
+			So(saved(mem, "other"), ShouldBeEmpty)
+
+			n, err := mem.FindCount(ChangeStreamTokenCollection, nil)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+		})
+
+		Convey("save persists the pending token before close", func() {
+			var ev ChangeEvent
+			So(cs.Next(ctx, &ev), ShouldBeTrue)
+			So(cs.Save(ctx), ShouldBeNil)
+			So(cs.Close(), ShouldBeNil)
+			So(cursor.closed, ShouldBeTrue)
+			So(saved(mem, "profile-cache"), ShouldEqual, "t1")
+		})
+
+		Convey("streams without a resume name save nothing", func() {
+			cs.name = ""
+			var ev ChangeEvent
+			for cs.Next(ctx, &ev) {
+			}
+			So(cs.Save(ctx), ShouldBeNil)
+			n, err := mem.FindCount(ChangeStreamTokenCollection, nil)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 0)
+		})
+
+		Convey("decode the full document", func() {
+			var ev ChangeEvent
+			So(cs.Next(ctx, &ev), ShouldBeTrue)
+			var doc struct {
+				ID   int32  `bson:"_id"`
+				Name string `bson:"name"`
+			}
+			So(ev.Decode(&doc), ShouldBeNil)
+			So(doc.Name, ShouldEqual, "alice")
+
+			So(cs.Next(ctx, &ev), ShouldBeTrue)
+			So(errors.Is(ev.Decode(&doc), ErrNotFound), ShouldBeTrue)
+		})
+
+		Convey("errors stop the iteration", func() {
+			cursor.events[0] = event("t1", bson.M{"operationType": 1})
+			var ev ChangeEvent
+			So(cs.Next(ctx, &ev), ShouldBeFalse)
+			So(cs.Err(), ShouldNotBeNil)
+			So(cs.Next(ctx, &ev), ShouldBeFalse)
+
+			cursor = &fakeCursor{err: errors.New("stream closed")}
+			cs = &ChangeStream{stream: cursor, db: mem}
+			So(cs.Next(ctx, &ev), ShouldBeFalse)
+			So(cs.Err(), ShouldEqual, cursor.err)
+		})
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"myGin/bootstrap"
 	"myGin/common"
+	_ "myGin/migrations"
 	"myGin/routes"
 	"net/http"
 	"os"
@@ -15,6 +16,12 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := bootstrap.RunMigrate(common.YamlFile, os.Args[2:]); err != nil {
+			log.Fatal("migrate: ", err)
+		}
+		return
+	}
 	if err := bootstrap.Bootstrap(common.YamlFile); err != nil {
 		panic(err)
 	}
@@ -29,12 +36,21 @@ func main() {
 	}()
 	quit := make(chan os.Signal)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	code := 0
+	select {
+	case <-quit:
+	case err := <-common.GetEnv().Fatal():
+		log.Println("Fatal:", err)
+		code = 1
+	}
 	log.Println("Shutting down server...")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
+		cancel()
 		log.Fatal("Server forced to shutdown:", err)
 	}
+	cancel()
+	common.GetEnv().DisconnectMongo()
 	log.Println("Server exiting")
+	os.Exit(code)
 }
@@ -0,0 +1,15 @@
+// Package migrations 注册mongodb数据迁移，在init中调用lib_mongo.RegisterMigration
+//
+//	func init() {
+//		lib_mongo.RegisterMigration(lib_mongo.Migration{
+//			Version: 2026101801,
+//			Name:    "profile_add_event_count",
+//			Up: func(ctx context.Context, db lib_mongo.DBAdaptor) error {
+//				return db.UpdateRawCtx(ctx, "profile", bson.M{"event_count": bson.M{"$exists": false}},
+//					bson.M{"$set": bson.M{"event_count": 0}}, true)
+//			},
+//		})
+//	}
+//
+// 版本号只增不减，已发布的迁移不要修改。
+package migrations
@@ -2,11 +2,18 @@ package routes
 
 import (
 	"github.com/gin-gonic/gin"
+	"myGin/common"
 	"myGin/handlers"
 )
 
 func Routes() *gin.Engine {
 	r := gin.Default()
 	r.GET("/ping", handlers.Pong)
+	r.GET("/metrics", handlers.Metrics)
+	r.GET("/health", handlers.Health)
+	// 之后注册的路由需要租户，以上路由不受影响
+	if cfg := common.GetEnv().Cfg; cfg != nil && cfg.Tenant.Enable {
+		r.Use(handlers.Tenant(cfg.Tenant))
+	}
 	return r
 }